@@ -0,0 +1,73 @@
+package client
+
+import (
+	"sync"
+
+	"github.com/vajadhav/bp_upd/ufa"
+)
+
+//Backend runs the UFA chaincode functions, either in process or on a peer
+type Backend interface {
+	//Invoke runs a function which changes the state
+	Invoke(function string, args []string) ([]byte, error)
+	//Query runs a read only function
+	Query(function string, args []string) ([]byte, error)
+}
+
+//finisher is implemented by stores which buffer the writes of a call
+//until it finishes, such as store.FileStore
+type finisher interface {
+	Finish(err error) error
+}
+
+//Ends the call on stores buffering its writes
+func finish(stub ufa.Store, err error) error {
+	if f, ok := stub.(finisher); ok {
+		return f.Finish(err)
+	}
+	return err
+}
+
+//LocalBackend runs the functions in process against a state store. The
+//functions read and rewrite shared lists, so calls are serialized the way
+//the ordering service serializes transactions on a peer; it is safe for
+//concurrent use
+type LocalBackend struct {
+	Store ufa.Store
+	mu    sync.RWMutex
+}
+
+//NewLocalBackend prepares the store like the chaincode Init would and
+//returns a backend running against it
+func NewLocalBackend(stub ufa.Store) (*LocalBackend, error) {
+	_, err := ufa.InitLedger(stub, nil)
+	if err := finish(stub, err); err != nil {
+		return nil, err
+	}
+	return &LocalBackend{Store: stub}, nil
+}
+
+//Invoke runs a state changing function against the store
+func (b *LocalBackend) Invoke(function string, args []string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	output, err := ufa.Invoke(b.Store, function, args)
+	if err := finish(b.Store, err); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+//Query runs a read only function against the store
+func (b *LocalBackend) Query(function string, args []string) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return ufa.Query(b.Store, function, args)
+}
+
+//Run a validation against the store, under the same lock as the queries
+func (b *LocalBackend) validate(check func(stub ufa.Store) string) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return check(b.Store)
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+const testUFA = `{"sellerName":"S1","buyerName":"B1","netCharge":"1000","chargTolrence":"10","billingFrequency":"MONTHLY","startDate":"2016-01-01","endDate":"2016-12-31"}`
+
+//A local backend on a state file saves the calls which succeed and nothing
+//of those which fail
+func TestLocalBackendStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	b, err := Open(Options{Backend: "local", StatePath: path})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, err := b.Invoke("createUFA", []string{"U1", "S1", testUFA}); err != nil {
+		t.Fatalf("createUFA failed: %v", err)
+	}
+	if _, err := b.Invoke("createUFA", []string{"U1", "S1", testUFA}); err == nil {
+		t.Fatal("createUFA created U1 twice")
+	}
+	if _, err := b.Invoke("createUFA", []string{"U2", "S1", `{"sellerName":"S1"}`}); err == nil {
+		t.Fatal("createUFA accepted an invalid UFA")
+	}
+
+	reopened, err := Open(Options{Backend: "local", StatePath: path})
+	if err != nil {
+		t.Fatalf("Open on the saved state failed: %v", err)
+	}
+	if output, err := reopened.Query("getUFADetails", []string{"U1", "S1"}); err != nil || string(output) == "null" {
+		t.Fatalf("U1 was not saved: %s %v", output, err)
+	}
+	if output, _ := reopened.Query("getUFADetails", []string{"U2", "S1"}); string(output) != "null" {
+		t.Fatalf("the failed createUFA of U2 was saved: %s", output)
+	}
+}
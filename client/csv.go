@@ -0,0 +1,105 @@
+package client
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//DefaultUFAColumns maps the usual CSV column titles, compared in lower
+//case, to UFA record fields. Columns not listed keep their title as the
+//field name
+var DefaultUFAColumns = map[string]string{
+	"ufa":               "ufanumber",
+	"ufa number":        "ufanumber",
+	"ufanumber":         "ufanumber",
+	"net charge":        "netCharge",
+	"netcharge":         "netCharge",
+	"tolerance":         "chargTolrence",
+	"charge tolerance":  "chargTolrence",
+	"chargtolrence":     "chargTolrence",
+	"seller":            "sellerName",
+	"seller name":       "sellerName",
+	"sellername":        "sellerName",
+	"buyer":             "buyerName",
+	"buyer name":        "buyerName",
+	"buyername":         "buyerName",
+	"currency":          "currency",
+	"billing frequency": "billingFrequency",
+	"billingfrequency":  "billingFrequency",
+}
+
+//UFARecordsFromCSV turns a CSV file with a header row into UFA records.
+//Column titles are mapped with columns, falling back to
+//DefaultUFAColumns. Amounts are normalized so "1,200.50" becomes
+//"1200.50" and a tolerance of "5%" becomes "5"; empty cells are left out
+func UFARecordsFromCSV(r io.Reader, columns map[string]string) ([]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("the CSV file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, len(header))
+	for i, title := range header {
+		key := strings.ToLower(strings.TrimSpace(title))
+		if field, ok := columns[key]; ok {
+			fields[i] = field
+		} else if field, ok := DefaultUFAColumns[key]; ok {
+			fields[i] = field
+		} else {
+			fields[i] = strings.TrimSpace(title)
+		}
+	}
+
+	records := make([]map[string]string, 0)
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		record := make(map[string]string)
+		for i, value := range row {
+			value = strings.TrimSpace(value)
+			if value == "" || i >= len(fields) || fields[i] == "" {
+				continue
+			}
+			if fields[i] == "netCharge" || fields[i] == "chargTolrence" {
+				value, err = normalizeAmount(value)
+				if err != nil {
+					return nil, errors.New("line " + strconv.Itoa(line) + ": " + header[i] + ": " + err.Error())
+				}
+			}
+			record[fields[i]] = value
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+//Drop thousands separators, currency symbols and percent signs from an
+//amount and check what is left is a number
+func normalizeAmount(value string) (string, error) {
+	cleaned := strings.Map(func(r rune) rune {
+		if (r >= '0' && r <= '9') || r == '.' || r == '-' {
+			return r
+		}
+		if r == ',' || r == '%' || r == ' ' || r == '$' || r == '€' || r == '£' {
+			return -1
+		}
+		return r
+	}, value)
+	if _, err := strconv.ParseFloat(cleaned, 64); err != nil {
+		return "", errors.New(value + " is not an amount")
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"errors"
+
+	"github.com/vajadhav/bp_upd/store"
+)
+
+//MEMORY_STATE State path selecting a local store which is not saved
+const MEMORY_STATE = ":memory:"
+
+//Options select and configure a backend
+type Options struct {
+	//"local" or "peer"
+	Backend string
+	//State file of the local backend, MEMORY_STATE to keep it in memory
+	StatePath string
+	//Settings of the peer backend
+	PeerBinary  string
+	Channel     string
+	Chaincode   string
+	InvokeFlags []string
+}
+
+//Open returns the backend described by the options
+func Open(opts Options) (Backend, error) {
+	switch opts.Backend {
+	case "local":
+		if opts.StatePath == MEMORY_STATE {
+			return NewLocalBackend(store.NewMemStore())
+		}
+		fileStore, err := store.OpenFileStore(opts.StatePath)
+		if err != nil {
+			return nil, err
+		}
+		return NewLocalBackend(fileStore)
+	case "peer":
+		if opts.Channel == "" {
+			return nil, errors.New("a channel is required for the peer backend")
+		}
+		return &PeerBackend{
+			Binary:      opts.PeerBinary,
+			Channel:     opts.Channel,
+			Chaincode:   opts.Chaincode,
+			InvokeFlags: opts.InvokeFlags,
+		}, nil
+	}
+	return nil, errors.New("unknown backend " + opts.Backend)
+}
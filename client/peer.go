@@ -0,0 +1,83 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+//PeerBackend runs the functions on a Fabric network through the peer
+//command line tool. The peer environment (CORE_PEER_ADDRESS, MSP, TLS
+//settings) is taken from the process environment
+type PeerBackend struct {
+	//Path of the peer binary, "peer" when empty
+	Binary string
+	//Channel the chaincode is deployed on
+	Channel string
+	//Name of the chaincode
+	Chaincode string
+	//Extra flags passed to peer chaincode invoke, for example orderer and
+	//TLS settings
+	InvokeFlags []string
+}
+
+//Invoke submits a state changing function as a transaction and returns
+//the payload reported by the peer
+func (b *PeerBackend) Invoke(function string, args []string) ([]byte, error) {
+	cmdArgs := []string{"chaincode", "invoke", "--waitForEvent"}
+	cmdArgs = append(cmdArgs, b.InvokeFlags...)
+	_, stderr, err := b.run(cmdArgs, function, args)
+	if err != nil {
+		return nil, err
+	}
+	return invokePayload(stderr), nil
+}
+
+//The peer logs the result of an invoke as
+//"Chaincode invoke successful. result: status:200 payload:"..."", with the
+//payload quoted
+func invokePayload(output []byte) []byte {
+	for _, line := range strings.Split(string(output), "\n") {
+		index := strings.Index(line, "payload:")
+		if index < 0 || !strings.Contains(line, "result:") {
+			continue
+		}
+		payload, err := strconv.Unquote(strings.TrimSpace(line[index+len("payload:"):]))
+		if err == nil {
+			return []byte(payload)
+		}
+	}
+	return nil
+}
+
+//Query evaluates a read only function on the peer
+func (b *PeerBackend) Query(function string, args []string) ([]byte, error) {
+	output, _, err := b.run([]string{"chaincode", "query"}, function, args)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(output), nil
+}
+
+//Run the peer command with the function and arguments as the chaincode
+//input. Returns what the command wrote to stdout and stderr
+func (b *PeerBackend) run(cmdArgs []string, function string, args []string) ([]byte, []byte, error) {
+	input, _ := json.Marshal(map[string][]string{"Args": append([]string{function}, args...)})
+	cmdArgs = append(cmdArgs, "-C", b.Channel, "-n", b.Chaincode, "-c", string(input))
+
+	binary := b.Binary
+	if binary == "" {
+		binary = "peer"
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(binary, cmdArgs...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, nil, errors.New(function + " failed on the peer: " + strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), stderr.Bytes(), nil
+}
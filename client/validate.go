@@ -0,0 +1,57 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/vajadhav/bp_upd/ufa"
+)
+
+//ValidateUFA runs the createUFA validation before the UFA is submitted.
+//A local backend is checked in process; any other backend, such as a
+//peer, answers the validateNewUFA query with the rules of its own ledger.
+//Returns the validation messages, empty when the UFA is valid, or the
+//error of a check which could not be run
+func ValidateUFA(b Backend, who string, payload string) (string, error) {
+	if local, ok := b.(*LocalBackend); ok {
+		return local.validate(func(stub ufa.Store) string {
+			return ufa.ValidateNewUFA(stub, who, payload)
+		}), nil
+	}
+	return validationQuery(b, "validateNewUFA", []string{who, payload})
+}
+
+//ValidateInvoices runs the createNewInvoices validation before the
+//invoices are submitted, in process for a local backend and through the
+//validateNewInvoideData query otherwise
+func ValidateInvoices(b Backend, who string, payload string) (string, error) {
+	if local, ok := b.(*LocalBackend); ok {
+		return local.validate(func(stub ufa.Store) string {
+			return ufa.ValidateInvoiceDetails(stub, []string{who, payload})
+		}), nil
+	}
+	return validationQuery(b, "validateNewInvoideData", []string{who, payload})
+}
+
+//Run a validation query and return its messages. A result which does not
+//read as a validation is an error, never a success
+func validationQuery(b Backend, function string, args []string) (string, error) {
+	output, err := b.Query(function, args)
+	if err != nil {
+		return "", err
+	}
+	var result map[string]string
+	if err := json.Unmarshal(output, &result); err != nil {
+		return "", errors.New(function + " returned " + string(output))
+	}
+	switch result["validation"] {
+	case "Success":
+		return "", nil
+	case "Failure":
+		if result["msg"] == "" {
+			return "\n" + function + " failed without a message", nil
+		}
+		return result["msg"], nil
+	}
+	return "", errors.New(function + " returned " + string(output))
+}
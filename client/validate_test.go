@@ -0,0 +1,54 @@
+package client
+
+import (
+	"errors"
+	"testing"
+)
+
+//Backend answering every query with the same output and error, as a peer
+//would
+type queryBackend struct {
+	output []byte
+	err    error
+	calls  []string
+}
+
+func (b *queryBackend) Invoke(function string, args []string) ([]byte, error) {
+	return nil, errors.New("not expected")
+}
+
+func (b *queryBackend) Query(function string, args []string) ([]byte, error) {
+	b.calls = append(b.calls, function)
+	return b.output, b.err
+}
+
+func TestValidateThroughQueries(t *testing.T) {
+	tests := []struct {
+		output  string
+		err     error
+		msg     string
+		failure bool
+	}{
+		{`{"validation":"Success","msg":""}`, nil, "", false},
+		{`{"validation":"Failure","msg":"\nInvalid net charge"}`, nil, "\nInvalid net charge", false},
+		{`{"validation":"Failure"}`, nil, "\nvalidateNewUFA failed without a message", false},
+		{`{}`, nil, "", true},
+		{`not json`, nil, "", true},
+		{``, errors.New("validateNewUFA failed on the peer"), "", true},
+	}
+	for _, test := range tests {
+		b := &queryBackend{output: []byte(test.output), err: test.err}
+		msg, err := ValidateUFA(b, "S1", `{}`)
+		if msg != test.msg || (err != nil) != test.failure {
+			t.Errorf("ValidateUFA with %q = %q, %v", test.output, msg, err)
+		}
+		if len(b.calls) != 1 || b.calls[0] != "validateNewUFA" {
+			t.Errorf("ValidateUFA queried %v", b.calls)
+		}
+	}
+
+	b := &queryBackend{output: []byte(`{"validation":"Failure","msg":"\nInvalid UFA provided"}`)}
+	if msg, err := ValidateInvoices(b, "S1", `[]`); msg != "\nInvalid UFA provided" || err != nil || b.calls[0] != "validateNewInvoideData" {
+		t.Errorf("ValidateInvoices = %q, %v after %v", msg, err, b.calls)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+
+	"github.com/vajadhav/bp_upd/client"
+)
+
+//invoice raise: validate and create the customer and vendor invoices
+func invoiceRaise(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("invoice raise", flag.ExitOnError)
+	who := fs.String("who", "", "user raising the invoices")
+	ufanumber := fs.String("ufa", "", "UFA number the invoices are raised against")
+	customerNumber := fs.String("customer-invoice", "", "number of the customer invoice")
+	vendorNumber := fs.String("vendor-invoice", "", "number of the vendor invoice")
+	amount := fs.String("amount", "", "invoice amount")
+	period := fs.String("period", "", "billing period")
+	file := fs.String("file", "", "JSON file with the customer and vendor invoices, - for standard input")
+	fields := fieldFlags{}
+	fs.Var(fields, "set", "additional field on both invoices as key=value, can be repeated")
+	fs.Parse(args)
+
+	var invoiceList []map[string]string
+	if *file != "" {
+		if err := readPayloadFile(*file, &invoiceList); err != nil {
+			return err
+		}
+	} else {
+		invoiceList = []map[string]string{
+			{"invoiceNumber": *customerNumber},
+			{"invoiceNumber": *vendorNumber},
+		}
+	}
+	if len(invoiceList) != 2 {
+		return errors.New("invoice raise expects a customer and a vendor invoice")
+	}
+	for _, invoice := range invoiceList {
+		for key, value := range map[string]string{
+			"ufanumber":     *ufanumber,
+			"invoiceAmt":    *amount,
+			"billingPeriod": *period,
+			"raisedBy":      *who,
+		} {
+			if value != "" {
+				invoice[key] = value
+			}
+		}
+		for key, value := range fields {
+			invoice[key] = value
+		}
+		if invoice["invoiceNumber"] == "" {
+			return errors.New("invoice raise expects the customer and vendor invoice numbers")
+		}
+	}
+
+	payload, _ := json.Marshal(invoiceList)
+	if err := validationError(client.ValidateInvoices(b, *who, string(payload))); err != nil {
+		return err
+	}
+	_, err := b.Invoke("createNewInvoices", []string{*who, string(payload)})
+	return err
+}
+
+//invoice simulate: show the effect of invoices on a UFA without raising them
+func invoiceSimulate(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("invoice simulate", flag.ExitOnError)
+	who := fs.String("who", "", "user raising the invoices")
+	file := fs.String("file", "", "JSON file with the customer and vendor invoices, pair after pair, - for standard input")
+	fs.Parse(args)
+	if *file == "" {
+		return errors.New("invoice simulate expects -file")
+	}
+	var invoiceList []map[string]string
+	if err := readPayloadFile(*file, &invoiceList); err != nil {
+		return err
+	}
+	payload, _ := json.Marshal(invoiceList)
+	output, err := b.Query("simulateInvoices", []string{*who, string(payload)})
+	printOutput(output)
+	return err
+}
+
+//invoice batch: raise invoice pairs against many UFAs in one transaction
+func invoiceBatch(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("invoice batch", flag.ExitOnError)
+	who := fs.String("who", "", "user raising the invoices")
+	file := fs.String("file", "", "JSON file with an array of customer and vendor invoice pairs, - for standard input")
+	mode := fs.String("mode", "", "ALL_OR_NOTHING (default) or BEST_EFFORT")
+	fs.Parse(args)
+	if *file == "" {
+		return errors.New("invoice batch expects -file")
+	}
+	var pairs [][]map[string]string
+	if err := readPayloadFile(*file, &pairs); err != nil {
+		return err
+	}
+	for _, pair := range pairs {
+		for _, invoice := range pair {
+			if invoice["raisedBy"] == "" {
+				invoice["raisedBy"] = *who
+			}
+		}
+	}
+	payload, _ := json.Marshal(pairs)
+	output, err := b.Invoke("batchCreateInvoices", []string{*who, string(payload), *mode})
+	printOutput(output)
+	return err
+}
+
+//invoice generate: raise the invoices due on the UFAs with recurring billing
+func invoiceGenerate(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("invoice generate", flag.ExitOnError)
+	who := fs.String("who", "", "admin, or seller generating the invoices of its UFAs")
+	asOf := fs.String("as-of", "", "date the periods are due by, YYYY-MM-DD")
+	ufanumber := fs.String("ufa", "", "only generate for this UFA")
+	fs.Parse(args)
+	if *asOf == "" {
+		return errors.New("invoice generate expects -as-of")
+	}
+	output, err := b.Invoke("generateDueInvoices", []string{*who, *asOf, *ufanumber})
+	printOutput(output)
+	return err
+}
+
+//invoice get NUMBER: show an invoice
+func invoiceGet(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("invoice get", flag.ExitOnError)
+	who := fs.String("who", "", "user reading the invoice")
+	fs.Parse(args)
+	number, err := singleArg(fs, "invoice number")
+	if err != nil {
+		return err
+	}
+	output, err := b.Query("getInvoiceDetails", []string{number, *who})
+	printOutput(output)
+	return err
+}
+
+//invoice list: show the invoices of a UFA or of a user
+func invoiceList(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("invoice list", flag.ExitOnError)
+	ufanumber := fs.String("ufa", "", "list the invoices raised against this UFA")
+	who := fs.String("who", "", "user listing the invoices; without -ufa the invoices raised or approved by this user")
+	fs.Parse(args)
+
+	var output []byte
+	var err error
+	if *ufanumber != "" {
+		output, err = b.Query("getInvoices", []string{*ufanumber, *who})
+	} else if *who != "" {
+		output, err = b.Query("getAllInvoicesForUsr", []string{*who})
+	} else {
+		return errors.New("invoice list expects -ufa or -who")
+	}
+	printOutput(output)
+	return err
+}
+
+//invoice approve NUMBER: approve an invoice
+func invoiceApprove(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("invoice approve", flag.ExitOnError)
+	who := fs.String("who", "", "user approving the invoice")
+	signature := fs.String("signature", "", "base64 signature of the approver over the approved invoice")
+	fs.Parse(args)
+	number, err := singleArg(fs, "invoice number")
+	if err != nil {
+		return err
+	}
+	output, err := b.Invoke("approveInvoice", []string{*who, number, *signature})
+	printOutput(output)
+	return err
+}
@@ -0,0 +1,208 @@
+//ufactl is the command line client of the UFA chaincode. It builds the
+//chaincode payloads from flags or files, validates them with the chaincode
+//rules and runs them in process against a local state file or on a peer.
+//
+//	ufactl [flags] ufa create|get|list|update|history|import|alerts|amend|schedule [options]
+//	ufactl [flags] invoice raise|get|list|approve|simulate|batch|generate [options]
+//	ufactl [flags] report utilization|invoicesByPeriod|outstanding [options]
+//	ufactl [flags] party register|get|update|deactivate [options]
+//	ufactl [flags] usage submit|get [options]
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/vajadhav/bp_upd/client"
+	"github.com/vajadhav/bp_upd/ufa"
+)
+
+var (
+	backendName = flag.String("backend", "local", "where the functions run: local or peer")
+	statePath   = flag.String("state", "ufactl-state.json", "state file of the local backend, "+client.MEMORY_STATE+" to keep it in memory")
+	peerBinary  = flag.String("peer", "peer", "peer binary used by the peer backend")
+	channel     = flag.String("channel", "", "channel of the chaincode for the peer backend")
+	chaincode   = flag.String("chaincode", "ufa", "chaincode name for the peer backend")
+	invokeFlags = flag.String("invoke-flags", "", "extra flags for peer chaincode invoke, space separated")
+	verbose     = flag.Bool("v", false, "log the chaincode messages")
+)
+
+//Subcommands of each resource
+var commands = map[string]map[string]func(b client.Backend, args []string) error{
+	"ufa": {
+		"create":   ufaCreate,
+		"get":      ufaGet,
+		"list":     ufaList,
+		"update":   ufaUpdate,
+		"history":  ufaHistory,
+		"import":   ufaImport,
+		"alerts":   ufaAlerts,
+		"amend":    ufaAmend,
+		"schedule": ufaSchedule,
+	},
+	"invoice": {
+		"raise":    invoiceRaise,
+		"get":      invoiceGet,
+		"list":     invoiceList,
+		"approve":  invoiceApprove,
+		"simulate": invoiceSimulate,
+		"batch":    invoiceBatch,
+		"generate": invoiceGenerate,
+	},
+	"report": {
+		"utilization":      reportCommand("utilization"),
+		"invoicesByPeriod": reportCommand("invoicesByPeriod"),
+		"outstanding":      reportCommand("outstanding"),
+	},
+	"party": {
+		"register":   partyRegister,
+		"get":        partyGet,
+		"update":     partyUpdate,
+		"deactivate": partyDeactivate,
+	},
+	"usage": {
+		"submit": usageSubmit,
+		"get":    usageGet,
+	},
+}
+
+type quietLogger struct{}
+
+func (quietLogger) Info(args ...interface{}) {}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 2 {
+		usage()
+		os.Exit(2)
+	}
+	resource, ok := commands[flag.Arg(0)]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	command, ok := resource[flag.Arg(1)]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if !*verbose {
+		ufa.SetLogger(quietLogger{})
+	}
+
+	backend, err := client.Open(client.Options{
+		Backend:     *backendName,
+		StatePath:   *statePath,
+		PeerBinary:  *peerBinary,
+		Channel:     *channel,
+		Chaincode:   *chaincode,
+		InvokeFlags: strings.Fields(*invokeFlags),
+	})
+	if err == nil {
+		err = command(backend, flag.Args()[2:])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ufactl:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: ufactl [flags] ufa create|get|list|update|history|import|alerts|amend|schedule [options]")
+	fmt.Fprintln(os.Stderr, "       ufactl [flags] invoice raise|get|list|approve|simulate|batch|generate [options]")
+	fmt.Fprintln(os.Stderr, "       ufactl [flags] report utilization|invoicesByPeriod|outstanding [options]")
+	fmt.Fprintln(os.Stderr, "       ufactl [flags] party register|get|update|deactivate [options]")
+	fmt.Fprintln(os.Stderr, "       ufactl [flags] usage submit|get [options]")
+	fmt.Fprintln(os.Stderr, "\nRun a command with -h for its options.\n\nflags:")
+	flag.PrintDefaults()
+}
+
+//fieldFlags collects repeated -set key=value flags
+type fieldFlags map[string]string
+
+func (f fieldFlags) String() string {
+	return ""
+}
+
+func (f fieldFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return errors.New("expected key=value, got " + value)
+	}
+	f[parts[0]] = parts[1]
+	return nil
+}
+
+//Read a JSON payload from a file, "-" for standard input
+func readPayloadFile(path string, target interface{}) error {
+	var fileBytes []byte
+	var err error
+	if path == "-" {
+		fileBytes, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		fileBytes, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(fileBytes, target); err != nil {
+		return errors.New("invalid JSON in " + path + ": " + err.Error())
+	}
+	return nil
+}
+
+//Build a record from an optional file with the flag fields on top
+func buildRecord(path string, fields map[string]string) (map[string]string, error) {
+	record := make(map[string]string)
+	if path != "" {
+		if err := readPayloadFile(path, &record); err != nil {
+			return nil, err
+		}
+	}
+	for key, value := range fields {
+		if value != "" {
+			record[key] = value
+		}
+	}
+	return record, nil
+}
+
+//Print a chaincode response, indenting it when it is JSON
+func printOutput(output []byte) {
+	if len(output) == 0 {
+		return
+	}
+	var indented bytes.Buffer
+	if json.Indent(&indented, output, "", "  ") == nil {
+		fmt.Println(indented.String())
+		return
+	}
+	fmt.Println(strings.TrimRight(string(output), "\n"))
+}
+
+//Return the only positional argument of a command
+func singleArg(fs *flag.FlagSet, name string) (string, error) {
+	if fs.NArg() != 1 {
+		return "", errors.New(fs.Name() + " expects the " + name)
+	}
+	return fs.Arg(0), nil
+}
+
+//Turn the result of a validation into an error: the error of a check
+//which could not run, or the validation messages
+func validationError(msg string, err error) error {
+	if err != nil {
+		return err
+	}
+	if msg == "" {
+		return nil
+	}
+	return errors.New("validation failed:" + strings.Replace(msg, "\n", "\n  ", -1))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+
+	"github.com/vajadhav/bp_upd/client"
+)
+
+//Read the party JSON file given with -file
+func readPartyFile(fs *flag.FlagSet, path string) (string, error) {
+	if path == "" {
+		return "", errors.New(fs.Name() + " expects -file")
+	}
+	var party map[string]interface{}
+	if err := readPayloadFile(path, &party); err != nil {
+		return "", err
+	}
+	partyBytes, _ := json.Marshal(party)
+	return string(partyBytes), nil
+}
+
+//party register: register a party from a JSON file
+func partyRegister(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("party register", flag.ExitOnError)
+	who := fs.String("who", "", "admin registering the party")
+	file := fs.String("file", "", "JSON file with the party, - for standard input")
+	fs.Parse(args)
+	party, err := readPartyFile(fs, *file)
+	if err != nil {
+		return err
+	}
+	output, err := b.Invoke("registerParty", []string{*who, party})
+	printOutput(output)
+	return err
+}
+
+//party get ID: show a party
+func partyGet(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("party get", flag.ExitOnError)
+	who := fs.String("who", "", "user reading the party")
+	fs.Parse(args)
+	id, err := singleArg(fs, "party id")
+	if err != nil {
+		return err
+	}
+	output, err := b.Query("getParty", []string{id, *who})
+	printOutput(output)
+	return err
+}
+
+//party update ID: change the fields of a party from a JSON file
+func partyUpdate(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("party update", flag.ExitOnError)
+	who := fs.String("who", "", "admin updating the party")
+	file := fs.String("file", "", "JSON file with the fields to change, - for standard input")
+	fs.Parse(args)
+	id, err := singleArg(fs, "party id")
+	if err != nil {
+		return err
+	}
+	fields, err := readPartyFile(fs, *file)
+	if err != nil {
+		return err
+	}
+	output, err := b.Invoke("updateParty", []string{*who, id, fields})
+	printOutput(output)
+	return err
+}
+
+//party deactivate ID: stop new UFAs and invoices referencing a party
+func partyDeactivate(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("party deactivate", flag.ExitOnError)
+	who := fs.String("who", "", "admin deactivating the party")
+	fs.Parse(args)
+	id, err := singleArg(fs, "party id")
+	if err != nil {
+		return err
+	}
+	output, err := b.Invoke("deactivateParty", []string{*who, id})
+	printOutput(output)
+	return err
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+
+	"github.com/vajadhav/bp_upd/client"
+	"github.com/vajadhav/bp_upd/ufa"
+)
+
+//Return the command running the named exportReport report
+func reportCommand(name string) func(b client.Backend, args []string) error {
+	return func(b client.Backend, args []string) error {
+		fs := flag.NewFlagSet("report "+name, flag.ExitOnError)
+		who := fs.String("who", "", "user running the report")
+		format := fs.String("format", "csv", "csv or json")
+		var filter ufa.ReportFilter
+		fs.StringVar(&filter.Party, "party", "", "only UFAs naming this seller or buyer")
+		fs.StringVar(&filter.From, "from", "", "first billing period included")
+		fs.StringVar(&filter.To, "to", "", "last billing period included")
+		fs.StringVar(&filter.AsOf, "as-of", "", "date the invoices are aged at, YYYY-MM-DD")
+		fs.Parse(args)
+
+		filterBytes, _ := json.Marshal(filter)
+		output, err := b.Query("exportReport", []string{*who, name, *format, string(filterBytes)})
+		printOutput(output)
+		return err
+	}
+}
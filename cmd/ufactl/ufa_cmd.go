@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/vajadhav/bp_upd/client"
+	"github.com/vajadhav/bp_upd/ufa"
+)
+
+//ufa create: validate and create a UFA
+func ufaCreate(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("ufa create", flag.ExitOnError)
+	number := fs.String("number", "", "UFA number")
+	who := fs.String("who", "", "seller or buyer creating the UFA, or an admin")
+	netCharge := fs.String("net-charge", "", "net charge of the agreement")
+	tolerance := fs.String("tolerance", "", "charge tolerance in percent")
+	file := fs.String("file", "", "JSON file with the UFA fields, - for standard input")
+	fields := fieldFlags{}
+	fs.Var(fields, "set", "additional field as key=value, can be repeated")
+	fs.Parse(args)
+
+	fields["netCharge"] = *netCharge
+	fields["chargTolrence"] = *tolerance
+	record, err := buildRecord(*file, fields)
+	if err != nil {
+		return err
+	}
+	if *number == "" {
+		*number = record["ufanumber"]
+	}
+	if *number == "" {
+		return errors.New("ufa create expects -number or a ufanumber field")
+	}
+	record["ufanumber"] = *number
+
+	payload, _ := json.Marshal(record)
+	if err := validationError(client.ValidateUFA(b, *who, string(payload))); err != nil {
+		return err
+	}
+	_, err = b.Invoke("createUFA", []string{*number, *who, string(payload)})
+	return err
+}
+
+//ufa get NUMBER: show a UFA
+func ufaGet(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("ufa get", flag.ExitOnError)
+	who := fs.String("who", "", "user reading the UFA")
+	fs.Parse(args)
+	number, err := singleArg(fs, "UFA number")
+	if err != nil {
+		return err
+	}
+	output, err := b.Query("getUFADetails", []string{number, *who})
+	printOutput(output)
+	return err
+}
+
+//ufa list: show all the UFAs
+func ufaList(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("ufa list", flag.ExitOnError)
+	who := fs.String("who", "", "user listing the UFAs")
+	fs.Parse(args)
+	output, err := b.Query("getAllUFA", []string{*who})
+	printOutput(output)
+	return err
+}
+
+//ufa update: change fields of a UFA
+func ufaUpdate(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("ufa update", flag.ExitOnError)
+	number := fs.String("number", "", "UFA number")
+	who := fs.String("who", "", "user updating the UFA")
+	file := fs.String("file", "", "JSON file with the fields to change, - for standard input")
+	fields := fieldFlags{}
+	fs.Var(fields, "set", "field to change as key=value, can be repeated")
+	fs.Parse(args)
+
+	if *number == "" {
+		return errors.New("ufa update expects -number")
+	}
+	record, err := buildRecord(*file, fields)
+	if err != nil {
+		return err
+	}
+	if len(record) == 0 {
+		return errors.New("ufa update expects -set or -file")
+	}
+	payload, _ := json.Marshal(record)
+	_, err = b.Invoke("updateUFA", []string{*number, *who, string(payload)})
+	return err
+}
+
+//ufa history NUMBER: show the changes made to a UFA
+func ufaHistory(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("ufa history", flag.ExitOnError)
+	who := fs.String("who", "", "user reading the history")
+	fs.Parse(args)
+	number, err := singleArg(fs, "UFA number")
+	if err != nil {
+		return err
+	}
+	output, err := b.Query("getUFAHistory", []string{number, *who})
+	printOutput(output)
+	return err
+}
+
+//ufa alerts NUMBER: show the utilization alerts raised on a UFA
+func ufaAlerts(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("ufa alerts", flag.ExitOnError)
+	who := fs.String("who", "", "user reading the alerts")
+	fs.Parse(args)
+	number, err := singleArg(fs, "UFA number")
+	if err != nil {
+		return err
+	}
+	output, err := b.Query("getAlerts", []string{number, *who})
+	printOutput(output)
+	return err
+}
+
+//ufa import: create a batch of UFAs from a CSV or JSON file
+func ufaImport(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("ufa import", flag.ExitOnError)
+	who := fs.String("who", "", "seller or buyer creating the UFAs, or an admin")
+	file := fs.String("file", "", "CSV file with a header row, or a JSON array of UFA records")
+	mode := fs.String("mode", "all-or-nothing", "all-or-nothing or best-effort")
+	columns := fieldFlags{}
+	fs.Var(columns, "map", "map a CSV column to a UFA field as column=field, can be repeated")
+	fs.Parse(args)
+
+	if *file == "" {
+		return errors.New("ufa import expects -file")
+	}
+	var records []map[string]string
+	if strings.HasSuffix(strings.ToLower(*file), ".json") {
+		if err := readPayloadFile(*file, &records); err != nil {
+			return err
+		}
+	} else {
+		csvFile, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer csvFile.Close()
+		mapping := make(map[string]string)
+		for column, field := range columns {
+			mapping[strings.ToLower(column)] = field
+		}
+		if records, err = client.UFARecordsFromCSV(csvFile, mapping); err != nil {
+			return err
+		}
+	}
+
+	bulkMode := ufa.BULK_ALL_OR_NOTHING
+	if strings.ToLower(*mode) == "best-effort" {
+		bulkMode = ufa.BULK_BEST_EFFORT
+	} else if strings.ToLower(*mode) != "all-or-nothing" {
+		return errors.New("unknown mode " + *mode)
+	}
+	payload, _ := json.Marshal(records)
+	output, err := b.Invoke("bulkCreateUFA", []string{*who, string(payload), bulkMode})
+	printOutput(output)
+	return err
+}
+
+//ufa amend NUMBER: change fields of a UFA from an effective date
+func ufaAmend(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("ufa amend", flag.ExitOnError)
+	who := fs.String("who", "", "party of the UFA or admin amending it")
+	effective := fs.String("effective", "", "date the change takes effect, YYYY-MM-DD")
+	fields := fieldFlags{}
+	fs.Var(fields, "set", "field to change as key=value, can be repeated")
+	fs.Parse(args)
+	number, err := singleArg(fs, "UFA number")
+	if err != nil {
+		return err
+	}
+	if *effective == "" || len(fields) == 0 {
+		return errors.New("ufa amend expects -effective and at least one -set")
+	}
+	payload, _ := json.Marshal(fields)
+	output, err := b.Invoke("amendUFA", []string{number, *who, *effective, string(payload)})
+	printOutput(output)
+	return err
+}
+
+//ufa schedule NUMBER: show the billing periods and expected amounts of a UFA
+func ufaSchedule(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("ufa schedule", flag.ExitOnError)
+	who := fs.String("who", "", "user reading the schedule")
+	until := fs.String("until", "", "last date shown for a UFA without end date, YYYY-MM-DD")
+	fs.Parse(args)
+	number, err := singleArg(fs, "UFA number")
+	if err != nil {
+		return err
+	}
+	output, err := b.Query("getBillingSchedule", []string{number, *who, *until})
+	printOutput(output)
+	return err
+}
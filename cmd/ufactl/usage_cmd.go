@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"strconv"
+
+	"github.com/vajadhav/bp_upd/client"
+	"github.com/vajadhav/bp_upd/ufa"
+)
+
+//usage submit: record metered consumption against a UFA
+func usageSubmit(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("usage submit", flag.ExitOnError)
+	who := fs.String("who", "", "party of the UFA or source submitting the usage")
+	ufanumber := fs.String("ufa", "", "UFA the usage is metered against")
+	file := fs.String("file", "", "JSON file with the usage record, - for standard input")
+	var record ufa.UsageRecord
+	fs.StringVar(&record.ID, "id", "", "id of the usage record")
+	fs.StringVar(&record.Meter, "meter", "", "meter on the rate card")
+	quantity := fs.String("quantity", "", "quantity consumed")
+	fs.StringVar(&record.Period, "period", "", "billing period of the usage")
+	fs.StringVar(&record.Source, "source", "", "party the usage comes from")
+	fs.StringVar(&record.Signature, "signature", "", "base64 signature of the source over the record")
+	fs.Parse(args)
+
+	if *file != "" {
+		if err := readPayloadFile(*file, &record); err != nil {
+			return err
+		}
+	}
+	if *quantity != "" {
+		value, err := strconv.ParseFloat(*quantity, 64)
+		if err != nil {
+			return errors.New("usage submit expects -quantity as a number")
+		}
+		record.Quantity = value
+	}
+	if *ufanumber == "" {
+		return errors.New("usage submit expects -ufa")
+	}
+	payload, _ := json.Marshal(record)
+	output, err := b.Invoke("submitUsage", []string{*who, *ufanumber, string(payload)})
+	printOutput(output)
+	return err
+}
+
+//usage get NUMBER: show the usage of a UFA in a period, priced on its rate card
+func usageGet(b client.Backend, args []string) error {
+	fs := flag.NewFlagSet("usage get", flag.ExitOnError)
+	who := fs.String("who", "", "user reading the usage")
+	period := fs.String("period", "", "billing period")
+	fs.Parse(args)
+	number, err := singleArg(fs, "UFA number")
+	if err != nil {
+		return err
+	}
+	output, err := b.Query("getUsage", []string{number, *who, *period})
+	printOutput(output)
+	return err
+}
@@ -0,0 +1,66 @@
+//ufagw serves the UFA chaincode functions as a REST/JSON API. With the
+//default local backend it runs the chaincode rules in process against an
+//in-memory state, which is meant for local development of the portal.
+//Callers are not authenticated, the user is taken from the X-UFA-User
+//header, so the server should not be exposed beyond the developer's
+//machine.
+//
+//	ufagw -listen localhost:8080
+//	ufagw -backend peer -channel mychannel -chaincode ufa
+//	ufagw -openapi > openapi.json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/vajadhav/bp_upd/client"
+	"github.com/vajadhav/bp_upd/gateway"
+	"github.com/vajadhav/bp_upd/ufa"
+)
+
+var (
+	listen      = flag.String("listen", "localhost:8080", "address the server listens on")
+	backendName = flag.String("backend", "local", "where the functions run: local or peer")
+	statePath   = flag.String("state", client.MEMORY_STATE, "state file of the local backend, "+client.MEMORY_STATE+" to keep it in memory")
+	peerBinary  = flag.String("peer", "peer", "peer binary used by the peer backend")
+	channel     = flag.String("channel", "", "channel of the chaincode for the peer backend")
+	chaincode   = flag.String("chaincode", "ufa", "chaincode name for the peer backend")
+	invokeFlags = flag.String("invoke-flags", "", "extra flags for peer chaincode invoke, space separated")
+	printSpec   = flag.Bool("openapi", false, "print the OpenAPI document and exit")
+	verbose     = flag.Bool("v", false, "log the chaincode messages")
+)
+
+type quietLogger struct{}
+
+func (quietLogger) Info(args ...interface{}) {}
+
+func main() {
+	flag.Parse()
+	if *printSpec {
+		fmt.Println(string(gateway.NewServer(nil).OpenAPI()))
+		return
+	}
+	if !*verbose {
+		ufa.SetLogger(quietLogger{})
+	}
+
+	backend, err := client.Open(client.Options{
+		Backend:     *backendName,
+		StatePath:   *statePath,
+		PeerBinary:  *peerBinary,
+		Channel:     *channel,
+		Chaincode:   *chaincode,
+		InvokeFlags: strings.Fields(*invokeFlags),
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ufagw:", err)
+		os.Exit(1)
+	}
+	log.Println("ufagw listening on " + *listen)
+	log.Fatal(http.ListenAndServe(*listen, gateway.NewServer(backend)))
+}
@@ -0,0 +1,405 @@
+//Package gateway exposes the UFA chaincode functions as REST resources.
+//Requests are validated with the chaincode rules and forwarded to a
+//client.Backend, so the same server runs in process for development or
+//in front of a peer.
+//
+//The gateway does not authenticate its callers: the user is whatever the
+//X-UFA-User header says. It is meant for local development of the portal.
+//In front of a peer every request is submitted with the identity of the
+//peer command line tool, which the chaincode takes as the caller, so the
+//header does not pick the user there either.
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/vajadhav/bp_upd/client"
+)
+
+//USER_HEADER Header carrying the user on whose behalf the call is made.
+//It is passed to the chaincode as the who argument, and reads only return
+//the records this user may see. It is not authenticated
+const USER_HEADER = "X-UFA-User"
+
+//SIGNATURE_HEADER Optional header carrying the base64 signature of the
+//approver over the approved invoice
+const SIGNATURE_HEADER = "X-UFA-Signature"
+
+//Largest request body accepted
+const maxBodyBytes = 1 << 20
+
+//A resource operation mapped onto a chaincode function
+type route struct {
+	method   string
+	pattern  string
+	function string
+	summary  string
+	//Name of the request body schema, empty when the operation has none
+	body string
+	//Name of the response schema, empty when nothing is returned
+	response string
+	handle   func(s *Server, w http.ResponseWriter, r *http.Request, params map[string]string)
+}
+
+//Server serves the UFA resources
+type Server struct {
+	Backend client.Backend
+	routes  []route
+}
+
+//NewServer returns a server forwarding the requests to the backend
+func NewServer(b client.Backend) *Server {
+	return &Server{Backend: b, routes: routes()}
+}
+
+//The resources served. The OpenAPI document is generated from this table
+func routes() []route {
+	return []route{
+		{"GET", "/ufas", "getAllUFA", "List all the UFAs", "", "UFAList", (*Server).listUFAs},
+		{"POST", "/ufas", "createUFA", "Create a UFA", "UFA", "UFA", (*Server).createUFA},
+		{"GET", "/ufas/{id}", "getUFADetails", "Get a UFA", "", "UFA", (*Server).getUFA},
+		{"PATCH", "/ufas/{id}", "updateUFA", "Change fields of a UFA", "UFA", "", (*Server).updateUFA},
+		{"GET", "/ufas/{id}/history", "getUFAHistory", "List the changes made to a UFA", "", "History", (*Server).getUFAHistory},
+		{"GET", "/ufas/{id}/invoices", "getInvoices", "List the invoices of a UFA", "", "InvoiceList", (*Server).listUFAInvoices},
+		{"POST", "/ufas/{id}/invoices", "createNewInvoices", "Raise the customer and vendor invoices of a UFA", "InvoicePair", "InvoicePair", (*Server).createInvoices},
+		{"POST", "/ufas/{id}/invoices/simulate", "simulateInvoices", "Show the effect of invoices on a UFA without raising them", "InvoiceList", "Simulation", (*Server).simulateInvoices},
+		{"GET", "/invoices", "getAllInvoicesForUsr", "List the invoices raised or approved by the user", "", "InvoiceList", (*Server).listUserInvoices},
+		{"POST", "/invoices/batch", "batchCreateInvoices", "Raise invoice pairs against many UFAs in one transaction", "InvoicePairList", "BatchReport", (*Server).batchInvoices},
+		{"GET", "/invoices/{id}", "getInvoiceDetails", "Get an invoice", "", "Invoice", (*Server).getInvoice},
+		{"POST", "/invoices/{id}/approve", "approveInvoice", "Approve an invoice", "", "Invoice", (*Server).approveInvoice},
+	}
+}
+
+//ServeHTTP routes the request to the matching resource operation
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/openapi.json" && r.Method == "GET" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(s.OpenAPI())
+		return
+	}
+	pathMatched := false
+	for _, rt := range s.routes {
+		params, ok := matchPath(rt.pattern, r.URL.Path)
+		if !ok {
+			continue
+		}
+		pathMatched = true
+		if rt.method == r.Method {
+			rt.handle(s, w, r, params)
+			return
+		}
+	}
+	if pathMatched {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method "+r.Method+" is not allowed"))
+		return
+	}
+	writeError(w, http.StatusNotFound, errors.New("no resource at "+r.URL.Path))
+}
+
+//Match a path against a pattern such as /ufas/{id}, returning the values
+//of the placeholders
+func matchPath(pattern string, path string) (map[string]string, bool) {
+	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(patternParts) != len(pathParts) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, part := range patternParts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			if pathParts[i] == "" {
+				return nil, false
+			}
+			params[part[1:len(part)-1]] = pathParts[i]
+		} else if part != pathParts[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func (s *Server) listUFAs(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	who, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	s.query(w, "getAllUFA", []string{who})
+}
+
+func (s *Server) createUFA(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	who, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	var record map[string]string
+	if !readBody(w, r, &record) {
+		return
+	}
+	ufanumber := record["ufanumber"]
+	if ufanumber == "" {
+		writeError(w, http.StatusBadRequest, errors.New("ufanumber is required"))
+		return
+	}
+	payload, _ := json.Marshal(record)
+	if msg, err := client.ValidateUFA(s.Backend, who, string(payload)); err != nil {
+		writeChaincodeError(w, err)
+		return
+	} else if msg != "" {
+		writeValidationError(w, msg)
+		return
+	}
+	if _, err := s.Backend.Invoke("createUFA", []string{ufanumber, who, string(payload)}); err != nil {
+		writeChaincodeError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/ufas/"+ufanumber)
+	writeJSON(w, http.StatusCreated, payload)
+}
+
+func (s *Server) getUFA(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	who, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	s.get(w, "getUFADetails", []string{params["id"], who})
+}
+
+func (s *Server) updateUFA(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	who, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	var fields map[string]string
+	if !readBody(w, r, &fields) {
+		return
+	}
+	payload, _ := json.Marshal(fields)
+	if _, err := s.Backend.Invoke("updateUFA", []string{params["id"], who, string(payload)}); err != nil {
+		writeChaincodeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getUFAHistory(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	who, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	s.query(w, "getUFAHistory", []string{params["id"], who})
+}
+
+func (s *Server) listUFAInvoices(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	who, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	s.query(w, "getInvoices", []string{params["id"], who})
+}
+
+func (s *Server) createInvoices(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	who, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	var invoiceList []map[string]string
+	if !readBody(w, r, &invoiceList) {
+		return
+	}
+	if len(invoiceList) != 2 {
+		writeError(w, http.StatusBadRequest, errors.New("a customer and a vendor invoice are required"))
+		return
+	}
+	for _, invoice := range invoiceList {
+		if invoice["invoiceNumber"] == "" {
+			writeError(w, http.StatusBadRequest, errors.New("invoiceNumber is required"))
+			return
+		}
+		invoice["ufanumber"] = params["id"]
+		if invoice["raisedBy"] == "" {
+			invoice["raisedBy"] = who
+		}
+	}
+	payload, _ := json.Marshal(invoiceList)
+	if msg, err := client.ValidateInvoices(s.Backend, who, string(payload)); err != nil {
+		writeChaincodeError(w, err)
+		return
+	} else if msg != "" {
+		writeValidationError(w, msg)
+		return
+	}
+	if _, err := s.Backend.Invoke("createNewInvoices", []string{who, string(payload)}); err != nil {
+		writeChaincodeError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/ufas/"+params["id"]+"/invoices")
+	writeJSON(w, http.StatusCreated, payload)
+}
+
+func (s *Server) simulateInvoices(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	who, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	var invoiceList []map[string]string
+	if !readBody(w, r, &invoiceList) {
+		return
+	}
+	for _, invoice := range invoiceList {
+		invoice["ufanumber"] = params["id"]
+		if invoice["raisedBy"] == "" {
+			invoice["raisedBy"] = who
+		}
+	}
+	payload, _ := json.Marshal(invoiceList)
+	s.query(w, "simulateInvoices", []string{who, string(payload)})
+}
+
+func (s *Server) batchInvoices(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	who, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	var pairs [][]map[string]string
+	if !readBody(w, r, &pairs) {
+		return
+	}
+	for _, pair := range pairs {
+		for _, invoice := range pair {
+			if invoice["raisedBy"] == "" {
+				invoice["raisedBy"] = who
+			}
+		}
+	}
+	payload, _ := json.Marshal(pairs)
+	output, err := s.Backend.Invoke("batchCreateInvoices", []string{who, string(payload), r.URL.Query().Get("mode")})
+	if err != nil {
+		writeChaincodeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, output)
+}
+
+func (s *Server) listUserInvoices(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	who, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	s.query(w, "getAllInvoicesForUsr", []string{who})
+}
+
+func (s *Server) getInvoice(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	who, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	s.get(w, "getInvoiceDetails", []string{params["id"], who})
+}
+
+func (s *Server) approveInvoice(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	who, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	output, err := s.Backend.Invoke("approveInvoice", []string{who, params["id"], r.Header.Get(SIGNATURE_HEADER)})
+	if err != nil {
+		writeChaincodeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, output)
+}
+
+//Run a query and write its JSON result
+func (s *Server) query(w http.ResponseWriter, function string, args []string) {
+	output, err := s.Backend.Query(function, args)
+	if err != nil {
+		writeChaincodeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, output)
+}
+
+//Read a single record, answering 404 when the chaincode returns nothing
+func (s *Server) get(w http.ResponseWriter, function string, args []string) {
+	output, err := s.Backend.Query(function, args)
+	if err != nil {
+		writeChaincodeError(w, err)
+		return
+	}
+	if isEmptyRecord(output) {
+		writeError(w, http.StatusNotFound, errors.New(args[0]+" not found"))
+		return
+	}
+	writeJSON(w, http.StatusOK, output)
+}
+
+func isEmptyRecord(output []byte) bool {
+	trimmed := strings.TrimSpace(string(output))
+	return trimmed == "" || trimmed == "null" || trimmed == "{}"
+}
+
+//Answer with the status matching an error returned by the chaincode
+func writeChaincodeError(w http.ResponseWriter, err error) {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "not authorized"):
+		writeError(w, http.StatusForbidden, err)
+	case strings.Contains(msg, "already exists"):
+		writeError(w, http.StatusConflict, err)
+	case strings.Contains(msg, "Invalid UFA provided"), strings.Contains(msg, "Invalid invoice provided"):
+		writeError(w, http.StatusNotFound, err)
+	default:
+		writeError(w, http.StatusUnprocessableEntity, err)
+	}
+}
+
+//Return the calling user, answering 401 when the header is missing
+func requireUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	who := r.Header.Get(USER_HEADER)
+	if who == "" {
+		writeError(w, http.StatusUnauthorized, errors.New(USER_HEADER+" header is required"))
+		return "", false
+	}
+	return who, true
+}
+
+//Decode the JSON body, answering 400 when it does not fit the target
+func readBody(w http.ResponseWriter, r *http.Request, target interface{}) bool {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return false
+	}
+	if err := json.Unmarshal(body, target); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("invalid request body: "+err.Error()))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, output []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(output)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	output, _ := json.Marshal(map[string]string{"error": err.Error()})
+	writeJSON(w, status, output)
+}
+
+//Answer 400 with the validation messages of the chaincode as a list
+func writeValidationError(w http.ResponseWriter, msg string) {
+	messages := make([]string, 0)
+	for _, line := range strings.Split(msg, "\n") {
+		if line != "" {
+			messages = append(messages, line)
+		}
+	}
+	output, _ := json.Marshal(map[string]interface{}{"error": "validation failed", "messages": messages})
+	writeJSON(w, http.StatusBadRequest, output)
+}
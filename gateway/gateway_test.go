@@ -0,0 +1,126 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vajadhav/bp_upd/client"
+	"github.com/vajadhav/bp_upd/store"
+)
+
+const testUFA = `{"ufanumber":"U1","sellerName":"S1","buyerName":"B1","netCharge":"1000","chargTolrence":"10","billingFrequency":"MONTHLY","startDate":"2016-01-01","endDate":"2016-12-31"}`
+
+const testInvoices = `[{"invoiceNumber":"U1-C","billingPeriod":"2016-01","invoiceAmt":"100","approverBy":"B1"},` +
+	`{"invoiceNumber":"U1-V","billingPeriod":"2016-01","invoiceAmt":"100","approverBy":"B1"}]`
+
+//Server running the chaincode in process on an empty state
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	b, err := client.NewLocalBackend(store.NewMemStore())
+	if err != nil {
+		t.Fatalf("NewLocalBackend failed: %v", err)
+	}
+	return NewServer(b)
+}
+
+//Send the request as who, no user header when who is empty
+func request(s *Server, who string, method string, path string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if who != "" {
+		r.Header.Set(USER_HEADER, who)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestRoutes(t *testing.T) {
+	s := newTestServer(t)
+	tests := []struct {
+		name   string
+		who    string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"openapi", "", "GET", "/openapi.json", "", http.StatusOK},
+		{"no user", "", "GET", "/ufas", "", http.StatusUnauthorized},
+		{"unknown path", "S1", "GET", "/contracts", "", http.StatusNotFound},
+		{"unknown method", "S1", "DELETE", "/ufas/U1", "", http.StatusMethodNotAllowed},
+		{"create", "S1", "POST", "/ufas", testUFA, http.StatusCreated},
+		{"create again", "S1", "POST", "/ufas", testUFA, http.StatusConflict},
+		{"body not JSON", "S1", "POST", "/ufas", "{", http.StatusBadRequest},
+		{"no number", "S1", "POST", "/ufas", `{"sellerName":"S1"}`, http.StatusBadRequest},
+		{"invalid UFA", "S1", "POST", "/ufas", `{"ufanumber":"U2","sellerName":"S1"}`, http.StatusBadRequest},
+		{"read as buyer", "B1", "GET", "/ufas/U1", "", http.StatusOK},
+		{"read as outsider", "X1", "GET", "/ufas/U1", "", http.StatusForbidden},
+		{"read missing", "S1", "GET", "/ufas/U9", "", http.StatusNotFound},
+		{"update as outsider", "X1", "PATCH", "/ufas/U1", `{"note":"x"}`, http.StatusForbidden},
+		{"update as seller", "S1", "PATCH", "/ufas/U1", `{"note":"x"}`, http.StatusNoContent},
+		{"single invoice", "S1", "POST", "/ufas/U1/invoices", `[{"invoiceNumber":"U1-C"}]`, http.StatusBadRequest},
+		{"raise", "S1", "POST", "/ufas/U1/invoices", testInvoices, http.StatusCreated},
+		{"read invoice", "B1", "GET", "/invoices/U1-C", "", http.StatusOK},
+		{"approve", "B1", "POST", "/invoices/U1-C/approve", "", http.StatusOK},
+		{"approve again", "B1", "POST", "/invoices/U1-C/approve", "", http.StatusUnprocessableEntity},
+		{"approve missing", "B1", "POST", "/invoices/U1-X/approve", "", http.StatusNotFound},
+		{"list invoices", "S1", "GET", "/ufas/U1/invoices", "", http.StatusOK},
+	}
+	for _, test := range tests {
+		w := request(s, test.who, test.method, test.path, test.body)
+		if w.Code != test.status {
+			t.Fatalf("%s: %s %s answered %d, want %d: %s", test.name, test.method, test.path, w.Code, test.status, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); w.Code != http.StatusNoContent && ct != "application/json" {
+			t.Fatalf("%s: content type %q", test.name, ct)
+		}
+	}
+}
+
+func TestValidationMessages(t *testing.T) {
+	s := newTestServer(t)
+	w := request(s, "S1", "POST", "/ufas", `{"ufanumber":"U2","sellerName":"S1","buyerName":"B1"}`)
+	var answer struct {
+		Error    string   `json:"error"`
+		Messages []string `json:"messages"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &answer); err != nil {
+		t.Fatalf("answer %s: %v", w.Body.String(), err)
+	}
+	if w.Code != http.StatusBadRequest || answer.Error != "validation failed" || len(answer.Messages) == 0 {
+		t.Fatalf("invalid UFA answered %d %+v", w.Code, answer)
+	}
+	for _, msg := range answer.Messages {
+		if msg == "" || strings.Contains(msg, "\n") {
+			t.Fatalf("messages %q", answer.Messages)
+		}
+	}
+}
+
+func TestChaincodeErrorStatus(t *testing.T) {
+	tests := []struct {
+		msg    string
+		status int
+	}{
+		{"User is not authorized to read UFA U1", http.StatusForbidden},
+		{"UFA U1 already exists", http.StatusConflict},
+		{"Invalid UFA provided U1", http.StatusNotFound},
+		{"Invalid invoice provided U1-C", http.StatusNotFound},
+		{"Total invoice amount exceeded", http.StatusUnprocessableEntity},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		writeChaincodeError(w, errors.New(test.msg))
+		if w.Code != test.status {
+			t.Fatalf("%q answered %d, want %d", test.msg, w.Code, test.status)
+		}
+		var answer map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &answer); err != nil || answer["error"] != test.msg {
+			t.Fatalf("%q answered %s", test.msg, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package gateway
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+//Schemas referenced by the routes. UFAs and invoices are flat objects of
+//string fields, the listed properties are the ones the chaincode reads
+var schemas = map[string]interface{}{
+	"UFA": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"ufanumber":        stringSchema("UFA number"),
+			"netCharge":        stringSchema("Net charge of the agreement"),
+			"chargTolrence":    stringSchema("Charge tolerance in percent"),
+			"raisedInvTotal":   stringSchema("Total of the invoices raised so far"),
+			"currency":         stringSchema("Currency of the charges"),
+			"billingFrequency": stringSchema("Billing frequency"),
+		},
+		"additionalProperties": map[string]string{"type": "string"},
+	},
+	"Invoice": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"invoiceNumber": stringSchema("Invoice number"),
+			"ufanumber":     stringSchema("UFA the invoice is raised against"),
+			"invoiceAmt":    stringSchema("Invoice amount"),
+			"billingPeriod": stringSchema("Billing period covered"),
+			"raisedBy":      stringSchema("User who raised the invoice"),
+			"approverBy":    stringSchema("User who approves the invoice"),
+			"invoiceStatus": stringSchema("Status of the invoice"),
+		},
+		"required":             []string{"invoiceNumber"},
+		"additionalProperties": map[string]string{"type": "string"},
+	},
+	"InvoicePair": map[string]interface{}{
+		"description": "The customer invoice followed by the vendor invoice",
+		"type":        "array",
+		"items":       ref("Invoice"),
+		"minItems":    2,
+		"maxItems":    2,
+	},
+	"Violation": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"code":          stringSchema("Rule broken, such as CEILING_EXCEEDED"),
+			"message":       stringSchema("What is wrong"),
+			"invoiceNumber": stringSchema("Invoice breaking the rule"),
+			"billingPeriod": stringSchema("Billing period of the invoice"),
+		},
+	},
+	"Simulation": map[string]interface{}{
+		"description": "Effect of the invoice pairs without violations on the UFA",
+		"type":        "object",
+		"properties": map[string]interface{}{
+			"ufanumber":               stringSchema("UFA number"),
+			"netCharge":               numberSchema("Net charge of the agreement"),
+			"chargTolrence":           numberSchema("Charge tolerance in percent"),
+			"maxCharge":               numberSchema("Net charge with the tolerance"),
+			"raisedInvTotal":          numberSchema("Total of the invoices raised so far"),
+			"projectedRaisedInvTotal": numberSchema("Total once the invoices are raised"),
+			"headroom":                numberSchema("Amount left under the maximum charge"),
+			"toleranceUsed":           numberSchema("Share of the net charge invoiced beyond it, in percent"),
+			"coveredPeriods":          map[string]interface{}{"type": "array", "items": map[string]string{"type": "string"}},
+			"violations":              map[string]interface{}{"type": "array", "items": ref("Violation")},
+			"valid":                   map[string]string{"type": "boolean"},
+		},
+	},
+	"InvoicePairList": map[string]interface{}{
+		"type":  "array",
+		"items": ref("InvoicePair"),
+	},
+	"BatchReport": map[string]interface{}{
+		"description": "Outcome of each pair. With mode ALL_OR_NOTHING, the default, nothing is raised when a pair fails",
+		"type":        "object",
+		"properties": map[string]interface{}{
+			"mode":    stringSchema("ALL_OR_NOTHING or BEST_EFFORT"),
+			"created": map[string]string{"type": "integer"},
+			"failed":  map[string]string{"type": "integer"},
+			"results": map[string]interface{}{"type": "array", "items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"row":        map[string]string{"type": "integer"},
+					"ufanumber":  stringSchema("UFA of the pair"),
+					"status":     stringSchema("CREATED, FAILED or NOT_CREATED"),
+					"invoices":   map[string]interface{}{"type": "array", "items": map[string]string{"type": "string"}},
+					"violations": map[string]interface{}{"type": "array", "items": ref("Violation")},
+				},
+			}},
+		},
+	},
+	"UFAList": map[string]interface{}{
+		"type":  "array",
+		"items": ref("UFA"),
+	},
+	"InvoiceList": map[string]interface{}{
+		"type":  "array",
+		"items": ref("Invoice"),
+	},
+	"History": map[string]interface{}{
+		"description": "Payloads applied to the UFA, oldest first",
+		"type":        "array",
+		"items":       map[string]string{"type": "string"},
+	},
+	"Error": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"error":    stringSchema("What went wrong"),
+			"messages": map[string]interface{}{"type": "array", "items": map[string]string{"type": "string"}},
+		},
+	},
+}
+
+func stringSchema(description string) map[string]string {
+	return map[string]string{"type": "string", "description": description}
+}
+
+func numberSchema(description string) map[string]string {
+	return map[string]string{"type": "number", "description": description}
+}
+
+func ref(name string) map[string]string {
+	return map[string]string{"$ref": "#/components/schemas/" + name}
+}
+
+//OpenAPI returns the OpenAPI 3 document describing the resources served
+func (s *Server) OpenAPI() []byte {
+	errorResponse := map[string]interface{}{
+		"description": "Error",
+		"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": ref("Error")}},
+	}
+	paths := make(map[string]map[string]interface{})
+	for _, rt := range s.routes {
+		parameters := make([]interface{}, 0)
+		for _, part := range strings.Split(rt.pattern, "/") {
+			if strings.HasPrefix(part, "{") {
+				parameters = append(parameters, map[string]interface{}{
+					"name":     part[1 : len(part)-1],
+					"in":       "path",
+					"required": true,
+					"schema":   map[string]string{"type": "string"},
+				})
+			}
+		}
+		parameters = append(parameters, map[string]interface{}{
+			"name":        USER_HEADER,
+			"in":          "header",
+			"description": "User on whose behalf the call is made",
+			"required":    true,
+			"schema":      map[string]string{"type": "string"},
+		})
+
+		success := map[string]interface{}{"description": "Success"}
+		if rt.response != "" {
+			success["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": ref(rt.response)}}
+		}
+		successStatus := "200"
+		if rt.method == "POST" && strings.HasPrefix(rt.function, "create") {
+			successStatus = "201"
+		} else if rt.response == "" {
+			successStatus = "204"
+		}
+		operation := map[string]interface{}{
+			"operationId": rt.function,
+			"summary":     rt.summary,
+			"parameters":  parameters,
+			"responses": map[string]interface{}{
+				successStatus: success,
+				"default":     errorResponse,
+			},
+		}
+		if rt.body != "" {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": ref(rt.body)}},
+			}
+		}
+		if paths[rt.pattern] == nil {
+			paths[rt.pattern] = make(map[string]interface{})
+		}
+		paths[rt.pattern][strings.ToLower(rt.method)] = operation
+	}
+
+	document := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]string{
+			"title":   "UFA gateway",
+			"version": "1.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+	outputBytes, _ := json.MarshalIndent(document, "", "  ")
+	return outputBytes
+}
@@ -0,0 +1,98 @@
+package scenario
+
+import (
+	"errors"
+	"time"
+
+	"github.com/vajadhav/bp_upd/store"
+	"github.com/vajadhav/bp_upd/ufa"
+)
+
+//MemLedger runs the UFA rules in process against a store.MemStore. As on
+//a peer, the writes of a call are applied when it succeeds and its reads
+//do not see them, and the submitter and transaction time come from the
+//ledger rather than the arguments
+type MemLedger struct {
+	state *store.MemStore
+	//Writes of the running call, a nil value deletes the key
+	writes map[string][]byte
+	who    string
+	now    time.Time
+}
+
+//NewMemLedger returns an empty ledger. It is initialized by the scenario
+func NewMemLedger() *MemLedger {
+	return &MemLedger{state: store.NewMemStore(), writes: make(map[string][]byte)}
+}
+
+//GetState returns the value stored for the key, or nil when there is none
+func (l *MemLedger) GetState(key string) ([]byte, error) {
+	return l.state.GetState(key)
+}
+
+//PutState keeps the value until the call succeeds
+func (l *MemLedger) PutState(key string, value []byte) error {
+	if value == nil {
+		return errors.New("PutState needs a value for " + key)
+	}
+	l.writes[key] = append([]byte(nil), value...)
+	return nil
+}
+
+//DelState removes the key when the call succeeds
+func (l *MemLedger) DelState(key string) error {
+	l.writes[key] = nil
+	return nil
+}
+
+//CallerID returns the user running the call
+func (l *MemLedger) CallerID() (string, error) {
+	if l.who == "" {
+		return "", errors.New("the call has no submitter")
+	}
+	return l.who, nil
+}
+
+//TxTime returns the date set by the scenario
+func (l *MemLedger) TxTime() (time.Time, error) {
+	if l.now.IsZero() {
+		return time.Time{}, errors.New("the scenario has not set the date")
+	}
+	return l.now, nil
+}
+
+//SetTime sets the time of the calls which follow
+func (l *MemLedger) SetTime(now time.Time) {
+	l.now = now
+}
+
+//Init prepares the ledger like the chaincode Init
+func (l *MemLedger) Init(args []string) error {
+	l.who = ""
+	_, err := ufa.InitLedger(l, args)
+	return l.finish(err)
+}
+
+//Call runs the function as submitted by who
+func (l *MemLedger) Call(who string, function string, args []string) ([]byte, error) {
+	l.who = who
+	output, err := ufa.Call(l, function, args)
+	return output, l.finish(err)
+}
+
+//Apply the writes of a call which succeeded and drop them otherwise
+func (l *MemLedger) finish(err error) error {
+	writes := l.writes
+	l.writes = make(map[string][]byte)
+	if err != nil {
+		return err
+	}
+	for key, value := range writes {
+		if value == nil {
+			l.state.DelState(key)
+		} else {
+			l.state.PutState(key, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+//Package scenario runs UFA scenarios written as plain text features
+//against a ledger. A feature reads like Gherkin:
+//
+//	Feature: Tolerance cap
+//	  Background:
+//	    Given the ledger is initialized
+//	    And the date is 2016-06-15
+//
+//	  Scenario: Invoices stop at the ceiling
+//	    When Org1MSP/S1 calls createNewInvoices with Org1MSP/S1
+//	      """
+//	      [{"invoiceNumber":"C1", ...}, {"invoiceNumber":"V1", ...}]
+//	      """
+//	    Then it succeeds
+//	    And the state of U1 field raisedInvTotal is 1100
+//
+//Each scenario runs against its own ledger, after the background steps.
+//Given, When, Then, And and But are interchangeable; the steps are listed
+//in steps.go. Lines starting with # or @ are ignored
+package scenario
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Ledger is what the scenarios run against: the chaincode functions run
+//as a user, and the state they leave
+type Ledger interface {
+	//Init runs the chaincode Init with the arguments
+	Init(args []string) error
+	//Call runs a function as submitted by who
+	Call(who string, function string, args []string) ([]byte, error)
+	//GetState returns the value stored for the key, nil when there is none
+	GetState(key string) ([]byte, error)
+	//SetTime sets the time of the transactions which follow
+	SetTime(now time.Time)
+}
+
+//Step is one line of a scenario, with the doc string following it
+type Step struct {
+	Keyword   string
+	Text      string
+	DocString string
+	Line      int
+}
+
+//Scenario is a named list of steps
+type Scenario struct {
+	Name  string
+	Line  int
+	Steps []Step
+}
+
+//Feature is a file of scenarios sharing the background steps
+type Feature struct {
+	Name       string
+	Path       string
+	Background []Step
+	Scenarios  []Scenario
+}
+
+//Step keywords
+var keywords = []string{"Given", "When", "Then", "And", "But"}
+
+//Delimiter of the doc strings
+const docStringDelimiter = `"""`
+
+//ParseFile reads the feature in the file
+func ParseFile(path string) (*Feature, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Parse(path, file)
+}
+
+//ParseGlob reads the features in the files matching the pattern, in the
+//order of their names
+func ParseGlob(pattern string) ([]*Feature, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	features := make([]*Feature, 0, len(paths))
+	for _, path := range paths {
+		feature, err := ParseFile(path)
+		if err != nil {
+			return nil, err
+		}
+		features = append(features, feature)
+	}
+	return features, nil
+}
+
+//Parse reads a feature. path names it in the errors
+func Parse(path string, r io.Reader) (*Feature, error) {
+	feature := &Feature{Path: path}
+	//Steps of the background or scenario being read, nil before either
+	var steps *[]Step
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		rawLine := scanner.Text()
+		line := strings.TrimSpace(rawLine)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "@"):
+			continue
+		case strings.HasPrefix(line, "Feature:"):
+			if feature.Name != "" {
+				return nil, lineError(path, lineNumber, "a file holds a single feature")
+			}
+			feature.Name = strings.TrimSpace(strings.TrimPrefix(line, "Feature:"))
+			continue
+		case line == "Background:":
+			if len(feature.Scenarios) > 0 || steps != nil {
+				return nil, lineError(path, lineNumber, "the background should come before the scenarios")
+			}
+			steps = &feature.Background
+			continue
+		case strings.HasPrefix(line, "Scenario:"):
+			feature.Scenarios = append(feature.Scenarios, Scenario{
+				Name: strings.TrimSpace(strings.TrimPrefix(line, "Scenario:")),
+				Line: lineNumber,
+			})
+			steps = &feature.Scenarios[len(feature.Scenarios)-1].Steps
+			continue
+		case line == docStringDelimiter:
+			if steps == nil || len(*steps) == 0 || (*steps)[len(*steps)-1].DocString != "" {
+				return nil, lineError(path, lineNumber, "a doc string should follow a step")
+			}
+			indent := len(rawLine) - len(strings.TrimLeft(rawLine, " \t"))
+			docString, read, err := readDocString(scanner, indent)
+			lineNumber += read
+			if err != nil {
+				return nil, lineError(path, lineNumber, err.Error())
+			}
+			(*steps)[len(*steps)-1].DocString = docString
+			continue
+		}
+
+		keyword, text := splitKeyword(line)
+		if keyword == "" {
+			//Free text describing the feature or scenario
+			if steps == nil || len(*steps) == 0 {
+				continue
+			}
+			return nil, lineError(path, lineNumber, "expected a step, found "+strconv.Quote(line))
+		}
+		if steps == nil {
+			return nil, lineError(path, lineNumber, "steps should be in a background or a scenario")
+		}
+		*steps = append(*steps, Step{Keyword: keyword, Text: text, Line: lineNumber})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if feature.Name == "" {
+		return nil, errors.New(path + ": no feature found")
+	}
+	return feature, nil
+}
+
+//Split the keyword off a step, an empty keyword when the line is not one
+func splitKeyword(line string) (string, string) {
+	for _, keyword := range keywords {
+		if strings.HasPrefix(line, keyword+" ") {
+			return keyword, strings.TrimSpace(line[len(keyword):])
+		}
+	}
+	return "", line
+}
+
+//Read the lines of a doc string up to the closing delimiter, removing the
+//indentation of the opening one. Returns the doc string and the number of
+//lines read
+func readDocString(scanner *bufio.Scanner, indent int) (string, int, error) {
+	var lines []string
+	read := 0
+	for scanner.Scan() {
+		read++
+		rawLine := scanner.Text()
+		if strings.TrimSpace(rawLine) == docStringDelimiter {
+			return strings.Join(lines, "\n"), read, nil
+		}
+		trimmed := strings.TrimLeft(rawLine, " \t")
+		if margin := len(rawLine) - len(trimmed); margin < indent {
+			rawLine = trimmed
+		} else {
+			rawLine = rawLine[indent:]
+		}
+		lines = append(lines, rawLine)
+	}
+	return "", read, errors.New("the doc string is not closed")
+}
+
+//Returns an error located at the line of the file
+func lineError(path string, line int, message string) error {
+	return errors.New(path + ":" + strconv.Itoa(line) + ": " + message)
+}
+
+//Run runs the background steps and then the scenario against the ledger.
+//The first step failing ends the run, the error names its line. A call
+//failing must be followed by a step expecting the failure
+func (f *Feature) Run(scenario Scenario, ledger Ledger) error {
+	run := &run{ledger: ledger}
+	for _, step := range append(append([]Step(nil), f.Background...), scenario.Steps...) {
+		if err := run.step(step); err != nil {
+			return lineError(f.Path, step.Line, step.Keyword+" "+step.Text+": "+err.Error())
+		}
+	}
+	if run.err != nil {
+		return lineError(f.Path, run.callLine, "unexpected failure: "+run.err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package scenario
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vajadhav/bp_upd/ufa"
+)
+
+type quietLogger struct{}
+
+func (quietLogger) Info(args ...interface{}) {}
+
+func TestFeatures(t *testing.T) {
+	ufa.SetLogger(quietLogger{})
+	features, err := ParseGlob("testdata/*.feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(features) == 0 {
+		t.Fatal("no features in testdata")
+	}
+	for _, feature := range features {
+		for _, scenario := range feature.Scenarios {
+			feature, scenario := feature, scenario
+			t.Run(feature.Name+"/"+scenario.Name, func(t *testing.T) {
+				if err := feature.Run(scenario, NewMemLedger()); err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		text    string
+		message string
+	}{
+		{"Scenario: none\n  Given the ledger is initialized\n", "no feature found"},
+		{"Feature: f\n  Given the ledger is initialized\n", "x.feature:2: steps should be in a background or a scenario"},
+		{"Feature: f\nScenario: s\n  Given the ledger is initialized\n  just text\n", "x.feature:4: expected a step"},
+		{"Feature: f\nScenario: s\n  \"\"\"\n  {}\n  \"\"\"\n", "x.feature:3: a doc string should follow a step"},
+		{"Feature: f\nScenario: s\n  When S1 calls probe\n  \"\"\"\n  {}\n", "x.feature:5: the doc string is not closed"},
+		{"Feature: f\nScenario: s\nBackground:\n", "x.feature:3: the background should come before the scenarios"},
+		{"Feature: f\nFeature: g\n", "x.feature:2: a file holds a single feature"},
+	}
+	for _, test := range tests {
+		if _, err := Parse("x.feature", strings.NewReader(test.text)); err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("Parse(%q) = %v, want %q", test.text, err, test.message)
+		}
+	}
+}
+
+func TestParseDocString(t *testing.T) {
+	text := "Feature: f\n  About f\n\n  # comment\n  @tag\n  Scenario: s\n    About s\n    When S1 calls createUFA with U1 | \"a | b\" | \"\"\n      \"\"\"\n      {\n        \"a\": 1\n      }\n      \"\"\"\n"
+	feature, err := Parse("x.feature", strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := feature.Scenarios[0].Steps[0]
+	if step.Keyword != "When" || step.Line != 8 || step.DocString != "{\n  \"a\": 1\n}" {
+		t.Fatalf("parsed %+v", step)
+	}
+	if len(step.Text) == 0 {
+		t.Fatal("step without text")
+	}
+	args := splitArgs(`U1 | "a | b" | "" | "say \"hi\""`)
+	if len(args) != 4 || args[0] != "U1" || args[1] != "a | b" || args[2] != "" || args[3] != `say "hi"` {
+		t.Fatalf("splitArgs returned %q", args)
+	}
+}
+
+//A failing step is reported with its line and what went wrong
+func TestFailures(t *testing.T) {
+	ufa.SetLogger(quietLogger{})
+	tests := []struct {
+		steps   string
+		message string
+	}{
+		{"When S1 calls probe\nThen it fails with \"x\"", "x.feature:4: Then it fails with \"x\": probe succeeded"},
+		{"When S1 calls nothing\nThen it succeeds", "x.feature:4: Then it succeeds: nothing failed: Received unknown"},
+		{"When S1 calls nothing", "x.feature:3: unexpected failure: Received unknown"},
+		{"When ADMIN calls getConfig with ADMIN\nThen the result field maxTolerance is 20", `maxTolerance is "10", expected "20"`},
+		{"When ADMIN calls getConfig with ADMIN\nThen the result field none is 1", "no field none"},
+		{"When S1 calls getAllUFA with S1\nThen the result has 2 items", "found 0 items"},
+		{"Then the state of ALL_RECS field a is 1", "no item a of a in []"},
+		{"When S1 calls probe\nThen the result field a is 1", "no field a"},
+		{"Then the state of U1 has 0 items", "the state holds nothing for U1"},
+		{"Then the state of CONFIG is absent", "the state holds"},
+		{"Then it succeeds", "no function was called"},
+		{"Given the date is June", "the date should be"},
+		{"Then it rains", "x.feature:3: Then it rains: unknown step"},
+	}
+	for _, test := range tests {
+		feature, err := Parse("x.feature", strings.NewReader("Feature: f\nScenario: s\n"+test.steps+"\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ledger := NewMemLedger()
+		if err := ledger.Init(nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := feature.Run(feature.Scenarios[0], ledger); err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%q failed with %v, want %q", test.steps, err, test.message)
+		}
+	}
+}
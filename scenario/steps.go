@@ -0,0 +1,272 @@
+package scenario
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//NOBODY Name of the user in a call step submitting without an identity
+const NOBODY = "nobody"
+
+//State of a scenario being run: the result of the last call
+type run struct {
+	ledger Ledger
+	called bool
+	//Function and line of the last call, and what it returned
+	callName string
+	callLine int
+	result   []byte
+	err      error
+}
+
+//A step definition: the pattern matching the step text and what it does.
+//expectsFailure marks the steps which handle a failed call
+type stepDefinition struct {
+	pattern        *regexp.Regexp
+	expectsFailure bool
+	do             func(r *run, match []string, step Step) error
+}
+
+//Steps a scenario can use
+var stepDefinitions = []stepDefinition{
+	//Runs the chaincode Init, with the configuration in the doc string
+	{pattern: regexp.MustCompile(`^the ledger is initialized$`), do: func(r *run, match []string, step Step) error {
+		var args []string
+		if step.DocString != "" {
+			args = append(args, step.DocString)
+		}
+		return r.ledger.Init(args)
+	}},
+	//Sets the transaction time, as YYYY-MM-DD or RFC 3339
+	{pattern: regexp.MustCompile(`^the date is (\S+)$`), do: func(r *run, match []string, step Step) error {
+		now, err := time.Parse("2006-01-02", match[1])
+		if err != nil {
+			if now, err = time.Parse(time.RFC3339, match[1]); err != nil {
+				return errors.New("the date should be YYYY-MM-DD or RFC 3339")
+			}
+		}
+		r.ledger.SetTime(now.UTC())
+		return nil
+	}},
+	//Calls a function. The arguments are separated by |, "" is an empty
+	//argument and the doc string is passed as the last one
+	{pattern: regexp.MustCompile(`^(\S+) calls (\S+)(?: with (.+))?$`), do: func(r *run, match []string, step Step) error {
+		who := match[1]
+		if who == NOBODY {
+			who = ""
+		}
+		args := splitArgs(match[3])
+		if step.DocString != "" {
+			args = append(args, step.DocString)
+		}
+		r.called, r.callName, r.callLine = true, match[2], step.Line
+		r.result, r.err = r.ledger.Call(who, match[2], args)
+		return nil
+	}},
+	{pattern: regexp.MustCompile(`^it succeeds$`), do: func(r *run, match []string, step Step) error {
+		return r.requireCall()
+	}},
+	{pattern: regexp.MustCompile(`^it fails with "(.*)"$`), expectsFailure: true, do: func(r *run, match []string, step Step) error {
+		if err := r.requireCall(); err != nil {
+			return err
+		}
+		if r.err == nil {
+			return errors.New(r.callName + " succeeded")
+		}
+		message := r.err.Error()
+		r.err = nil
+		if !strings.Contains(message, match[1]) {
+			return errors.New(r.callName + " failed with " + strconv.Quote(message))
+		}
+		return nil
+	}},
+	{pattern: regexp.MustCompile(`^the result is$`), do: func(r *run, match []string, step Step) error {
+		if err := r.requireCall(); err != nil {
+			return err
+		}
+		return sameJSON(r.result, []byte(step.DocString))
+	}},
+	{pattern: regexp.MustCompile(`^the result has (\d+) items?$`), do: func(r *run, match []string, step Step) error {
+		if err := r.requireCall(); err != nil {
+			return err
+		}
+		return hasItems(r.result, match[1])
+	}},
+	{pattern: regexp.MustCompile(`^the result field (\S+) is (.*)$`), do: func(r *run, match []string, step Step) error {
+		if err := r.requireCall(); err != nil {
+			return err
+		}
+		return fieldIs(r.result, match[1], match[2])
+	}},
+	{pattern: regexp.MustCompile(`^the state of (\S+) is absent$`), do: func(r *run, match []string, step Step) error {
+		value, err := r.ledger.GetState(match[1])
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			return errors.New("the state holds " + string(value))
+		}
+		return nil
+	}},
+	{pattern: regexp.MustCompile(`^the state of (\S+) has (\d+) items?$`), do: func(r *run, match []string, step Step) error {
+		value, err := r.state(match[1])
+		if err != nil {
+			return err
+		}
+		return hasItems(value, match[2])
+	}},
+	{pattern: regexp.MustCompile(`^the state of (\S+) field (\S+) is (.*)$`), do: func(r *run, match []string, step Step) error {
+		value, err := r.state(match[1])
+		if err != nil {
+			return err
+		}
+		return fieldIs(value, match[2], match[3])
+	}},
+}
+
+//Run the step. A call which failed must be followed by a step expecting
+//the failure
+func (r *run) step(step Step) error {
+	for _, definition := range stepDefinitions {
+		match := definition.pattern.FindStringSubmatch(step.Text)
+		if match == nil {
+			continue
+		}
+		if r.err != nil && !definition.expectsFailure {
+			return errors.New(r.callName + " failed: " + r.err.Error())
+		}
+		return definition.do(r, match, step)
+	}
+	return errors.New("unknown step")
+}
+
+//Fails unless a function was called
+func (r *run) requireCall() error {
+	if !r.called {
+		return errors.New("no function was called")
+	}
+	return nil
+}
+
+//Returns the value stored for the key, an error when there is none
+func (r *run) state(key string) ([]byte, error) {
+	value, err := r.ledger.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, errors.New("the state holds nothing for " + key)
+	}
+	return value, nil
+}
+
+//Split the arguments of a call step on the | outside double quotes
+func splitArgs(text string) []string {
+	if text == "" {
+		return nil
+	}
+	var args []string
+	start, quoted := 0, false
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '\\' && quoted:
+			i++
+		case text[i] == '"':
+			quoted = !quoted
+		case text[i] == '|' && !quoted:
+			args = append(args, unquote(strings.TrimSpace(text[start:i])))
+			start = i + 1
+		}
+	}
+	return append(args, unquote(strings.TrimSpace(text[start:])))
+}
+
+//Remove the double quotes around a value
+func unquote(value string) string {
+	if unquoted, err := strconv.Unquote(value); err == nil && strings.HasPrefix(value, `"`) {
+		return unquoted
+	}
+	return value
+}
+
+//Decode JSON keeping the numbers as written
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, errors.New("not JSON: " + string(data))
+	}
+	return value, nil
+}
+
+//Fails unless the JSON is an array of the given length
+func hasItems(data []byte, count string) error {
+	value, err := decodeJSON(data)
+	if err != nil {
+		return err
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return errors.New("not an array: " + string(data))
+	}
+	if strconv.Itoa(len(items)) != count {
+		return errors.New("found " + strconv.Itoa(len(items)) + " items in " + string(data))
+	}
+	return nil
+}
+
+//Fails unless the field of the JSON reads as the expected text. The path
+//separates the object keys and the array indexes with dots. Strings are
+//compared without their quotes, other values as JSON
+func fieldIs(data []byte, path string, expected string) error {
+	value, err := decodeJSON(data)
+	if err != nil {
+		return err
+	}
+	for _, part := range strings.Split(path, ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			field, ok := node[part]
+			if !ok {
+				return errors.New("no field " + path + " in " + string(data))
+			}
+			value = field
+		case []interface{}:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(node) {
+				return errors.New("no item " + part + " of " + path + " in " + string(data))
+			}
+			value = node[index]
+		default:
+			return errors.New("no field " + path + " in " + string(data))
+		}
+	}
+	actual, ok := value.(string)
+	if !ok {
+		valueBytes, _ := json.Marshal(value)
+		actual = string(valueBytes)
+	}
+	if expected = unquote(expected); actual != expected {
+		return errors.New(path + " is " + strconv.Quote(actual) + ", expected " + strconv.Quote(expected))
+	}
+	return nil
+}
+
+//Fails unless both hold the same JSON value
+func sameJSON(actual []byte, expected []byte) error {
+	var actualValue, expectedValue interface{}
+	if err := json.Unmarshal(expected, &expectedValue); err != nil {
+		return errors.New("the expected result is not JSON")
+	}
+	if err := json.Unmarshal(actual, &actualValue); err != nil || !reflect.DeepEqual(actualValue, expectedValue) {
+		return errors.New("the result is " + string(actual))
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+Feature: UFA lifecycle
+  A UFA is created, invoiced over several billing periods, updated and
+  read back by its parties. Users are named MSPID/name, as the chaincode
+  names the submitters on a peer
+
+  Background:
+    Given the ledger is initialized
+    And the date is 2016-06-15
+    And Org1MSP/S1 calls createUFA with U1 | Org1MSP/S1
+      """
+      {"ufanumber":"U1","sellerName":"Org1MSP/S1","buyerName":"Org2MSP/B1","netCharge":"1000","chargTolrence":"10",
+       "billingPeriod":"MONTHLY","startDate":"2016-01-01","endDate":"2016-12-31"}
+      """
+
+  Scenario: Invoices over three months
+    When Org1MSP/S1 calls createNewInvoices with Org1MSP/S1
+      """
+      [{"invoiceNumber":"C1","ufanumber":"U1","billingPeriod":"2016-01","invoiceAmt":"300","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"},
+       {"invoiceNumber":"V1","ufanumber":"U1","billingPeriod":"2016-01","invoiceAmt":"300","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"}]
+      """
+    And Org1MSP/S1 calls createNewInvoices with Org1MSP/S1
+      """
+      [{"invoiceNumber":"C2","ufanumber":"U1","billingPeriod":"2016-02","invoiceAmt":"250.50","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"},
+       {"invoiceNumber":"V2","ufanumber":"U1","billingPeriod":"2016-02","invoiceAmt":"250.50","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"}]
+      """
+    And Org1MSP/S1 calls createNewInvoices with Org1MSP/S1
+      """
+      [{"invoiceNumber":"C3","ufanumber":"U1","billingPeriod":"2016-03","invoiceAmt":"199.50","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"},
+       {"invoiceNumber":"V3","ufanumber":"U1","billingPeriod":"2016-03","invoiceAmt":"199.50","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"}]
+      """
+    Then it succeeds
+    And the state of U1 field raisedInvTotal is 750
+    And the state of ALL_INVOICES has 6 items
+    When Org2MSP/B1 calls getInvoices with U1 | Org2MSP/B1
+    Then the result has 6 items
+    And the result field 2.invoiceNumber is C2
+    And the result field 2.invoiceAmt is 250.50
+
+  Scenario: A billing period is invoiced once
+    When Org1MSP/S1 calls createNewInvoices with Org1MSP/S1
+      """
+      [{"invoiceNumber":"C1","ufanumber":"U1","billingPeriod":"2016-01","invoiceAmt":"300","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"},
+       {"invoiceNumber":"V1","ufanumber":"U1","billingPeriod":"2016-01","invoiceAmt":"300","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"}]
+      """
+    And Org1MSP/S1 calls createNewInvoices with Org1MSP/S1
+      """
+      [{"invoiceNumber":"C2","ufanumber":"U1","billingPeriod":"2016-01","invoiceAmt":"100","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"},
+       {"invoiceNumber":"V2","ufanumber":"U1","billingPeriod":"2016-01","invoiceAmt":"100","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"}]
+      """
+    Then it fails with "Invoices are already raised for 2016-01"
+    And the state of U1 field raisedInvTotal is 300
+
+  Scenario: The buyer approves an invoice
+    When Org1MSP/S1 calls createNewInvoices with Org1MSP/S1
+      """
+      [{"invoiceNumber":"C1","ufanumber":"U1","billingPeriod":"2016-01","invoiceAmt":"300","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"},
+       {"invoiceNumber":"V1","ufanumber":"U1","billingPeriod":"2016-01","invoiceAmt":"300","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"}]
+      """
+    And Org1MSP/S1 calls approveInvoice with Org1MSP/S1 | C1
+    Then it fails with "not authorized"
+    When Org2MSP/B1 calls approveInvoice with Org2MSP/B1 | C1
+    Then it succeeds
+    When Org1MSP/S1 calls getInvoiceDetails with C1 | Org1MSP/S1
+    Then the result field invoiceStatus is APPROVED
+
+  Scenario: Updates are validated and recorded
+    When Org2MSP/B1 calls updateUFA with U1 | Org2MSP/B1 | {"netCharge":"2000"}
+    Then it succeeds
+    And the state of U1 field netCharge is 2000
+    When Org1MSP/S1 calls updateUFA with U1 | Org1MSP/S1 | {"raisedInvTotal":"5"}
+    Then it fails with "raisedInvTotal"
+    When Org3MSP/X1 calls updateUFA with U1 | Org3MSP/X1 | {"netCharge":"1"}
+    Then it fails with "not authorized"
+    When Org1MSP/S1 calls getUFAHistory with U1 | Org1MSP/S1
+    Then the result has 2 items
+
+  Scenario: Only the parties read the UFA
+    When Org2MSP/B1 calls getUFADetails with U1 | Org2MSP/B1
+    Then the result field sellerName is Org1MSP/S1
+    And the result field ufaStatus is ACTIVE
+    When Org3MSP/X1 calls getUFADetails with U1 | Org3MSP/X1
+    Then it fails with "not authorized to read UFA U1"
+    When Org3MSP/S1 calls getUFADetails with U1 | Org1MSP/S1
+    Then it fails with "not authorized to read UFA U1"
+    When nobody calls getUFADetails with U1 | Org1MSP/S1
+    Then it fails with "not authorized to read UFA U1"
+    When Org2MSP/B1 calls getAllUFA with Org2MSP/B1
+    Then the result has 1 item
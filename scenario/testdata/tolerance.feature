@@ -0,0 +1,61 @@
+Feature: Tolerance cap
+  The invoices of a UFA may total its net charge plus the tolerance, and
+  not a cent more
+
+  Background:
+    Given the ledger is initialized
+    And the date is 2016-06-15
+    And Org1MSP/S1 calls createUFA with U1 | Org1MSP/S1
+      """
+      {"ufanumber":"U1","sellerName":"Org1MSP/S1","buyerName":"Org2MSP/B1","netCharge":"1000","chargTolrence":"10",
+       "billingPeriod":"MONTHLY","startDate":"2016-01-01","endDate":"2016-12-31"}
+      """
+
+  Scenario: Invoices reach the ceiling exactly
+    When Org1MSP/S1 calls createNewInvoices with Org1MSP/S1
+      """
+      [{"invoiceNumber":"C1","ufanumber":"U1","billingPeriod":"2016-01","invoiceAmt":"600","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"},
+       {"invoiceNumber":"V1","ufanumber":"U1","billingPeriod":"2016-01","invoiceAmt":"600","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"}]
+      """
+    Then it succeeds
+    When Org1MSP/S1 calls createNewInvoices with Org1MSP/S1
+      """
+      [{"invoiceNumber":"C2","ufanumber":"U1","billingPeriod":"2016-02","invoiceAmt":"500","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"},
+       {"invoiceNumber":"V2","ufanumber":"U1","billingPeriod":"2016-02","invoiceAmt":"500","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"}]
+      """
+    Then it succeeds
+    And the state of U1 field raisedInvTotal is 1100
+
+  Scenario: A cent over the ceiling is refused
+    When Org1MSP/S1 calls createNewInvoices with Org1MSP/S1
+      """
+      [{"invoiceNumber":"C1","ufanumber":"U1","billingPeriod":"2016-01","invoiceAmt":"1100.01","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"},
+       {"invoiceNumber":"V1","ufanumber":"U1","billingPeriod":"2016-01","invoiceAmt":"1100.01","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"}]
+      """
+    Then it fails with "Total invoice amount exceeded"
+    And the state of U1 field raisedInvTotal is 0
+    And the state of C1 is absent
+
+  Scenario: The simulation reports the headroom
+    When Org2MSP/B1 calls simulateInvoices with Org2MSP/B1
+      """
+      [{"invoiceNumber":"C1","ufanumber":"U1","billingPeriod":"2016-01","invoiceAmt":"700","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"},
+       {"invoiceNumber":"V1","ufanumber":"U1","billingPeriod":"2016-01","invoiceAmt":"700","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"},
+       {"invoiceNumber":"C2","ufanumber":"U1","billingPeriod":"2016-02","invoiceAmt":"401","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"},
+       {"invoiceNumber":"V2","ufanumber":"U1","billingPeriod":"2016-02","invoiceAmt":"401","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"}]
+      """
+    Then the result field valid is false
+    And the result field maxCharge is 1100
+    And the result field projectedRaisedInvTotal is 700
+    And the result field violations.0.code is CEILING_EXCEEDED
+    And the result field violations.0.invoiceNumber is C2
+
+  Scenario: A narrower tolerance lowers the ceiling
+    When Org1MSP/S1 calls updateUFA with U1 | Org1MSP/S1 | {"chargTolrence":"0"}
+    Then it succeeds
+    When Org1MSP/S1 calls createNewInvoices with Org1MSP/S1
+      """
+      [{"invoiceNumber":"C1","ufanumber":"U1","billingPeriod":"2016-01","invoiceAmt":"1000.01","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"},
+       {"invoiceNumber":"V1","ufanumber":"U1","billingPeriod":"2016-01","invoiceAmt":"1000.01","raisedBy":"Org1MSP/S1","approverBy":"Org2MSP/B1"}]
+      """
+    Then it fails with "Total invoice amount exceeded"
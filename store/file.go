@@ -0,0 +1,103 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+//FileStore is an in-memory store that is written to a local JSON file,
+//so the state survives between runs. As on a peer, the writes of a call
+//are buffered and its reads do not see them; Finish applies them and
+//rewrites the file once. Calls are not safe to run concurrently
+type FileStore struct {
+	*MemStore
+	path string
+	//Writes of the running call, a nil value deletes the key
+	writes map[string][]byte
+}
+
+//OpenFileStore loads the state kept in path. A missing file gives an
+//empty store that is created on the first write
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{MemStore: NewMemStore(), path: path, writes: make(map[string][]byte)}
+	fileBytes, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state map[string]string
+	if err := json.Unmarshal(fileBytes, &state); err != nil {
+		return nil, errors.New("Failed to unmarshal state file " + path)
+	}
+	for key, value := range state {
+		s.MemStore.state[key] = []byte(value)
+	}
+	return s, nil
+}
+
+//PutState keeps the value until the call finishes
+func (s *FileStore) PutState(key string, value []byte) error {
+	if value == nil {
+		return errors.New("PutState needs a value for " + key)
+	}
+	s.writes[key] = append([]byte(nil), value...)
+	return nil
+}
+
+//DelState removes the key when the call finishes
+func (s *FileStore) DelState(key string) error {
+	s.writes[key] = nil
+	return nil
+}
+
+//Finish ends a call. The writes of a call which succeeded (err is nil) are
+//saved to the file in one go and then applied, those of a call which
+//failed are dropped. It returns err, or the error of saving the file
+func (s *FileStore) Finish(err error) error {
+	writes := s.writes
+	s.writes = make(map[string][]byte)
+	if err != nil || len(writes) == 0 {
+		return err
+	}
+
+	s.mu.RLock()
+	state := make(map[string]string, len(s.state)+len(writes))
+	for key, value := range s.state {
+		state[key] = string(value)
+	}
+	s.mu.RUnlock()
+	for key, value := range writes {
+		if value == nil {
+			delete(state, key)
+		} else {
+			state[key] = string(value)
+		}
+	}
+	if err := s.save(state); err != nil {
+		return err
+	}
+
+	for key, value := range writes {
+		if value == nil {
+			s.MemStore.DelState(key)
+		} else {
+			s.MemStore.PutState(key, value)
+		}
+	}
+	return nil
+}
+
+//Write the state to a temporary file and move it over the old one, so an
+//interrupted write leaves the previous state in place
+func (s *FileStore) save(state map[string]string) error {
+	fileBytes, _ := json.MarshalIndent(state, "", "  ")
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, fileBytes, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func mustGet(t *testing.T, s *FileStore, key string) string {
+	t.Helper()
+	value, err := s.GetState(key)
+	if err != nil {
+		t.Fatalf("GetState(%s) failed: %v", key, err)
+	}
+	return string(value)
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore on a missing file failed: %v", err)
+	}
+
+	//The writes of a call are not seen nor saved before it finishes
+	s.PutState("A", []byte("1"))
+	s.PutState("B", []byte("2"))
+	if got := mustGet(t, s, "A"); got != "" {
+		t.Fatalf("unfinished write read back as %q", got)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("state file written before the call finished: %v", err)
+	}
+	if err := s.Finish(nil); err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	if got := mustGet(t, s, "A"); got != "1" {
+		t.Fatalf("A read back as %q", got)
+	}
+
+	//A failed call leaves the state and the file unchanged
+	s.PutState("A", []byte("changed"))
+	s.DelState("B")
+	failure := errors.New("rejected")
+	if err := s.Finish(failure); err != failure {
+		t.Fatalf("Finish returned %v, want the error of the call", err)
+	}
+	if got := mustGet(t, s, "A"); got != "1" {
+		t.Fatalf("A read back as %q after a failed call", got)
+	}
+
+	s.DelState("B")
+	if err := s.Finish(nil); err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary file left behind: %v", err)
+	}
+
+	//The saved state is loaded by the next run
+	reopened, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	if got := mustGet(t, reopened, "A"); got != "1" {
+		t.Fatalf("A reloaded as %q", got)
+	}
+	if got := mustGet(t, reopened, "B"); got != "" {
+		t.Fatalf("deleted B reloaded as %q", got)
+	}
+	if err := reopened.PutState("C", nil); err == nil {
+		t.Fatal("PutState accepted a nil value")
+	}
+}
+
+func TestFileStoreErrors(t *testing.T) {
+	dir := t.TempDir()
+	corrupt := filepath.Join(dir, "corrupt.json")
+	os.WriteFile(corrupt, []byte("not json"), 0644)
+	if _, err := OpenFileStore(corrupt); err == nil {
+		t.Fatal("OpenFileStore accepted a corrupt state file")
+	}
+
+	//A call whose state cannot be saved is not applied
+	s, err := OpenFileStore(filepath.Join(dir, "missing", "state.json"))
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	s.PutState("A", []byte("1"))
+	if err := s.Finish(nil); err == nil {
+		t.Fatal("Finish saved into a missing directory")
+	}
+	if got := mustGet(t, s, "A"); got != "" {
+		t.Fatalf("unsaved write read back as %q", got)
+	}
+}
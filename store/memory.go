@@ -0,0 +1,57 @@
+package store
+
+import (
+	"sort"
+	"sync"
+)
+
+//MemStore keeps the state in memory. It satisfies ufa.Store and is meant
+//for demos, simulations and offline runs of the UFA rules
+type MemStore struct {
+	mu    sync.RWMutex
+	state map[string][]byte
+}
+
+//NewMemStore returns an empty in-memory store
+func NewMemStore() *MemStore {
+	return &MemStore{state: make(map[string][]byte)}
+}
+
+//GetState returns the value stored for the key, or nil when there is none
+func (s *MemStore) GetState(key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.state[key]
+	if !ok {
+		return nil, nil
+	}
+	return append([]byte(nil), value...), nil
+}
+
+//PutState stores a copy of the value under the key
+func (s *MemStore) PutState(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state[key] = append([]byte(nil), value...)
+	return nil
+}
+
+//Keys returns all the keys held by the store in sorted order
+func (s *MemStore) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, 0, len(s.state))
+	for key := range s.state {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//DelState removes the key
+func (s *MemStore) DelState(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.state, key)
+	return nil
+}
@@ -0,0 +1,33 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMemStore(t *testing.T) {
+	s := NewMemStore()
+	value := []byte("1")
+	s.PutState("B", value)
+	s.PutState("A", []byte("2"))
+	s.PutState("C", []byte("3"))
+
+	//The store keeps its own copy of the values it is given and returns
+	value[0] = 'x'
+	got, _ := s.GetState("B")
+	if string(got) != "1" {
+		t.Fatalf("B read back as %q after the caller changed its slice", got)
+	}
+	got[0] = 'y'
+	if again, _ := s.GetState("B"); string(again) != "1" {
+		t.Fatalf("B read back as %q after the reader changed its slice", again)
+	}
+
+	s.DelState("C")
+	if got, err := s.GetState("C"); got != nil || err != nil {
+		t.Fatalf("deleted C read back as %q, %v", got, err)
+	}
+	if keys := s.Keys(); !reflect.DeepEqual(keys, []string{"A", "B"}) {
+		t.Fatalf("keys %v", keys)
+	}
+}
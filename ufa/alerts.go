@@ -0,0 +1,124 @@
+package ufa
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+//UFA_ALERT_PREFIX Key prefix for the utilization alerts raised on a ufa
+const UFA_ALERT_PREFIX = "UFA_ALERT_"
+
+//UTILIZATION_ALERT_EVENT Name of the chaincode event carrying new alerts
+const UTILIZATION_ALERT_EVENT = "UFA_UTILIZATION_ALERT"
+
+//EventEmitter is implemented by stores which can publish chaincode
+//events, such as the Fabric stub
+type EventEmitter interface {
+	SetEvent(name string, payload []byte) error
+}
+
+//Alert records that the invoices of a UFA reached a share of its net charge
+type Alert struct {
+	UFANumber      string  `json:"ufanumber"`
+	Threshold      float64 `json:"threshold"`
+	PercentUsed    float64 `json:"percentUsed,omitempty"`
+	RaisedInvTotal float64 `json:"raisedInvTotal,omitempty"`
+	NetCharge      float64 `json:"netCharge,omitempty"`
+	InvoiceNumber  string  `json:"invoiceNumber"`
+	BillingPeriod  string  `json:"billingPeriod"`
+}
+
+//Returns the thresholds crossed when the raised total moves from before to
+//after, as alerts
+func utilizationAlerts(config Config, ufanumber string, netCharge float64, before float64, after float64) []Alert {
+	alerts := make([]Alert, 0)
+	if netCharge <= 0 {
+		return alerts
+	}
+	percentBefore := before / netCharge * 100.0
+	percentAfter := after / netCharge * 100.0
+	for _, threshold := range config.AlertThresholds {
+		if percentBefore < threshold && percentAfter >= threshold {
+			alerts = append(alerts, Alert{
+				UFANumber:      ufanumber,
+				Threshold:      threshold,
+				PercentUsed:    percentAfter,
+				RaisedInvTotal: after,
+				NetCharge:      netCharge,
+			})
+		}
+	}
+	return alerts
+}
+
+//Append the alerts to the UFA and publish them as one chaincode event
+func recordAlerts(stub Store, ufanumber string, alerts []Alert) error {
+	if err := storeAlerts(stub, ufanumber, alerts); err != nil {
+		return err
+	}
+	return publishAlerts(stub, alerts)
+}
+
+//Append the alerts to the UFA
+func storeAlerts(stub Store, ufanumber string, alerts []Alert) error {
+	if len(alerts) == 0 {
+		return nil
+	}
+	//Amounts kept private on the UFA are not copied to the shared alerts,
+	//nor is the share used as the net charge follows from it
+	config, _ := getConfig(stub)
+	fields := privateFields(stub, config, UFA_RECORD)
+	if contains(fields, "netCharge") || contains(fields, "raisedInvTotal") {
+		for i := range alerts {
+			alerts[i].NetCharge = 0
+			alerts[i].RaisedInvTotal = 0
+			alerts[i].PercentUsed = 0
+		}
+	}
+	var alertList []Alert
+	recBytes, _ := stub.GetState(UFA_ALERT_PREFIX + ufanumber)
+	if recBytes != nil {
+		if err := json.Unmarshal(recBytes, &alertList); err != nil {
+			return errors.New("Failed to unmarshal storeAlerts ")
+		}
+	}
+	alertList = append(alertList, alerts...)
+	bytesToStore, _ := canonicalJSON(alertList)
+	if err := stub.PutState(UFA_ALERT_PREFIX+ufanumber, bytesToStore); err != nil {
+		return err
+	}
+	logger.Info("Raised " + strconv.Itoa(len(alerts)) + " utilization alerts for " + ufanumber)
+	return nil
+}
+
+//Publish the alerts as the chaincode event. A transaction carries a single
+//event, so the alerts of a batch are published together
+func publishAlerts(stub Store, alerts []Alert) error {
+	if len(alerts) == 0 {
+		return nil
+	}
+	if emitter, ok := stub.(EventEmitter); ok {
+		eventBytes, _ := canonicalJSON(alerts)
+		return emitter.SetEvent(UTILIZATION_ALERT_EVENT, eventBytes)
+	}
+	return nil
+}
+
+//GetAlerts Returns the utilization alerts raised on a UFA, oldest first.
+//args are the UFA number and who
+func GetAlerts(stub Store, args []string) ([]byte, error) {
+	logger.Info("getAlerts called")
+	if len(args) < 1 {
+		return nil, errors.New("getAlerts expects the UFA number and who")
+	}
+	ufanumber := args[0]
+	if _, err := readUFAFor(stub, caller(stub, argAt(args, 1)), ufanumber); err != nil {
+		return nil, err
+	}
+	recBytes, _ := stub.GetState(UFA_ALERT_PREFIX + ufanumber)
+	if recBytes == nil {
+		return []byte("[]"), nil
+	}
+	return recBytes, nil
+}
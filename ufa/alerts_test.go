@@ -0,0 +1,53 @@
+package ufa
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUtilizationAlerts(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", newUFA())
+
+	raisePair(t, s, newInvoicePair("U1", "2016-01", "700"))
+	if len(s.events) != 0 {
+		t.Fatalf("alerts raised below the thresholds: %v", s.events)
+	}
+	//Crosses 75 and 90 at once, published as one event
+	raisePair(t, s, newInvoicePair("U1", "2016-02", "250"))
+	if len(s.events) != 1 || s.events[0].name != UTILIZATION_ALERT_EVENT {
+		t.Fatalf("events %v", s.events)
+	}
+	var published []Alert
+	if err := json.Unmarshal(s.events[0].payload, &published); err != nil {
+		t.Fatal(err)
+	}
+	if len(published) != 2 || published[0].Threshold != 75 || published[1].Threshold != 90 || published[1].InvoiceNumber != "U1-2016-02-C" {
+		t.Fatalf("published alerts %+v", published)
+	}
+	raisePair(t, s, newInvoicePair("U1", "2016-03", "50"))
+
+	var alerts []Alert
+	decode(t, s.mustCall(t, testBuyer, "getAlerts", "U1", testBuyer), &alerts)
+	if len(alerts) != 3 || alerts[2].Threshold != 100 || alerts[2].PercentUsed != 100 || alerts[2].BillingPeriod != "2016-03" {
+		t.Fatalf("getAlerts returned %+v", alerts)
+	}
+	s.mustFail(t, "not authorized to read UFA U1", testOutsider, "getAlerts", "U1", testOutsider)
+
+	createUFA(t, s, "U2", newUFA())
+	decode(t, s.mustCall(t, testSeller, "getAlerts", "U2", testSeller), &alerts)
+	if len(alerts) != 0 {
+		t.Fatalf("getAlerts of a new UFA returned %+v", alerts)
+	}
+}
+
+func TestAlertThresholdsConfig(t *testing.T) {
+	s := newLedger(t, `{"alertThresholds":[50]}`)
+	createUFA(t, s, "U1", newUFA())
+	raisePair(t, s, newInvoicePair("U1", "2016-01", "1100"))
+	var alerts []Alert
+	decode(t, s.mustCall(t, testSeller, "getAlerts", "U1", testSeller), &alerts)
+	if len(alerts) != 1 || alerts[0].Threshold != 50 || alerts[0].RaisedInvTotal != 1100 {
+		t.Fatalf("getAlerts returned %+v", alerts)
+	}
+}
@@ -0,0 +1,190 @@
+package ufa
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+//Changes a batch makes to one UFA, written once at the end
+type batchUFAChanges struct {
+	projection *invoiceProjection
+	invoices   []string
+	alerts     []Alert
+}
+
+//Merge the private fields passed in the transient map, one object per
+//invoice of each pair, into the pairs
+func withTransientPairs(stub Store, pairs [][]map[string]string) error {
+	transientStore, ok := stub.(TransientStore)
+	if !ok {
+		return nil
+	}
+	transient, err := transientStore.GetTransient()
+	if err != nil || transient[TRANSIENT_PRIVATE_KEY] == nil {
+		return nil
+	}
+	var privatePairs [][]map[string]string
+	if err := json.Unmarshal(transient[TRANSIENT_PRIVATE_KEY], &privatePairs); err != nil || len(privatePairs) != len(pairs) {
+		return errors.New("Transient private fields should be a JSON array matching the pairs")
+	}
+	for i, pair := range pairs {
+		for j := range pair {
+			if j < len(privatePairs[i]) {
+				updateRecord(pair[j], privatePairs[i][j])
+			}
+		}
+	}
+	return nil
+}
+
+//BatchCreateInvoices raises customer and vendor invoice pairs against many
+//UFAs in one transaction. args are who, a JSON array of pairs, each an
+//array of the customer and the vendor invoice, and optionally the mode,
+//ALL_OR_NOTHING by default. Only the seller of a UFA or an admin raises
+//its invoices, and they are recorded as raised by the caller. Each pair
+//is validated like createNewInvoices, seeing the pairs before it on the
+//same UFA. The invoice lists, totals and alerts of a UFA and the invoice
+//master list are each written once, so a batch does not conflict with
+//itself; batches should still be submitted one after the other as they
+//all append to the master list
+func BatchCreateInvoices(stub Store, args []string) ([]byte, error) {
+	logger.Info("batchCreateInvoices called")
+	if len(args) < 2 {
+		return nil, errors.New("batchCreateInvoices expects who and the invoice pairs as JSON")
+	}
+	who := caller(stub, args[0])
+	mode := BULK_ALL_OR_NOTHING
+	if len(args) > 2 && args[2] != "" {
+		mode = strings.ToUpper(args[2])
+	}
+	if mode != BULK_ALL_OR_NOTHING && mode != BULK_BEST_EFFORT {
+		return nil, errors.New("Unknown bulk mode " + mode)
+	}
+	var pairs [][]map[string]string
+	if err := json.Unmarshal([]byte(args[1]), &pairs); err != nil {
+		return nil, errors.New("batchCreateInvoices expects a JSON array of invoice pairs")
+	}
+	if err := withTransientPairs(stub, pairs); err != nil {
+		return nil, err
+	}
+	report, err := raiseInvoicePairs(stub, who, mode, pairs)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("batchCreateInvoices created " + strconv.Itoa(report.Created) + " pairs, failed " + strconv.Itoa(report.Failed))
+	outputBytes, err := canonicalJSON(report)
+	if err != nil {
+		return nil, err
+	}
+	return outputBytes, nil
+}
+
+//Validate and raise the invoice pairs in the mode as raised by who,
+//returning the report. A pair is refused unless who is the seller of its
+//UFA or an admin
+func raiseInvoicePairs(stub Store, who string, mode string, pairs [][]map[string]string) (BulkReport, error) {
+	config, _ := getConfig(stub)
+	admin := isAdmin(stub, who)
+	report := BulkReport{Mode: mode, Results: make([]BulkRowResult, 0, len(pairs))}
+	changes := make(map[string]*batchUFAChanges)
+	ufaOrder := make([]string, 0)
+	//Invoice numbers raised by the batch, on any of its UFAs
+	raised := make(map[string]bool)
+	for i, pair := range pairs {
+		result := BulkRowResult{Row: i + 1, Invoices: make([]string, 0, 2)}
+		violations := make([]Violation, 0)
+		for _, invoice := range pair {
+			result.Invoices = append(result.Invoices, invoice["invoiceNumber"])
+			if invoice != nil {
+				invoice["raisedBy"] = who
+			}
+		}
+		var ufaChanges *batchUFAChanges
+		if len(pair) != 2 {
+			violations = append(violations, Violation{Code: VIOLATION_MISSING_INVOICE, Message: "Invoice is missing for Customer or Vendor"})
+		} else {
+			result.UFANumber = pair[0]["ufanumber"]
+			ufaChanges = changes[result.UFANumber]
+			if ufaChanges == nil {
+				if projection := loadProjection(stub, result.UFANumber); projection != nil {
+					projection.invoices = raised
+					ufaChanges = &batchUFAChanges{projection: projection}
+					changes[result.UFANumber] = ufaChanges
+					ufaOrder = append(ufaOrder, result.UFANumber)
+				}
+			}
+			if ufaChanges == nil {
+				violations = append(violations, Violation{Code: VIOLATION_UFA_NOT_FOUND, Message: "Invalid UFA provided " + result.UFANumber})
+			} else if !admin && ufaRole(who, ufaChanges.projection.ufaDetails) != SELLER_ROLE {
+				violations = append(violations, Violation{Code: VIOLATION_NOT_AUTHORIZED, Message: "User is not authorized to raise invoices for " + result.UFANumber})
+			} else {
+				violations = append(violations, checkInvoicePair(stub, config, ufaChanges.projection, pair[0], pair[1])...)
+			}
+		}
+
+		if len(violations) > 0 {
+			result.Status = ROW_FAILED
+			result.Violations = violations
+			report.Failed++
+		} else {
+			result.Status = ROW_CREATED
+			projection := ufaChanges.projection
+			before := projection.raised
+			projection.apply(pair[0], pair[1])
+			alerts := utilizationAlerts(config, projection.ufanumber, projection.netCharge(), before, projection.raised)
+			for j := range alerts {
+				alerts[j].InvoiceNumber = pair[0]["invoiceNumber"]
+				alerts[j].BillingPeriod = pair[0]["billingPeriod"]
+			}
+			ufaChanges.alerts = append(ufaChanges.alerts, alerts...)
+			ufaChanges.invoices = append(ufaChanges.invoices, pair[0]["invoiceNumber"], pair[1]["invoiceNumber"])
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	if mode == BULK_ALL_OR_NOTHING && report.Failed > 0 {
+		for i := range report.Results {
+			if report.Results[i].Status == ROW_CREATED {
+				report.Results[i].Status = ROW_NOT_CREATED
+			}
+		}
+		return report, nil
+	}
+
+	created := make([]string, 0)
+	for i, result := range report.Results {
+		if result.Status == ROW_CREATED {
+			for _, invoice := range pairs[i] {
+				writeRecord(stub, invoice["invoiceNumber"], INVOICE_RECORD, newRecord(INVOICE_RECORD, invoice))
+			}
+			created = append(created, result.Invoices...)
+			report.Created++
+		}
+	}
+	allAlerts := make([]Alert, 0)
+	for _, ufanumber := range ufaOrder {
+		ufaChanges := changes[ufanumber]
+		if len(ufaChanges.invoices) == 0 {
+			continue
+		}
+		addInvoiceRecordsToUFA(stub, ufanumber, ufaChanges.invoices...)
+		if err := storeAlerts(stub, ufanumber, ufaChanges.alerts); err != nil {
+			return report, err
+		}
+		allAlerts = append(allAlerts, ufaChanges.alerts...)
+		if err := updateRaisedTotal(stub, ufanumber, ufaChanges.projection.raised); err != nil {
+			return report, err
+		}
+	}
+	if len(created) > 0 {
+		if err := updateInventoryMasterRecords(stub, created...); err != nil {
+			return report, err
+		}
+	}
+	if err := publishAlerts(stub, allAlerts); err != nil {
+		return report, err
+	}
+	return report, nil
+}
@@ -0,0 +1,141 @@
+package ufa
+
+import (
+	"testing"
+)
+
+func TestBatchCreateInvoices(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", newUFA())
+	createUFA(t, s, "U2", newUFA())
+	pairs := [][]invoiceFixture{
+		newInvoicePair("U1", "2016-01", "600"),
+		newInvoicePair("U2", "2016-01", "100"),
+		//Sees the first pair and breaks the ceiling
+		newInvoicePair("U1", "2016-02", "600"),
+		newInvoicePair("U1", "2016-03", "400"),
+	}
+
+	var report BulkReport
+	decode(t, s.mustCall(t, testSeller, "batchCreateInvoices", testSeller, toJSON(pairs)), &report)
+	if report.Created != 0 || report.Failed != 1 || report.Results[0].Status != ROW_NOT_CREATED || report.Results[2].Status != ROW_FAILED {
+		t.Fatalf("all or nothing batch returned %+v", report)
+	}
+	assertList(t, "invoice master list", storedList(t, s, ALL_INVOICES))
+
+	decode(t, s.mustCall(t, testSeller, "batchCreateInvoices", testSeller, toJSON(pairs), BULK_BEST_EFFORT), &report)
+	if report.Created != 3 || report.Failed != 1 || report.Results[2].Violations[0].Code != VIOLATION_CEILING_EXCEEDED {
+		t.Fatalf("best effort batch returned %+v", report)
+	}
+	if stored := storedUFA(t, s, "U1"); stored["raisedInvTotal"] != "1000" {
+		t.Fatalf("raisedInvTotal of U1 = %q, want 1000", stored["raisedInvTotal"])
+	}
+	assertList(t, "invoices of U1", storedList(t, s, UFA_INVOICE_PREFIX+"U1"), "U1-2016-01-C", "U1-2016-01-V", "U1-2016-03-C", "U1-2016-03-V")
+	assertList(t, "invoice master list", storedList(t, s, ALL_INVOICES),
+		"U1-2016-01-C", "U1-2016-01-V", "U2-2016-01-C", "U2-2016-01-V", "U1-2016-03-C", "U1-2016-03-V")
+
+	//Numbers are unique across the UFAs of a batch
+	clash := [][]invoiceFixture{newInvoicePair("U1", "2016-04", "10"), newInvoicePair("U2", "2016-04", "10")}
+	clash[1][0]["invoiceNumber"] = clash[0][1]["invoiceNumber"]
+	decode(t, s.mustCall(t, testSeller, "batchCreateInvoices", testSeller, toJSON(clash), BULK_BEST_EFFORT), &report)
+	if report.Created != 1 || report.Results[1].Violations[0].Code != VIOLATION_DUPLICATE_INVOICE {
+		t.Fatalf("batch reusing a number returned %+v", report)
+	}
+
+	s.mustFail(t, "Unknown bulk mode SOME", testSeller, "batchCreateInvoices", testSeller, toJSON(pairs), "some")
+	s.mustFail(t, "expects a JSON array of invoice pairs", testSeller, "batchCreateInvoices", testSeller, `{}`)
+}
+
+func TestBatchCreateInvoicesAuthorization(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", newUFA())
+	pairs := [][]invoiceFixture{newInvoicePair("U1", "2016-01", "100")}
+
+	//Only the seller raises invoices, whoever the who argument names
+	var report BulkReport
+	for _, who := range []string{testOutsider, testBuyer} {
+		decode(t, s.mustCall(t, who, "batchCreateInvoices", testSeller, toJSON(pairs)), &report)
+		if report.Created != 0 || report.Results[0].Violations[0].Code != VIOLATION_NOT_AUTHORIZED {
+			t.Fatalf("batch raised by %s returned %+v", who, report)
+		}
+	}
+	assertList(t, "invoice master list", storedList(t, s, ALL_INVOICES))
+
+	//raisedBy is the caller, not the one named by the invoices
+	pairs[0][0]["raisedBy"], pairs[0][1]["raisedBy"] = testOutsider, testOutsider
+	decode(t, s.mustCall(t, testSeller, "batchCreateInvoices", testSeller, toJSON(pairs)), &report)
+	if report.Created != 1 {
+		t.Fatalf("batch raised by the seller returned %+v", report)
+	}
+	if invoice := storedInvoice(t, s, "U1-2016-01-C"); invoice["raisedBy"] != testSeller {
+		t.Fatalf("raisedBy = %q, want %q", invoice["raisedBy"], testSeller)
+	}
+	s.mustFail(t, "expects who and the invoice pairs", testSeller, "batchCreateInvoices", testSeller)
+}
+
+func TestBulkCreateUFA(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", newUFA())
+	rows := []ufaFixture{
+		newUFA().with("ufanumber", "U2"),
+		newUFA().with("ufanumber", "U3").with("netCharge", "0"),
+		newUFA().with("ufanumber", "U1"),
+		newUFA().with("ufanumber", "U2"),
+		newUFA(),
+		newUFA().with("ufanumber", "U4").with("sellerName", "S2"),
+	}
+
+	var report BulkReport
+	decode(t, s.mustCall(t, testSeller, "bulkCreateUFA", testSeller, toJSON(rows)), &report)
+	if report.Created != 0 || report.Failed != 5 || report.Results[0].Status != ROW_NOT_CREATED {
+		t.Fatalf("all or nothing bulk returned %+v", report)
+	}
+	assertList(t, "UFA master list", storedList(t, s, ALL_ELEMENENTS), "U1")
+
+	decode(t, s.mustCall(t, testSeller, "bulkCreateUFA", testSeller, toJSON(rows), BULK_BEST_EFFORT), &report)
+	wantMessages := []string{"", "Invalid net charge", "UFA U1 already exists", "UFA U2 appears more than once in the batch",
+		"ufanumber is missing", "User is not authorized to create a UFA"}
+	for i, result := range report.Results {
+		if result.Msg != wantMessages[i] {
+			t.Errorf("row %d: %q, want %q", result.Row, result.Msg, wantMessages[i])
+		}
+	}
+	assertList(t, "UFA master list", storedList(t, s, ALL_ELEMENENTS), "U1", "U2")
+	if stored := storedUFA(t, s, "U2"); stored == nil || stored["ufaStatus"] != UFA_ACTIVE {
+		t.Fatalf("bulk UFA stored as %v", stored)
+	}
+
+	s.mustFail(t, "Unknown bulk mode", testSeller, "bulkCreateUFA", testSeller, toJSON(rows), "some")
+	s.mustFail(t, "expects a JSON array of UFA records", testSeller, "bulkCreateUFA", testSeller, `{}`)
+	s.mustFail(t, "bulkCreateUFA expects", testSeller, "bulkCreateUFA", testSeller)
+}
+
+func TestSimulateInvoices(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", newUFA())
+	raisePair(t, s, newInvoicePair("U1", "2016-01", "500"))
+
+	invoices := append(newInvoicePair("U1", "2016-02", "400"), newInvoicePair("U1", "2016-03", "400")...)
+	invoices = append(invoices, newInvoicePair("U1", "2016-01", "100")...)
+	var simulation Simulation
+	decode(t, s.mustCall(t, testBuyer, "simulateInvoices", testBuyer, toJSON(invoices)), &simulation)
+	if simulation.Valid || simulation.MaxCharge != 1100 || simulation.RaisedInvTotal != 500 || simulation.ProjectedRaisedInvTotal != 900 {
+		t.Fatalf("simulateInvoices returned %+v", simulation)
+	}
+	assertList(t, "covered periods", simulation.CoveredPeriods, "2016-02")
+	codes := make([]string, 0)
+	for _, violation := range simulation.Violations {
+		codes = append(codes, violation.Code)
+	}
+	assertList(t, "violations", codes, VIOLATION_CEILING_EXCEEDED, VIOLATION_DUPLICATE_INVOICE, VIOLATION_DUPLICATE_INVOICE, VIOLATION_PERIOD_INVOICED)
+	if stored := storedUFA(t, s, "U1"); stored["raisedInvTotal"] != "500" {
+		t.Fatal("simulation changed the UFA")
+	}
+
+	decode(t, s.mustCall(t, testBuyer, "simulateInvoices", testBuyer, toJSON(newInvoicePair("U9", "2016-01", "1"))), &simulation)
+	if simulation.Valid || simulation.Violations[0].Code != VIOLATION_UFA_NOT_FOUND {
+		t.Fatalf("simulation on an unknown UFA returned %+v", simulation)
+	}
+	s.mustFail(t, "not authorized to read UFA U1", testOutsider, "simulateInvoices", testOutsider, toJSON(invoices))
+	s.mustFail(t, "expects at least one invoice pair", testBuyer, "simulateInvoices", testBuyer, `[]`)
+}
@@ -0,0 +1,123 @@
+package ufa
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+//BULK_ALL_OR_NOTHING Bulk mode creating the records only when every row is valid
+const BULK_ALL_OR_NOTHING = "ALL_OR_NOTHING"
+
+//BULK_BEST_EFFORT Bulk mode creating the valid rows and reporting the others
+const BULK_BEST_EFFORT = "BEST_EFFORT"
+
+//Status of a row in a bulk report
+const (
+	ROW_CREATED     = "CREATED"
+	ROW_FAILED      = "FAILED"
+	ROW_NOT_CREATED = "NOT_CREATED"
+)
+
+//BulkRowResult is the outcome of one row of a bulk request
+type BulkRowResult struct {
+	Row       int    `json:"row"`
+	UFANumber string `json:"ufanumber"`
+	Status    string `json:"status"`
+	Msg       string `json:"msg,omitempty"`
+	//Invoices of the row and the rules they break, for invoice batches
+	Invoices   []string    `json:"invoices,omitempty"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+//BulkReport is returned by the bulk functions
+type BulkReport struct {
+	Mode    string          `json:"mode"`
+	Created int             `json:"created"`
+	Failed  int             `json:"failed"`
+	Results []BulkRowResult `json:"results"`
+}
+
+//BulkCreateUFA creates a batch of UFAs in one transaction. args are who,
+//a JSON array of UFA records each carrying its ufanumber, and optionally
+//the mode, ALL_OR_NOTHING by default. Every row is validated like
+//createUFA. In ALL_OR_NOTHING mode nothing is written when a row fails;
+//in BEST_EFFORT mode the valid rows are created. The per row report is
+//returned in both cases
+func BulkCreateUFA(stub Store, args []string) ([]byte, error) {
+	logger.Info("bulkCreateUFA called")
+	if len(args) < 2 {
+		return nil, errors.New("bulkCreateUFA expects who and the UFA records as a JSON array")
+	}
+	who := caller(stub, args[0])
+	payload := args[1]
+	mode := BULK_ALL_OR_NOTHING
+	if len(args) > 2 && args[2] != "" {
+		mode = strings.ToUpper(args[2])
+	}
+	if mode != BULK_ALL_OR_NOTHING && mode != BULK_BEST_EFFORT {
+		return nil, errors.New("Unknown bulk mode " + mode)
+	}
+
+	var records []map[string]string
+	if err := json.Unmarshal([]byte(payload), &records); err != nil {
+		return nil, errors.New("bulkCreateUFA expects a JSON array of UFA records")
+	}
+
+	report := BulkReport{Mode: mode, Results: make([]BulkRowResult, 0, len(records))}
+	rowPayloads := make([]string, len(records))
+	seen := make(map[string]bool)
+	for i, record := range records {
+		result := BulkRowResult{Row: i + 1, UFANumber: record["ufanumber"]}
+		rowBytes, _ := canonicalJSON(record)
+		rowPayloads[i] = string(rowBytes)
+
+		var valMsg string
+		if result.UFANumber == "" {
+			valMsg = "\nufanumber is missing"
+		} else if seen[result.UFANumber] {
+			valMsg = "\nUFA " + result.UFANumber + " appears more than once in the batch"
+		} else if existing, _ := stub.GetState(result.UFANumber); existing != nil {
+			valMsg = "\nUFA " + result.UFANumber + " already exists"
+		} else {
+			valMsg = ValidateNewUFA(stub, who, rowPayloads[i])
+		}
+		seen[result.UFANumber] = true
+
+		if valMsg != "" {
+			result.Status = ROW_FAILED
+			result.Msg = strings.Replace(strings.TrimPrefix(valMsg, "\n"), "\n", "; ", -1)
+			report.Failed++
+		} else {
+			result.Status = ROW_CREATED
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	if mode == BULK_ALL_OR_NOTHING && report.Failed > 0 {
+		for i := range report.Results {
+			if report.Results[i].Status == ROW_CREATED {
+				report.Results[i].Status = ROW_NOT_CREATED
+			}
+		}
+	} else {
+		created := make([]string, 0, len(records))
+		for i, result := range report.Results {
+			if result.Status == ROW_CREATED {
+				storeNewUFA(stub, result.UFANumber, rowPayloads[i])
+				created = append(created, result.UFANumber)
+			}
+		}
+		if len(created) > 0 {
+			if err := updateMasterRecords(stub, created...); err != nil {
+				return nil, err
+			}
+		}
+		report.Created = len(created)
+	}
+
+	logger.Info("bulkCreateUFA created " + strconv.Itoa(report.Created) + " failed " + strconv.Itoa(report.Failed))
+	outputBytes, _ := canonicalJSON(report)
+	return outputBytes, nil
+}
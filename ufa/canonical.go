@@ -0,0 +1,106 @@
+package ufa
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//canonicalJSON encodes the value the same way on every peer: object keys
+//sorted, including the fields of structs, numbers in a single format and
+//strings escaped as by encoding/json. Records of strings encode exactly
+//as json.Marshal does, so stored hashes and signatures stay valid
+func canonicalJSON(v interface{}) ([]byte, error) {
+	plainBytes, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(plainBytes))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	if err := writeCanonical(&buffer, generic); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+//Write a decoded JSON value in canonical form
+func writeCanonical(buffer *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		buffer.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buffer.WriteByte(',')
+			}
+			keyBytes, _ := json.Marshal(key)
+			buffer.Write(keyBytes)
+			buffer.WriteByte(':')
+			if err := writeCanonical(buffer, v[key]); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte('}')
+	case []interface{}:
+		buffer.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buffer.WriteByte(',')
+			}
+			if err := writeCanonical(buffer, item); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte(']')
+	case json.Number:
+		number, err := canonicalNumber(v)
+		if err != nil {
+			return err
+		}
+		buffer.WriteString(number)
+	default:
+		//Strings, booleans and null
+		valueBytes, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buffer.Write(valueBytes)
+	}
+	return nil
+}
+
+//Formats a number as the shortest decimal that reads back to the same
+//float64, with an exponent only below 1e-6 or from 1e21 on
+func canonicalNumber(number json.Number) (string, error) {
+	f, err := strconv.ParseFloat(string(number), 64)
+	if err != nil {
+		return "", err
+	}
+	if f == 0 {
+		return "0", nil
+	}
+	abs := math.Abs(f)
+	if abs >= 1e-6 && abs < 1e21 {
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	}
+	formatted := strconv.FormatFloat(f, 'e', -1, 64)
+	//1e-07 becomes 1e-7
+	if i := strings.Index(formatted, "e-0"); i >= 0 {
+		formatted = formatted[:i+2] + formatted[i+3:]
+	} else if i := strings.Index(formatted, "e+0"); i >= 0 {
+		formatted = formatted[:i+2] + formatted[i+3:]
+	}
+	return formatted, nil
+}
@@ -0,0 +1,356 @@
+package ufa
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+//CONFIG_KEY Key of the chaincode configuration record
+const CONFIG_KEY = "CONFIG"
+
+//CONFIG_AUDIT_KEY Key of the list of configuration changes
+const CONFIG_AUDIT_KEY = "CONFIG_AUDIT"
+
+//ADMIN_ROLE Admin identity used when no admins are configured
+const ADMIN_ROLE = "ADMIN"
+
+//Config holds the business rules applied by the validation functions
+type Config struct {
+	//Identities allowed to run the administrative functions. On a peer
+	//they are matched against the submitter of the transaction, named
+	//MSPID/name, so the chaincode is initialized with its admins
+	Admins []string `json:"admins"`
+	//Range accepted for chargTolrence, in percent
+	MinTolerance float64 `json:"minTolerance"`
+	MaxTolerance float64 `json:"maxTolerance"`
+	//Roles allowed to create a UFA, played by the creator as the seller or
+	//buyer named in it
+	AllowedRoles []string `json:"allowedRoles"`
+	//Fields a new UFA must carry
+	RequiredUFAFields []string `json:"requiredUFAFields"`
+	//Values accepted for the billingFrequency of a UFA
+	BillingFrequencies []string `json:"billingFrequencies"`
+	//Currencies accepted on UFAs and invoices
+	Currencies []string `json:"currencies"`
+	//Currency given to UFAs created without one
+	Currency string `json:"currency"`
+	//Shares of the net charge, in percent, raising a utilization alert
+	//when the invoices of a UFA reach them
+	AlertThresholds []float64 `json:"alertThresholds"`
+	//How the unused net charge of a renewed UFA moves to its successor:
+	//NONE, FULL, or CAPPED at RenewalCapPercent of the new net charge
+	RenewalPolicy     string  `json:"renewalPolicy"`
+	RenewalCapPercent float64 `json:"renewalCapPercent"`
+	//Identities allowed to read every UFA and invoice besides the parties
+	Auditors []string `json:"auditors"`
+	//Private data collection holding the confidential fields. When empty
+	//every field is kept on the shared ledger
+	PrivateCollection string `json:"privateCollection"`
+	//Fields of UFAs and invoices kept in the private collection, with only
+	//their hash on the shared ledger
+	PrivateUFAFields     []string `json:"privateUFAFields"`
+	PrivateInvoiceFields []string `json:"privateInvoiceFields"`
+	//Reject invoices raised or approved without a signature. Signatures
+	//sent while this is off are still verified
+	RequireInvoiceSignatures bool `json:"requireInvoiceSignatures"`
+	//Reject UFAs and invoices naming parties missing from the registry.
+	//Inactive parties are always rejected
+	RequireRegisteredParties bool `json:"requireRegisteredParties"`
+	//Reject usage records not signed by their source
+	RequireUsageSignatures bool `json:"requireUsageSignatures"`
+}
+
+//Config change kept in the audit trail
+type configAuditEntry struct {
+	ChangedBy string `json:"changedBy"`
+	Change    string `json:"change"`
+	Config    Config `json:"config"`
+}
+
+//Settings used when Init is called without parameters
+func defaultConfig() Config {
+	return Config{
+		Admins:                   []string{ADMIN_ROLE},
+		MinTolerance:             0,
+		MaxTolerance:             10,
+		AllowedRoles:             []string{"SELLER", "BUYER"},
+		RequiredUFAFields:        []string{"netCharge", "chargTolrence"},
+		BillingFrequencies:       []string{"MONTHLY", "QUARTERLY", "YEARLY"},
+		Currencies:               []string{"USD"},
+		Currency:                 "USD",
+		AlertThresholds:          []float64{75, 90, 100},
+		RenewalPolicy:            RENEWAL_CARRY_NONE,
+		RenewalCapPercent:        0,
+		Auditors:                 []string{ADMIN_ROLE},
+		PrivateCollection:        "",
+		PrivateUFAFields:         []string{},
+		PrivateInvoiceFields:     []string{},
+		RequireInvoiceSignatures: false,
+		RequireRegisteredParties: false,
+		RequireUsageSignatures:   false,
+	}
+}
+
+//Check the settings are usable
+func validateConfig(config Config) string {
+	if len(config.Admins) == 0 {
+		return "At least one admin is required"
+	}
+	if config.MinTolerance < 0 || config.MinTolerance > config.MaxTolerance {
+		return "Tolerance range is invalid"
+	}
+	if len(config.AllowedRoles) == 0 {
+		return "At least one role is required"
+	}
+	if !contains(config.Currencies, config.Currency) {
+		return "Default currency is not one of the currencies"
+	}
+	if !contains([]string{RENEWAL_CARRY_NONE, RENEWAL_CARRY_FULL, RENEWAL_CARRY_CAPPED}, config.RenewalPolicy) {
+		return "Renewal policy should be NONE, FULL or CAPPED"
+	}
+	if config.RenewalCapPercent < 0 {
+		return "Renewal cap should not be negative"
+	}
+	for _, threshold := range config.AlertThresholds {
+		if threshold <= 0 {
+			return "Alert thresholds should be above zero"
+		}
+	}
+	return ""
+}
+
+//Tells if the list holds the value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+//Returns the stored configuration, or the defaults when none is stored
+func getConfig(stub Store) (Config, error) {
+	config := defaultConfig()
+	recBytes, err := stub.GetState(CONFIG_KEY)
+	if err != nil {
+		return config, err
+	}
+	if recBytes == nil {
+		return config, nil
+	}
+	if err := json.Unmarshal(recBytes, &config); err != nil {
+		return config, errors.New("Failed to unmarshal getConfig ")
+	}
+	return config, nil
+}
+
+//Store the configuration and record the change in the audit trail
+func putConfig(stub Store, who string, change string, config Config) error {
+	bytesToStore, _ := canonicalJSON(config)
+	logger.Info("Storing the configuration " + string(bytesToStore))
+	if err := stub.PutState(CONFIG_KEY, bytesToStore); err != nil {
+		return err
+	}
+
+	var auditList []configAuditEntry
+	recBytes, _ := stub.GetState(CONFIG_AUDIT_KEY)
+	if recBytes != nil {
+		if err := json.Unmarshal(recBytes, &auditList); err != nil {
+			return errors.New("Failed to unmarshal putConfig ")
+		}
+	}
+	auditList = append(auditList, configAuditEntry{who, change, config})
+	auditBytes, _ := canonicalJSON(auditList)
+	return stub.PutState(CONFIG_AUDIT_KEY, auditBytes)
+}
+
+//Tells if who is one of the configured admins. who should come from
+//caller, so it is the submitter of the transaction on a peer
+func isAdmin(stub Store, who string) bool {
+	if who == "" {
+		return false
+	}
+	config, _ := getConfig(stub)
+	return contains(config.Admins, who)
+}
+
+//SetConfig changes the configuration. The payload holds only the fields
+//to change. Only an admin can change the configuration
+func SetConfig(stub Store, args []string) ([]byte, error) {
+	logger.Info("setConfig called")
+	if len(args) < 2 {
+		return nil, errors.New("setConfig expects who and the configuration as JSON")
+	}
+	who := caller(stub, args[0])
+	payload := args[1]
+	if !isAdmin(stub, who) {
+		return nil, errors.New("User is not authorized to change the configuration")
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(payload), &config); err != nil {
+		return nil, errors.New("Invalid configuration passed to setConfig")
+	}
+	if msg := validateConfig(config); msg != "" {
+		return nil, errors.New("Invalid configuration passed to setConfig: " + msg)
+	}
+	if err := putConfig(stub, who, payload, config); err != nil {
+		return nil, err
+	}
+	outputBytes, _ := canonicalJSON(config)
+	return outputBytes, nil
+}
+
+//GetConfig returns the configuration. Only an admin can read it
+func GetConfig(stub Store, args []string) ([]byte, error) {
+	logger.Info("getConfig called")
+	who := caller(stub, argAt(args, 0))
+	if !isAdmin(stub, who) {
+		return nil, errors.New("User is not authorized to read the configuration")
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return nil, err
+	}
+	outputBytes, _ := canonicalJSON(config)
+	return outputBytes, nil
+}
+
+//GetConfigAudit returns every configuration change made so far. Only an
+//admin can read it
+func GetConfigAudit(stub Store, args []string) ([]byte, error) {
+	logger.Info("getConfigAudit called")
+	who := caller(stub, argAt(args, 0))
+	if !isAdmin(stub, who) {
+		return nil, errors.New("User is not authorized to read the configuration")
+	}
+	recBytes, _ := stub.GetState(CONFIG_AUDIT_KEY)
+	if recBytes == nil {
+		return []byte("[]"), nil
+	}
+	return recBytes, nil
+}
+
+//Place an empty list under the key unless one is already there
+func initMasterList(stub Store, key string) error {
+	recBytes, err := stub.GetState(key)
+	if err != nil {
+		return err
+	}
+	if recBytes != nil {
+		logger.Info("InitLedger keeping the existing " + key)
+		return nil
+	}
+	return stub.PutState(key, []byte("[]"))
+}
+
+//InitLedger prepares the state on instantiation and on upgrade. Existing
+//master lists are kept. args[0], when given, is the configuration as
+//JSON; fields left out take their default values. Without it an existing
+//configuration is kept and a new ledger gets the defaults
+func InitLedger(stub Store, args []string) ([]byte, error) {
+	logger.Info("InitLedger called")
+	if err := initMasterList(stub, ALL_ELEMENENTS); err != nil {
+		return nil, err
+	}
+	if err := initMasterList(stub, ALL_INVOICES); err != nil {
+		return nil, err
+	}
+
+	if len(args) > 0 && args[0] != "" {
+		config := defaultConfig()
+		if err := json.Unmarshal([]byte(args[0]), &config); err != nil {
+			return nil, errors.New("Invalid configuration passed to Init")
+		}
+		if msg := validateConfig(config); msg != "" {
+			return nil, errors.New("Invalid configuration passed to Init: " + msg)
+		}
+		return nil, putConfig(stub, "Init", args[0], config)
+	}
+	recBytes, err := stub.GetState(CONFIG_KEY)
+	if err != nil {
+		return nil, err
+	}
+	if recBytes == nil {
+		return nil, putConfig(stub, "Init", "", defaultConfig())
+	}
+	return nil, nil
+}
+
+//Remove the record under the key, and its private data when it has some
+func deleteRecord(stub Store, key string) error {
+	recBytes, _ := stub.GetState(key)
+	if recBytes == nil {
+		return nil
+	}
+	var record map[string]string
+	json.Unmarshal(recBytes, &record)
+	if record[PRIVATE_HASH_FIELD] != "" {
+		config, _ := getConfig(stub)
+		if privateStore, ok := stub.(PrivateStore); ok && config.PrivateCollection != "" {
+			if err := privateStore.DelPrivateData(config.PrivateCollection, key); err != nil {
+				return err
+			}
+		}
+	}
+	return stub.(StateDeleter).DelState(key)
+}
+
+//ResetState deletes every UFA and invoice listed in the master lists,
+//together with their history, invoice lists, alerts, amendments,
+//documents and usage, and empties the lists. The parties, the
+//configuration and its audit trail are kept. Only an admin can reset the
+//state, on stores which can delete keys
+func ResetState(stub Store, args []string) ([]byte, error) {
+	logger.Info("resetState called")
+	who := caller(stub, argAt(args, 0))
+	if !isAdmin(stub, who) {
+		return nil, errors.New("User is not authorized to reset the state")
+	}
+	deleter, ok := stub.(StateDeleter)
+	if !ok {
+		return nil, errors.New("The store does not support deleting the state")
+	}
+	ufaList, err := getAllRecordsList(stub)
+	if err != nil {
+		return nil, err
+	}
+	invoiceList, err := getAllInvloiceFromMasterList(stub)
+	if err != nil {
+		return nil, err
+	}
+	for _, ufanumber := range ufaList {
+		invoices, _ := getAllInvloiceList(stub, ufanumber)
+		invoiceList = append(invoiceList, invoices...)
+		periods, _ := getUsagePeriods(stub, ufanumber)
+		for _, period := range periods {
+			if err := deleter.DelState(usageKey(ufanumber, period)); err != nil {
+				return nil, err
+			}
+		}
+		for _, key := range []string{UFA_TRXN_PREFIX, UFA_INVOICE_PREFIX, UFA_ALERT_PREFIX, UFA_AMENDMENT_PREFIX, DOCUMENT_PREFIX, UFA_USAGE_PERIODS_PREFIX} {
+			if err := deleter.DelState(key + ufanumber); err != nil {
+				return nil, err
+			}
+		}
+		if err := deleteRecord(stub, ufanumber); err != nil {
+			return nil, err
+		}
+	}
+	for _, invoiceNumber := range invoiceList {
+		if err := deleter.DelState(DOCUMENT_PREFIX + invoiceNumber); err != nil {
+			return nil, err
+		}
+		if err := deleteRecord(stub, invoiceNumber); err != nil {
+			return nil, err
+		}
+	}
+	stub.PutState(ALL_ELEMENENTS, []byte("[]"))
+	stub.PutState(ALL_INVOICES, []byte("[]"))
+	logger.Info("resetState deleted " + strconv.Itoa(len(ufaList)) + " UFAs, done by " + who)
+	return nil, nil
+}
@@ -0,0 +1,97 @@
+package ufa
+
+import (
+	"testing"
+)
+
+func TestSetConfig(t *testing.T) {
+	s := newLedger(t, "")
+	var config Config
+	decode(t, s.mustCall(t, ADMIN_ROLE, "setConfig", ADMIN_ROLE, `{"maxTolerance":25,"currencies":["USD","EUR"]}`), &config)
+	if config.MaxTolerance != 25 || !contains(config.Currencies, "EUR") || config.Currency != "USD" {
+		t.Fatalf("setConfig returned %+v", config)
+	}
+	createUFA(t, s, "U1", newUFA().with("chargTolrence", "25").with("currency", "EUR"))
+
+	s.mustFail(t, "not authorized to change the configuration", testSeller, "setConfig", testSeller, `{"maxTolerance":50}`)
+	s.mustFail(t, "Tolerance range is invalid", ADMIN_ROLE, "setConfig", ADMIN_ROLE, `{"minTolerance":30}`)
+	s.mustFail(t, "Invalid configuration passed to setConfig", ADMIN_ROLE, "setConfig", ADMIN_ROLE, `[]`)
+	s.mustFail(t, "setConfig expects", ADMIN_ROLE, "setConfig", ADMIN_ROLE)
+
+	decode(t, s.mustCall(t, ADMIN_ROLE, "getConfig", ADMIN_ROLE), &config)
+	if config.MaxTolerance != 25 {
+		t.Fatalf("getConfig returned %+v", config)
+	}
+	s.mustFail(t, "not authorized to read the configuration", testSeller, "getConfig", testSeller)
+
+	var audit []configAuditEntry
+	decode(t, s.mustCall(t, ADMIN_ROLE, "getConfigAudit", ADMIN_ROLE), &audit)
+	if len(audit) != 2 || audit[0].ChangedBy != "Init" || audit[1].ChangedBy != ADMIN_ROLE {
+		t.Fatalf("getConfigAudit returned %+v", audit)
+	}
+	s.mustFail(t, "not authorized to read the configuration", testSeller, "getConfigAudit", testSeller)
+}
+
+//Handing the admin role over takes it from the previous admins
+func TestConfiguredAdmins(t *testing.T) {
+	s := newLedger(t, `{"admins":["OPS"]}`)
+	s.mustFail(t, "not authorized", ADMIN_ROLE, "getConfig", ADMIN_ROLE)
+	s.mustCall(t, "OPS", "getConfig", "OPS")
+	s.mustFail(t, "not authorized", "", "getConfig", "")
+}
+
+func TestResetState(t *testing.T) {
+	s := newLedger(t, "")
+	s.mustCall(t, ADMIN_ROLE, "registerParty", ADMIN_ROLE, `{"id":"S1","legalName":"Seller","roles":["SELLER"]}`)
+	createUFA(t, s, "U1", newUFA().with("netCharge", "100"))
+	raisePair(t, s, newInvoicePair("U1", "2016-01", "100"))
+	s.mustCall(t, testSeller, "attachDocument", testSeller, "U1", toJSON(testDocument("contract.pdf")))
+	if s.state[UFA_ALERT_PREFIX+"U1"] == nil {
+		t.Fatal("alerts expected on U1")
+	}
+
+	s.mustFail(t, "not authorized to reset the state", testSeller, "resetState", testSeller)
+	s.mustCall(t, ADMIN_ROLE, "resetState", ADMIN_ROLE)
+	assertList(t, "state after reset", s.keys(), ALL_INVOICES, ALL_ELEMENENTS, CONFIG_KEY, CONFIG_AUDIT_KEY, PARTY_PREFIX+"S1")
+	assertList(t, "UFA master list", storedList(t, s, ALL_ELEMENENTS))
+
+	//The numbers can be used again
+	createUFA(t, s, "U1", newUFA())
+	raisePair(t, s, newInvoicePair("U1", "2016-01", "100"))
+	if stored := storedUFA(t, s, "U1"); stored["raisedInvTotal"] != "100" {
+		t.Fatalf("raisedInvTotal after reset = %q, want 100", stored["raisedInvTotal"])
+	}
+}
+
+func TestMigrateState(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", newUFA())
+	//A UFA written before schema versions
+	s.state["U0"] = []byte(`{"sellerName":"S1","buyerName":"B1","netCharge":"10","chargTolrence":"0"}`)
+	s.state[ALL_ELEMENENTS] = []byte(`["U0","U1"]`)
+
+	var entries []migrationEntry
+	s.mustFail(t, "not authorized to migrate", testSeller, "migrateStateDryRun", testSeller)
+	decode(t, s.mustCall(t, ADMIN_ROLE, "migrateStateDryRun", ADMIN_ROLE), &entries)
+	if len(entries) != 1 || entries[0].Key != "U0" || entries[0].FromVersion != 0 {
+		t.Fatalf("migrateStateDryRun returned %+v", entries)
+	}
+	if string(s.state["U0"]) != `{"sellerName":"S1","buyerName":"B1","netCharge":"10","chargTolrence":"0"}` {
+		t.Fatal("dry run changed the record")
+	}
+
+	s.mustFail(t, "not authorized to migrate", testSeller, "migrateState", testSeller)
+	decode(t, s.mustCall(t, ADMIN_ROLE, "migrateState", ADMIN_ROLE), &entries)
+	if len(entries) != 1 {
+		t.Fatalf("migrateState returned %+v", entries)
+	}
+	var stored map[string]string
+	decode(t, s.state["U0"], &stored)
+	if stored["raisedInvTotal"] != "0" || stored["ufaStatus"] != UFA_ACTIVE || stored[SCHEMA_VERSION_FIELD] == "" {
+		t.Fatalf("migrated record %v", stored)
+	}
+	decode(t, s.mustCall(t, ADMIN_ROLE, "migrateStateDryRun", ADMIN_ROLE), &entries)
+	if len(entries) != 0 {
+		t.Fatalf("records left to migrate: %+v", entries)
+	}
+}
@@ -0,0 +1,160 @@
+package ufa
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+//MetadataFunction is the name Fabric contract clients use to read the
+//contract metadata
+const MetadataFunction = "org.hyperledger.fabric:GetMetadata"
+
+type chaincodeFunction func(stub Store, args []string) ([]byte, error)
+
+//Functions which change the state
+var invokeFunctions = map[string]chaincodeFunction{
+	"createUFA":           CreateUFA,
+	"bulkCreateUFA":       BulkCreateUFA,
+	"updateUFA":           UpdateUFA,
+	"amendUFA":            AmendUFA,
+	"createNewInvoices":   CreateNewInvoices,
+	"batchCreateInvoices": BatchCreateInvoices,
+	"generateDueInvoices": GenerateDueInvoices,
+	"submitUsage":         SubmitUsage,
+	"updateInvoices":      UpdateInvoices,
+	"approveInvoice":      ApproveInvoice,
+	"payInvoice":          PayInvoice,
+	"sweepExpiredUFAs":    SweepExpiredUFAs,
+	"renewUFA":            RenewUFA,
+	"attachDocument":      AttachDocument,
+	"registerParty":       RegisterParty,
+	"updateParty":         UpdateParty,
+	"deactivateParty":     DeactivateParty,
+	"migrateState":        MigrateState,
+	"resetState":          ResetState,
+	"setConfig":           SetConfig,
+}
+
+//Functions which only read the state
+var queryFunctions = map[string]chaincodeFunction{
+	"getAllUFA": func(stub Store, args []string) ([]byte, error) {
+		return GetAllUFA(stub, argAt(args, 0))
+	},
+	"getUFADetails":      GetUFADetails,
+	"getUFAHistory":      GetUFAHistory,
+	"getBillingSchedule": GetBillingSchedule,
+	"getUsage":           GetUsage,
+	"probe": func(stub Store, args []string) ([]byte, error) {
+		return Probe(), nil
+	},
+	"validateNewUFA": func(stub Store, args []string) ([]byte, error) {
+		return ValidateNewUFAData(stub, args), nil
+	},
+	"validateNewInvoideData": func(stub Store, args []string) ([]byte, error) {
+		return ValidateNewInvoideData(stub, args), nil
+	},
+	"getInvoices":             GetInvoices,
+	"getInvoiceDetails":       GetInvoiceDetails,
+	"getAllInvoicesForUsr":    GetAllInvoicesForUsr,
+	"migrateStateDryRun":      MigrateStateDryRun,
+	"getConfig":               GetConfig,
+	"getConfigAudit":          GetConfigAudit,
+	"exportReport":            ExportReport,
+	"verifyPrivateData":       VerifyPrivateData,
+	"listDocuments":           ListDocuments,
+	"simulateInvoices":        SimulateInvoices,
+	"verifyDocument":          VerifyDocument,
+	"getParty":                GetParty,
+	"verifyInvoiceSignatures": VerifyInvoiceSignatures,
+	"getAlerts":               GetAlerts,
+}
+
+//Returns the argument at the index, or an empty string when it was not
+//passed
+func argAt(args []string, index int) string {
+	if index < len(args) {
+		return args[index]
+	}
+	return ""
+}
+
+//Runs the function, reporting a panic as the error of the call so that a
+//malformed request fails alone rather than taking the chaincode down
+func run(fn chaincodeFunction, function string, stub Store, args []string) (output []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Info("recovered from a panic in " + function + ": " + fmt.Sprint(r))
+			output, err = nil, errors.New(function+" failed: "+fmt.Sprint(r))
+		}
+	}()
+	return fn(stub, args)
+}
+
+//Invoke routes a state changing function to its implementation
+func Invoke(stub Store, function string, args []string) ([]byte, error) {
+	if fn, ok := invokeFunctions[function]; ok {
+		return run(fn, function, stub, args)
+	}
+	return nil, errors.New("Received unknown invoke function name " + function)
+}
+
+//Query routes a read only function to its implementation
+func Query(stub Store, function string, args []string) ([]byte, error) {
+	if fn, ok := queryFunctions[function]; ok {
+		return run(fn, function, stub, args)
+	}
+	return nil, errors.New("Received unknown query function name " + function)
+}
+
+//Call routes any function, state changing or read only, to its
+//implementation. It also answers the contract metadata request
+func Call(stub Store, function string, args []string) ([]byte, error) {
+	if function == MetadataFunction {
+		return Metadata(), nil
+	}
+	if IsQuery(function) {
+		return Query(stub, function, args)
+	}
+	return Invoke(stub, function, args)
+}
+
+//IsQuery tells if the function only reads the state
+func IsQuery(function string) bool {
+	_, ok := queryFunctions[function]
+	return ok
+}
+
+//Metadata describes the functions of the chaincode in the layout used by
+//the Fabric contract API. Invoke functions are tagged submit and query
+//functions evaluate
+func Metadata() []byte {
+	type transaction struct {
+		Name string   `json:"name"`
+		Tag  []string `json:"tag"`
+	}
+	transactions := make([]transaction, 0, len(invokeFunctions)+len(queryFunctions))
+	for name := range invokeFunctions {
+		transactions = append(transactions, transaction{Name: name, Tag: []string{"submit"}})
+	}
+	for name := range queryFunctions {
+		transactions = append(transactions, transaction{Name: name, Tag: []string{"evaluate"}})
+	}
+	sort.Slice(transactions, func(i, j int) bool { return transactions[i].Name < transactions[j].Name })
+
+	metadata := map[string]interface{}{
+		"info": map[string]string{
+			"title":   "UFAChainCode",
+			"version": "latest",
+		},
+		"contracts": map[string]interface{}{
+			"UFAChainCode": map[string]interface{}{
+				"name":         "UFAChainCode",
+				"transactions": transactions,
+			},
+		},
+		"components": map[string]interface{}{},
+	}
+	outputBytes, _ := canonicalJSON(metadata)
+	return outputBytes
+}
@@ -0,0 +1,46 @@
+package ufa
+
+import (
+	"sort"
+	"testing"
+)
+
+//Every function is called straight, without the recovery of Invoke and
+//Query, with no arguments and with empty ones. It has to report an error
+//or answer, never panic
+func TestNoArguments(t *testing.T) {
+	functions := make(map[string]chaincodeFunction)
+	for name, fn := range invokeFunctions {
+		functions[name] = fn
+	}
+	for name, fn := range queryFunctions {
+		functions[name] = fn
+	}
+	names := make([]string, 0, len(functions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	argSets := map[string][]string{
+		"no arguments":    nil,
+		"empty arguments": {"", "", "", ""},
+	}
+	for _, name := range names {
+		for setName, args := range argSets {
+			for _, who := range []string{"", testSeller, ADMIN_ROLE} {
+				t.Run(name+"/"+setName+"/"+who, func(t *testing.T) {
+					s := newLedger(t, "{}")
+					createUFA(t, s, "U1", newUFA())
+					s.creator = who
+					defer func() {
+						if r := recover(); r != nil {
+							t.Fatalf("%s panicked: %v", name, r)
+						}
+					}()
+					functions[name](s, args)
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package ufa
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+//DOCUMENT_PREFIX Key prefix for the documents anchored on a UFA or invoice
+const DOCUMENT_PREFIX = "DOCUMENTS_"
+
+//Clock is implemented by stores knowing the time of the transaction. The
+//chaincode uses the transaction timestamp so every endorser records the
+//same time
+type Clock interface {
+	TxTime() (time.Time, error)
+}
+
+//Document is the metadata anchored for a file kept off the ledger
+type Document struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	SHA256     string `json:"sha256"`
+	Uploader   string `json:"uploader"`
+	Timestamp  string `json:"timestamp"`
+	StorageURI string `json:"storageURI"`
+}
+
+//Returns the time of the transaction when the store knows it
+func txTime(stub Store) (time.Time, bool) {
+	clock, ok := stub.(Clock)
+	if !ok {
+		return time.Time{}, false
+	}
+	now, err := clock.TxTime()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return now.UTC(), true
+}
+
+//Tells if who can read the UFA or invoice stored under the key
+func canReadTarget(stub Store, who string, key string) (bool, error) {
+	record, err := loadRecord(stub, key)
+	if err != nil {
+		return false, err
+	}
+	if record == nil {
+		return false, errors.New("No UFA or invoice is stored under " + key)
+	}
+	config, _ := getConfig(stub)
+	if record["invoiceNumber"] != "" {
+		invoice, _ := readRecord(stub, key, INVOICE_RECORD)
+		return canReadInvoice(stub, config, who, invoice), nil
+	}
+	ufaDetails, _ := readRecord(stub, key, UFA_RECORD)
+	return canReadUFA(config, who, ufaDetails), nil
+}
+
+//Returns the documents anchored on the key
+func getDocuments(stub Store, key string) ([]Document, error) {
+	documents := make([]Document, 0)
+	recBytes, _ := stub.GetState(DOCUMENT_PREFIX + key)
+	if recBytes == nil {
+		return documents, nil
+	}
+	if err := json.Unmarshal(recBytes, &documents); err != nil {
+		return nil, errors.New("Failed to unmarshal getDocuments ")
+	}
+	return documents, nil
+}
+
+//AttachDocument anchors the metadata of a document on a UFA or invoice.
+//args are who, the UFA or invoice number and the document as JSON with
+//name, type, sha256 and storageURI. The timestamp is the transaction
+//time; off-chain stores without one take it from the payload
+func AttachDocument(stub Store, args []string) ([]byte, error) {
+	logger.Info("attachDocument called")
+	if len(args) < 3 {
+		return nil, errors.New("attachDocument expects who, the UFA or invoice number and the document as JSON")
+	}
+	who := caller(stub, args[0])
+	key := args[1]
+	var document Document
+	if err := json.Unmarshal([]byte(args[2]), &document); err != nil {
+		return nil, errors.New("attachDocument expects the document as JSON")
+	}
+	if ok, err := canReadTarget(stub, who, key); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.New("User is not authorized to attach documents to " + key)
+	}
+
+	document.SHA256 = strings.ToLower(document.SHA256)
+	if hashBytes, err := hex.DecodeString(document.SHA256); err != nil || len(hashBytes) != 32 {
+		return nil, errors.New("sha256 should be the hex encoded SHA-256 of the document")
+	}
+	if document.Name == "" || document.StorageURI == "" {
+		return nil, errors.New("Document name and storageURI are required")
+	}
+	document.Uploader = who
+	if now, ok := txTime(stub); ok {
+		document.Timestamp = now.Format(time.RFC3339)
+	} else if _, err := time.Parse(time.RFC3339, document.Timestamp); err != nil {
+		return nil, errors.New("Document timestamp should be an RFC 3339 time")
+	}
+
+	documents, err := getDocuments(stub, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range documents {
+		if existing.SHA256 == document.SHA256 {
+			return nil, errors.New("Document " + document.SHA256 + " is already attached to " + key)
+		}
+	}
+	documents = append(documents, document)
+	bytesToStore, _ := canonicalJSON(documents)
+	if err := stub.PutState(DOCUMENT_PREFIX+key, bytesToStore); err != nil {
+		return nil, err
+	}
+	logger.Info("attachDocument anchored " + document.Name + " on " + key)
+	outputBytes, _ := canonicalJSON(document)
+	return outputBytes, nil
+}
+
+//ListDocuments Returns the documents anchored on a UFA or invoice. args
+//are who and the UFA or invoice number, like attachDocument
+func ListDocuments(stub Store, args []string) ([]byte, error) {
+	logger.Info("listDocuments called")
+	if len(args) < 2 {
+		return nil, errors.New("listDocuments expects who and the UFA or invoice number")
+	}
+	who := caller(stub, args[0])
+	key := args[1]
+	if ok, err := canReadTarget(stub, who, key); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.New("User is not authorized to read the documents of " + key)
+	}
+	documents, err := getDocuments(stub, key)
+	if err != nil {
+		return nil, err
+	}
+	outputBytes, _ := canonicalJSON(documents)
+	return outputBytes, nil
+}
+
+//VerifyDocument checks a document hash against the ones anchored on a UFA
+//or invoice. args are who, the UFA or invoice number and the hex SHA-256
+//of the document
+func VerifyDocument(stub Store, args []string) ([]byte, error) {
+	logger.Info("verifyDocument called")
+	if len(args) < 3 {
+		return nil, errors.New("verifyDocument expects who, the UFA or invoice number and the SHA-256 of the document")
+	}
+	who := caller(stub, args[0])
+	key := args[1]
+	hash := strings.ToLower(args[2])
+	if ok, err := canReadTarget(stub, who, key); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.New("User is not authorized to read the documents of " + key)
+	}
+	documents, err := getDocuments(stub, key)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{"key": key, "sha256": hash, "verified": false}
+	for _, document := range documents {
+		if document.SHA256 == hash {
+			result["verified"] = true
+			result["document"] = document
+			break
+		}
+	}
+	outputBytes, _ := canonicalJSON(result)
+	return outputBytes, nil
+}
@@ -0,0 +1,58 @@
+package ufa
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+//Returns the metadata of a document named after its content
+func testDocument(name string) Document {
+	sum := sha256.Sum256([]byte(name))
+	return Document{Name: name, Type: "application/pdf", SHA256: hex.EncodeToString(sum[:]), StorageURI: "s3://docs/" + name}
+}
+
+func TestAttachDocument(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", newUFA())
+	raisePair(t, s, newInvoicePair("U1", "2016-01", "100"))
+	contract := testDocument("contract.pdf")
+
+	var attached Document
+	decode(t, s.mustCall(t, testSeller, "attachDocument", testSeller, "U1", toJSON(contract)), &attached)
+	if attached.Uploader != testSeller || attached.Timestamp != testNow.Format(time.RFC3339) {
+		t.Fatalf("attachDocument returned %+v", attached)
+	}
+	s.mustCall(t, testBuyer, "attachDocument", testBuyer, "U1-2016-01-C", toJSON(testDocument("invoice.pdf")))
+
+	s.mustFail(t, "is already attached to U1", testBuyer, "attachDocument", testBuyer, "U1", toJSON(contract))
+	s.mustFail(t, "not authorized to attach documents", testOutsider, "attachDocument", testOutsider, "U1", toJSON(testDocument("x.pdf")))
+	s.mustFail(t, "No UFA or invoice is stored under U9", testSeller, "attachDocument", testSeller, "U9", toJSON(contract))
+	noHash := testDocument("x.pdf")
+	noHash.SHA256 = "abc"
+	s.mustFail(t, "sha256 should be the hex encoded SHA-256", testSeller, "attachDocument", testSeller, "U1", toJSON(noHash))
+	noURI := testDocument("x.pdf")
+	noURI.StorageURI = ""
+	s.mustFail(t, "Document name and storageURI are required", testSeller, "attachDocument", testSeller, "U1", toJSON(noURI))
+	s.mustFail(t, "attachDocument expects", testSeller, "attachDocument", testSeller, "U1")
+
+	var documents []Document
+	decode(t, s.mustCall(t, testBuyer, "listDocuments", testBuyer, "U1"), &documents)
+	if len(documents) != 1 || documents[0].Name != "contract.pdf" {
+		t.Fatalf("listDocuments returned %+v", documents)
+	}
+	s.mustFail(t, "not authorized to read the documents", testOutsider, "listDocuments", testOutsider, "U1")
+
+	var result map[string]interface{}
+	decode(t, s.mustCall(t, testBuyer, "verifyDocument", testBuyer, "U1", contract.SHA256), &result)
+	if result["verified"] != true {
+		t.Fatalf("verifyDocument returned %v", result)
+	}
+	decode(t, s.mustCall(t, testBuyer, "verifyDocument", testBuyer, "U1", testDocument("other.pdf").SHA256), &result)
+	if result["verified"] != false {
+		t.Fatalf("verifyDocument of an unknown document returned %v", result)
+	}
+	s.mustFail(t, "verifyDocument expects", testBuyer, "verifyDocument", testBuyer, "U1")
+	s.mustFail(t, "listDocuments expects", testBuyer, "listDocuments", testBuyer)
+}
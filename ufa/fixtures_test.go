@@ -0,0 +1,162 @@
+package ufa
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+//ufaFixture builds UFA payloads. newUFA starts from a valid monthly UFA
+//between testSeller and testBuyer for 2016
+type ufaFixture map[string]string
+
+func newUFA() ufaFixture {
+	return ufaFixture{
+		"sellerName":       testSeller,
+		"buyerName":        testBuyer,
+		"netCharge":        "1000",
+		"chargTolrence":    "10",
+		"billingFrequency": "MONTHLY",
+		"startDate":        "2016-01-01",
+		"endDate":          "2016-12-31",
+	}
+}
+
+//Returns a copy of the UFA with the field set
+func (f ufaFixture) with(field string, value string) ufaFixture {
+	copied := make(ufaFixture, len(f)+1)
+	for key, v := range f {
+		copied[key] = v
+	}
+	copied[field] = value
+	return copied
+}
+
+//Returns a copy of the UFA without the field
+func (f ufaFixture) without(field string) ufaFixture {
+	copied := f.with(field, "")
+	delete(copied, field)
+	return copied
+}
+
+func (f ufaFixture) json() string {
+	return toJSON(f)
+}
+
+//invoiceFixture builds invoices. newInvoice starts from an invoice raised
+//by testSeller for testBuyer to approve
+type invoiceFixture map[string]string
+
+func newInvoice(ufanumber string, invoiceNumber string, billingPeriod string, amount string) invoiceFixture {
+	return invoiceFixture{
+		"ufanumber":     ufanumber,
+		"invoiceNumber": invoiceNumber,
+		"billingPeriod": billingPeriod,
+		"invoiceAmt":    amount,
+		"raisedBy":      testSeller,
+		"approverBy":    testBuyer,
+	}
+}
+
+//Returns a copy of the invoice with the field set
+func (f invoiceFixture) with(field string, value string) invoiceFixture {
+	copied := make(invoiceFixture, len(f)+1)
+	for key, v := range f {
+		copied[key] = v
+	}
+	copied[field] = value
+	return copied
+}
+
+//Returns the customer and vendor invoices of the period, numbered after
+//the UFA and the period
+func newInvoicePair(ufanumber string, billingPeriod string, amount string) []invoiceFixture {
+	return []invoiceFixture{
+		newInvoice(ufanumber, ufanumber+"-"+billingPeriod+"-C", billingPeriod, amount),
+		newInvoice(ufanumber, ufanumber+"-"+billingPeriod+"-V", billingPeriod, amount),
+	}
+}
+
+func toJSON(v interface{}) string {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(bytes)
+}
+
+//Returns a ledger initialized with the configuration, the defaults when
+//it is empty
+func newLedger(t *testing.T, config string) *mockStub {
+	t.Helper()
+	s := newMockStub()
+	if _, err := InitLedger(s, []string{config}); err != nil {
+		t.Fatalf("InitLedger failed: %v", err)
+	}
+	s.commit()
+	return s
+}
+
+//Creates the UFA as its seller
+func createUFA(t *testing.T, s *mockStub, ufanumber string, ufa ufaFixture) {
+	t.Helper()
+	s.mustCall(t, ufa["sellerName"], "createUFA", ufanumber, ufa["sellerName"], ufa.json())
+}
+
+//Raises the invoice pair as its raiser
+func raisePair(t *testing.T, s *mockStub, pair []invoiceFixture) {
+	t.Helper()
+	s.mustCall(t, pair[0]["raisedBy"], "createNewInvoices", pair[0]["raisedBy"], toJSON(pair))
+}
+
+//Returns the UFA as stored, nil when there is none
+func storedUFA(t *testing.T, s *mockStub, ufanumber string) map[string]string {
+	t.Helper()
+	record, err := readRecord(s, ufanumber, UFA_RECORD)
+	if err != nil {
+		t.Fatalf("reading UFA %s: %v", ufanumber, err)
+	}
+	return record
+}
+
+//Returns the invoice as stored, nil when there is none
+func storedInvoice(t *testing.T, s *mockStub, invoiceNumber string) map[string]string {
+	t.Helper()
+	record, err := readRecord(s, invoiceNumber, INVOICE_RECORD)
+	if err != nil {
+		t.Fatalf("reading invoice %s: %v", invoiceNumber, err)
+	}
+	return record
+}
+
+//Returns the JSON list stored under the key
+func storedList(t *testing.T, s *mockStub, key string) []string {
+	t.Helper()
+	list := make([]string, 0)
+	if recBytes := s.state[key]; recBytes != nil {
+		if err := json.Unmarshal(recBytes, &list); err != nil {
+			t.Fatalf("reading list %s: %v", key, err)
+		}
+	}
+	return list
+}
+
+//Decodes the output of a function into v
+func decode(t *testing.T, output []byte, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(output, v); err != nil {
+		t.Fatalf("decoding %s: %v", output, err)
+	}
+}
+
+//Fails the test when the lists differ
+func assertList(t *testing.T, what string, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s = %v, want %v", what, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s = %v, want %v", what, got, want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package ufa
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+//Fails the test when the raised total of the UFA is not a number or is
+//over its ceiling. Amounts are compared at the precision the ledger keeps
+//them, see roundAmount
+func assertWithinCeiling(t *testing.T, s *mockStub, ufanumber string) float64 {
+	t.Helper()
+	stored := storedUFA(t, s, ufanumber)
+	netCharge := validateNumber(stored["netCharge"])
+	maxCharge := netCharge + netCharge*validateNumber(stored["chargTolrence"])/100.0
+	raisedInvTotal := validateNumber(stored["raisedInvTotal"])
+	if raisedInvTotal < 0 || raisedInvTotal > roundAmount(maxCharge) {
+		t.Fatalf("raisedInvTotal of %s is %q with netCharge %s and chargTolrence %s", ufanumber,
+			stored["raisedInvTotal"], stored["netCharge"], stored["chargTolrence"])
+	}
+	return raisedInvTotal
+}
+
+func FuzzCreateUFA(f *testing.F) {
+	f.Add(newUFA().json())
+	f.Add(newUFA().with("netCharge", "1e308").with("chargTolrence", "50").json())
+	f.Add(newUFA().with("netCharge", "NaN").json())
+	f.Add(newUFA().with("chargTolrence", "-Inf").json())
+	f.Add(newUFA().with("raisedInvTotal", "5000").json())
+	f.Add(newUFA().with("startDate", "2016-13-01").json())
+	f.Add(`[{"ufanumber":"U1"}]`)
+	f.Add(`{"ufanumber":1}`)
+	f.Add(``)
+	f.Fuzz(func(t *testing.T, payload string) {
+		s := newLedger(t, "")
+		before := len(s.state)
+		if _, err := s.call(testSeller, "createUFA", "U1", testSeller, payload); err != nil {
+			if len(s.state) != before {
+				t.Fatalf("failed createUFA left %v", s.keys())
+			}
+			return
+		}
+		stored := storedUFA(t, s, "U1")
+		if stored == nil || stored["raisedInvTotal"] != "0" || stored["ufaStatus"] != UFA_ACTIVE {
+			t.Fatalf("createUFA stored %v", stored)
+		}
+		if validateNumber(stored["netCharge"]) <= 0 {
+			t.Fatalf("createUFA accepted netCharge %q", stored["netCharge"])
+		}
+		assertWithinCeiling(t, s, "U1")
+		assertList(t, "UFA master list", storedList(t, s, ALL_ELEMENENTS), "U1")
+	})
+}
+
+func FuzzCreateNewInvoices(f *testing.F) {
+	f.Add(toJSON(newInvoicePair("U1", "2016-01", "1100")))
+	f.Add(toJSON(newInvoicePair("U1", "2016-01", "1100.01")))
+	f.Add(toJSON(newInvoicePair("U1", "2016-01", "-100")))
+	f.Add(toJSON(newInvoicePair("U1", "2016-01", "NaN")))
+	f.Add(toJSON(newInvoicePair("U1", "2016-01", "1e400")))
+	f.Add(toJSON(newInvoicePair("U1", "2016-01", "0x10")))
+	f.Add(toJSON(append(newInvoicePair("U1", "2016-01", "600"), newInvoicePair("U1", "2016-02", "600")...)))
+	f.Add(toJSON(newInvoicePair("U1", "2016-02", "400")[:1]))
+	f.Add(`{"ufanumber":"U1"}`)
+	f.Add(`[null,null]`)
+	f.Fuzz(func(t *testing.T, payload string) {
+		s := newLedger(t, "")
+		createUFA(t, s, "U1", newUFA())
+		raisePair(t, s, newInvoicePair("U1", "2016-01", "100"))
+		before := len(s.state)
+		if _, err := s.call(testSeller, "createNewInvoices", testSeller, payload); err != nil {
+			if len(s.state) != before {
+				t.Fatalf("failed createNewInvoices left %v", s.keys())
+			}
+			return
+		}
+		raisedInvTotal := assertWithinCeiling(t, s, "U1")
+		var invoiceList []map[string]string
+		json.Unmarshal([]byte(payload), &invoiceList)
+		if want := roundAmount(100 + validateNumber(invoiceList[0]["invoiceAmt"])); raisedInvTotal != want {
+			t.Fatalf("raisedInvTotal = %v, want %v", raisedInvTotal, want)
+		}
+		if len(storedList(t, s, UFA_INVOICE_PREFIX+"U1")) != 4 || len(storedList(t, s, ALL_INVOICES)) != 4 {
+			t.Fatalf("invoice lists after createNewInvoices: %v", s.keys())
+		}
+	})
+}
+
+func FuzzValidateNumber(f *testing.F) {
+	for _, seed := range []string{"0", "1000", "-1", "1e309", "NaN", "+Inf", "-inf", "0x1p-2", "1_000", " 1", ""} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, str string) {
+		number := validateNumber(str)
+		if math.IsNaN(number) || math.IsInf(number, 0) {
+			t.Fatalf("validateNumber(%q) = %v", str, number)
+		}
+		if parsed, err := strconv.ParseFloat(str, 64); err != nil && number != -1 {
+			t.Fatalf("validateNumber(%q) = %v for a string which is not a number", str, number)
+		} else if err == nil && !math.IsNaN(parsed) && !math.IsInf(parsed, 0) && number != parsed {
+			t.Fatalf("validateNumber(%q) = %v, want %v", str, number, parsed)
+		}
+	})
+}
+
+//Returns an amount to invoice given the headroom left under the ceiling:
+//often right at the edge of it, sometimes just over, sometimes anywhere
+func randomAmount(r *rand.Rand, headroom float64) string {
+	cents := math.Floor(headroom * 100)
+	switch r.Intn(5) {
+	case 0:
+		return strconv.FormatFloat(cents/100, 'f', 2, 64)
+	case 1:
+		return strconv.FormatFloat((cents+1)/100, 'f', 2, 64)
+	case 2:
+		return strconv.FormatFloat(float64(r.Intn(int(cents)+2))/100, 'f', 2, 64)
+	case 3:
+		return strconv.FormatFloat(r.Float64()*headroom*1.5, 'f', -1, 64)
+	}
+	return []string{"-1", "0", "NaN", "1e309", "abc"}[r.Intn(5)]
+}
+
+//raisedInvTotal never exceeds netCharge*(1+chargTolrence/100) and is the
+//sum of the invoices raised, whatever invoices are sent and however they
+//are batched
+func TestRaisedTotalWithinCeiling(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 50; trial++ {
+		s := newLedger(t, `{"maxTolerance":50}`)
+		netCharge := float64(1+r.Intn(10000000)) / 100
+		tolerance := r.Intn(51)
+		createUFA(t, s, "U1", newUFA().with("netCharge", strconv.FormatFloat(netCharge, 'f', 2, 64)).
+			with("chargTolrence", strconv.Itoa(tolerance)))
+		maxCharge := netCharge + netCharge*float64(tolerance)/100.0
+
+		raised := 0.0
+		for step := 0; step < 20; step++ {
+			var pairs [][]invoiceFixture
+			for i, count := 0, 1+r.Intn(3); i < count; i++ {
+				period := "2016-" + []string{"01", "02", "03", "04", "05", "06", "07", "08", "09", "10", "11", "12"}[r.Intn(12)]
+				pair := newInvoicePair("U1", period, randomAmount(r, maxCharge-raised))
+				for j, invoice := range pair {
+					invoice["invoiceNumber"] = "I" + strconv.Itoa(step) + "-" + strconv.Itoa(i) + "-" + strconv.Itoa(j)
+				}
+				pairs = append(pairs, pair)
+			}
+
+			before := storedList(t, s, ALL_INVOICES)
+			if len(pairs) == 1 {
+				s.call(testSeller, "createNewInvoices", testSeller, toJSON(pairs[0]))
+			} else {
+				s.call(testSeller, "batchCreateInvoices", testSeller, toJSON(pairs), []string{BULK_ALL_OR_NOTHING, BULK_BEST_EFFORT}[r.Intn(2)])
+			}
+			for _, invoiceNumber := range storedList(t, s, ALL_INVOICES)[len(before):] {
+				if invoice := storedInvoice(t, s, invoiceNumber); invoiceNumber[len(invoiceNumber)-1] == '0' {
+					raised = roundAmount(raised + validateNumber(invoice["invoiceAmt"]))
+				}
+			}
+
+			if got := assertWithinCeiling(t, s, "U1"); got != raised {
+				t.Fatalf("trial %d step %d: raisedInvTotal = %v, invoices raised total %v", trial, step, got, raised)
+			}
+		}
+	}
+}
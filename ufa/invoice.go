@@ -0,0 +1,405 @@
+package ufa
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+//INVOICE_APPROVED Status of an approved invoice
+const INVOICE_APPROVED = "APPROVED"
+
+//INVOICE_PAID Status of a paid invoice
+const INVOICE_PAID = "PAID"
+
+//Fields of an invoice set by the ledger, approveInvoice or payInvoice,
+//which updateInvoices cannot change
+var ledgerInvoiceFields = []string{"invoiceStatus", RAISER_SIGNATURE_FIELD, APPROVER_SIGNATURE_FIELD, SCHEMA_VERSION_FIELD, PRIVATE_HASH_FIELD,
+	"paidAmt", "paidDate"}
+
+//Fields of an invoice fixed when it is raised, as the tolerance check and
+//the raised total of the UFA depend on them
+var raisedInvoiceFields = []string{"invoiceNumber", "ufanumber", "billingPeriod", "invoiceAmt", "raisedBy", "approverBy"}
+
+//GetInvoices Retrives all the invoices for a ufa
+func GetInvoices(stub Store, args []string) ([]byte, error) {
+	logger.Info("getInvoices called")
+	if len(args) < 1 {
+		return nil, errors.New("getInvoices expects the UFA number")
+	}
+	ufanumber := args[0]
+	if _, err := readUFAFor(stub, caller(stub, argAt(args, 1)), ufanumber); err != nil {
+		return nil, err
+	}
+	invoices := getInvoicesForUFA(stub, ufanumber)
+	outputBytes, _ := canonicalJSON(invoices)
+	logger.Info("getInvoices returning " + strconv.Itoa(len(invoices)) + " invoices")
+	return outputBytes, nil
+}
+
+//GetInvoiceDetails Retrives an ivoice
+func GetInvoiceDetails(stub Store, args []string) ([]byte, error) {
+	if len(args) < 1 {
+		return nil, errors.New("getInvoiceDetails expects the invoice number")
+	}
+	logger.Info("getInvoiceDetails called with UFA number: " + args[0])
+
+	invoiceNumber := args[0] //UFA ufanum
+	who := caller(stub, argAt(args, 1))
+	outputRecord, _ := readRecord(stub, invoiceNumber, INVOICE_RECORD)
+	config, _ := getConfig(stub)
+	if outputRecord != nil && !canReadInvoice(stub, config, who, outputRecord) {
+		return nil, errors.New("User is not authorized to read invoice " + invoiceNumber)
+	}
+	outputBytes, _ := canonicalJSON(outputRecord)
+	logger.Info("Returning records from getInvoiceDetails " + invoiceNumber)
+	return outputBytes, nil
+}
+
+//CreateNewInvoices Create new invoices
+func CreateNewInvoices(stub Store, args []string) ([]byte, error) {
+	logger.Info("createNewInvoice called")
+	if len(args) < 2 {
+		return nil, errors.New("createNewInvoices expects who and the invoices as JSON")
+	}
+	who := caller(stub, args[0])
+	payload, err := withTransientFields(stub, args[1])
+	if err != nil {
+		return nil, err
+	}
+	if payload, err = raisedInvoices(stub, who, payload); err != nil {
+		return nil, err
+	}
+	args = []string{who, payload}
+	//First validate the inputs
+	validationMessag := ValidateInvoiceDetails(stub, args)
+	if validationMessag == "" {
+		var invoiceList []map[string]string
+		json.Unmarshal([]byte(payload), &invoiceList)
+		//Get the customer invoice
+		custInvoice := invoiceList[0]
+		//Get the vendor invoice
+		vendInvoice := invoiceList[1]
+		//Get the ufa details
+		ufanumber := custInvoice["ufanumber"]
+		//who :=args[1] //Role
+		//Get the ufaDetails
+		ufaDetails, _ := readRecord(stub, ufanumber, UFA_RECORD)
+		//Calculate the updated invoide total
+		raisedInvTotal := validateNumber(ufaDetails["raisedInvTotal"])
+		invAmt := validateNumber(invoiceList[0]["invoiceAmt"])
+		newRaisedTotal := roundAmount(raisedInvTotal + invAmt)
+		//Raise the alerts for the thresholds this invoice crosses
+		config, _ := getConfig(stub)
+		alerts := utilizationAlerts(config, ufanumber, validateNumber(ufaDetails["netCharge"]), raisedInvTotal, newRaisedTotal)
+		for i := range alerts {
+			alerts[i].InvoiceNumber = custInvoice["invoiceNumber"]
+			alerts[i].BillingPeriod = custInvoice["billingPeriod"]
+		}
+		if err := recordAlerts(stub, ufanumber, alerts); err != nil {
+			return nil, err
+		}
+
+		writeRecord(stub, custInvoice["invoiceNumber"], INVOICE_RECORD, newRecord(INVOICE_RECORD, custInvoice))
+		writeRecord(stub, vendInvoice["invoiceNumber"], INVOICE_RECORD, newRecord(INVOICE_RECORD, vendInvoice))
+		//Append the invoice numbers to ufa details
+		addInvoiceRecordsToUFA(stub, ufanumber, custInvoice["invoiceNumber"], vendInvoice["invoiceNumber"])
+		//Update the master records
+		updateInventoryMasterRecords(stub, custInvoice["invoiceNumber"], vendInvoice["invoiceNumber"])
+		//Update the original ufa details
+		logger.Info("createNewInvoice updating  the UFA details")
+		return nil, updateRaisedTotal(stub, ufanumber, newRaisedTotal)
+
+	} else {
+		return nil, errors.New("CreateNewInvoice Validation failure: " + validationMessag)
+	}
+
+}
+
+//Returns the invoices recorded as raised by who, failing unless who is
+//the seller of their UFA or an admin. Invoices which do not decode or name
+//no known UFA are left to the validation
+func raisedInvoices(stub Store, who string, payload string) (string, error) {
+	var invoiceList []map[string]string
+	if err := json.Unmarshal([]byte(payload), &invoiceList); err != nil || len(invoiceList) == 0 {
+		return payload, nil
+	}
+	ufanumber := invoiceList[0]["ufanumber"]
+	if ufaDetails, _ := readRecord(stub, ufanumber, UFA_RECORD); ufaDetails != nil {
+		if !isAdmin(stub, who) && ufaRole(who, ufaDetails) != SELLER_ROLE {
+			return "", errors.New("User is not authorized to raise invoices for " + ufanumber)
+		}
+	}
+	for _, invoice := range invoiceList {
+		if invoice != nil {
+			invoice["raisedBy"] = who
+		}
+	}
+	payloadBytes, err := json.Marshal(invoiceList)
+	if err != nil {
+		return "", err
+	}
+	return string(payloadBytes), nil
+}
+
+//ValidateInvoiceDetails Validate Invoice
+func ValidateInvoiceDetails(stub Store, args []string) string {
+
+	logger.Info("validateInvoice called")
+	var validationMessage bytes.Buffer
+	//who := args[0]
+	payload := argAt(args, 1)
+	//I am assuming the payload will be an array of Invoices
+	//Once for cusotmer and another for vendor
+	//Checking only one would be sufficient from the amount perspective
+	var invoiceList []map[string]string
+	json.Unmarshal([]byte(payload), &invoiceList)
+	if len(invoiceList) < 2 {
+		validationMessage.WriteString("\nInvoice is missing for Customer or Vendor")
+	} else {
+		//Get the UFA number
+		ufanumber := invoiceList[0]["ufanumber"]
+		//Get the ufa details and the invoices raised so far
+		projection := loadProjection(stub, ufanumber)
+		if projection == nil {
+			validationMessage.WriteString("\nInvalid UFA provided")
+		} else {
+			config, _ := getConfig(stub)
+			for _, violation := range checkInvoicePair(stub, config, projection, invoiceList[0], invoiceList[1]) {
+				validationMessage.WriteString("\n" + violation.Message)
+			}
+		} // Invalid UFA number
+	} // End of length of invoics
+	finalMessage := validationMessage.String()
+	logger.Info("validateInvoice Validation message generated :" + finalMessage)
+	return finalMessage
+}
+
+//Checking if invoice is already raised or not
+func checkInvoicesRaised(stub Store, ufaNumber string, billingPeriod string) bool {
+
+	var isAvailable = false
+	logger.Info("checkInvoicesRaised started for :" + ufaNumber + " : Billing month " + billingPeriod)
+	allInvoices := getInvoicesForUFA(stub, ufaNumber)
+	if len(allInvoices) > 0 {
+		for _, invoiceDetails := range allInvoices {
+			logger.Info("checkInvoicesRaised checking for invoice number :" + invoiceDetails["invoiceNumber"])
+			if invoiceDetails["billingPeriod"] == billingPeriod {
+				isAvailable = true
+				break
+			}
+		}
+	}
+	return isAvailable
+}
+
+//Returns all the invoices raised for an UFA
+func getInvoicesForUFA(stub Store, ufanumber string) []map[string]string {
+	logger.Info("getInvoicesForUFA called")
+	var outputRecords []map[string]string
+	outputRecords = make([]map[string]string, 0)
+
+	recordsList, err := getAllInvloiceList(stub, ufanumber)
+	if err == nil {
+		for _, invoiceNumber := range recordsList {
+			logger.Info("getInvoicesForUFA: Processing record " + ufanumber)
+			record, _ := readRecord(stub, invoiceNumber, INVOICE_RECORD)
+			outputRecords = append(outputRecords, record)
+		}
+
+	}
+
+	logger.Info("Returning records from getInvoicesForUFA ")
+	return outputRecords
+}
+
+//UpdateInvoices Update the fields of existing invoices. args are who and
+//the changes as a JSON array, each naming its invoiceNumber. who must have
+//raised the invoice, be a party of its UFA or an admin. The status and the
+//signatures only change through approveInvoice, the payment through
+//payInvoice, and the fields in raisedInvoiceFields not at all. Approved
+//invoices are final, and an invoice signed by its raiser keeps the fields
+//the signature covers
+func UpdateInvoices(stub Store, args []string) ([]byte, error) {
+	var inputData []map[string]string
+
+	logger.Info("updateInvoices called ")
+	if len(args) < 2 {
+		return nil, errors.New("updateInvoices expects who and the invoices as JSON")
+	}
+	who := caller(stub, args[0])
+	payload := args[1]
+
+	if err := json.Unmarshal([]byte(payload), &inputData); err != nil {
+		return nil, errors.New("updateInvoices expects a JSON array of invoices")
+	}
+	for _, invoiceDataFields := range inputData {
+		invoiceNumber := invoiceDataFields["invoiceNumber"]
+		logger.Info("updateInvoices going to get details of invoice " + invoiceNumber)
+
+		existingRecMap, err := readRecord(stub, invoiceNumber, INVOICE_RECORD)
+		if err != nil || existingRecMap == nil {
+			return nil, errors.New("Invalid invoice provided " + invoiceNumber)
+		}
+		ufaDetails, _ := readRecord(stub, existingRecMap["ufanumber"], UFA_RECORD)
+		if !isAdmin(stub, who) && (who == "" || who != existingRecMap["raisedBy"]) && (ufaDetails == nil || ufaRole(who, ufaDetails) == "") {
+			return nil, errors.New("User is not authorized to update invoice " + invoiceNumber)
+		}
+		if status := existingRecMap["invoiceStatus"]; status == INVOICE_APPROVED || status == INVOICE_PAID {
+			return nil, errors.New("Invoice " + invoiceNumber + " is approved and cannot be changed")
+		}
+		if valMsg := validateClientFields(invoiceDataFields, ledgerInvoiceFields); valMsg != "" {
+			return nil, errors.New("Validation failure: " + valMsg)
+		}
+		for _, field := range raisedInvoiceFields {
+			if value, ok := invoiceDataFields[field]; ok && value != existingRecMap[field] {
+				return nil, errors.New("Field " + field + " of invoice " + invoiceNumber + " is set when it is raised and cannot be changed")
+			}
+		}
+		signature := existingRecMap[RAISER_SIGNATURE_FIELD]
+		updateRecord(existingRecMap, invoiceDataFields)
+		if signature != "" {
+			if err := verifySignature(stub, existingRecMap["raisedBy"], RaiserSigningBytes(existingRecMap), signature); err != nil {
+				return nil, errors.New("Invoice " + invoiceNumber + " is signed by its raiser and the update would void the signature")
+			}
+		}
+		writeRecord(stub, invoiceNumber, INVOICE_RECORD, existingRecMap)
+	}
+
+	return nil, nil
+}
+
+//ApproveInvoice Marks an invoice as approved. When the invoice names an
+//approver only that user can approve it, otherwise the buyer of the UFA
+//or an admin. The optional third argument is the signature of the
+//approver over ApproverSigningBytes
+func ApproveInvoice(stub Store, args []string) ([]byte, error) {
+	logger.Info("approveInvoice called")
+	if len(args) < 2 {
+		return nil, errors.New("approveInvoice expects who and the invoice number")
+	}
+	who := caller(stub, args[0])
+	invoiceNumber := args[1]
+	signature := argAt(args, 2)
+
+	record, err := readRecord(stub, invoiceNumber, INVOICE_RECORD)
+	if err != nil || record == nil {
+		return nil, errors.New("Invalid invoice provided " + invoiceNumber)
+	}
+	authorized := who != "" && record["approverBy"] == who
+	if record["approverBy"] == "" {
+		ufaDetails, _ := readRecord(stub, record["ufanumber"], UFA_RECORD)
+		authorized = isAdmin(stub, who) || (ufaDetails != nil && ufaRole(who, ufaDetails) == BUYER_ROLE)
+	}
+	if !authorized {
+		return nil, errors.New("User is not authorized to approve invoice " + invoiceNumber)
+	}
+	if status := record["invoiceStatus"]; status == INVOICE_APPROVED || status == INVOICE_PAID {
+		return nil, errors.New("Invoice " + invoiceNumber + " is already approved")
+	}
+	record["approverBy"] = who
+	config, _ := getConfig(stub)
+	if signature != "" {
+		if err := verifySignature(stub, who, ApproverSigningBytes(record), signature); err != nil {
+			return nil, err
+		}
+		record[APPROVER_SIGNATURE_FIELD] = signature
+	} else if config.RequireInvoiceSignatures {
+		return nil, errors.New("Approval of invoice " + invoiceNumber + " is not signed")
+	}
+	record["invoiceStatus"] = INVOICE_APPROVED
+	writeRecord(stub, invoiceNumber, INVOICE_RECORD, record)
+	outputBytes, _ := canonicalJSON(record)
+	return outputBytes, nil
+}
+
+//PayInvoice Records a payment against an approved invoice. args are who,
+//the invoice number and the amount paid. who must be the buyer of the UFA
+//or an admin. The payment adds to paidAmt, which cannot exceed the
+//invoice amount, and the invoice is PAID once it is settled
+func PayInvoice(stub Store, args []string) ([]byte, error) {
+	logger.Info("payInvoice called")
+	if len(args) < 3 {
+		return nil, errors.New("payInvoice expects who, the invoice number and the amount paid")
+	}
+	who := caller(stub, args[0])
+	invoiceNumber := args[1]
+	record, err := readRecord(stub, invoiceNumber, INVOICE_RECORD)
+	if err != nil || record == nil {
+		return nil, errors.New("Invalid invoice provided " + invoiceNumber)
+	}
+	ufaDetails, _ := readRecord(stub, record["ufanumber"], UFA_RECORD)
+	if !isAdmin(stub, who) && (ufaDetails == nil || ufaRole(who, ufaDetails) != BUYER_ROLE) {
+		return nil, errors.New("User is not authorized to pay invoice " + invoiceNumber)
+	}
+	switch record["invoiceStatus"] {
+	case INVOICE_PAID:
+		return nil, errors.New("Invoice " + invoiceNumber + " is already paid")
+	case INVOICE_APPROVED:
+	default:
+		return nil, errors.New("Invoice " + invoiceNumber + " is not approved")
+	}
+	amount := validateNumber(args[2])
+	if amount <= 0 {
+		return nil, errors.New("Payment amount " + args[2] + " should be a number above zero")
+	}
+	invoiceAmt := roundAmount(validateNumber(record["invoiceAmt"]))
+	paidAmt := validateNumber(record["paidAmt"])
+	if paidAmt < 0 {
+		paidAmt = 0
+	}
+	paidAmt = roundAmount(paidAmt + amount)
+	if paidAmt > invoiceAmt {
+		return nil, errors.New("Payment of " + args[2] + " exceeds the balance of invoice " + invoiceNumber)
+	}
+	record["paidAmt"] = strconv.FormatFloat(paidAmt, 'f', -1, 64)
+	if now, ok := txTime(stub); ok {
+		record["paidDate"] = now.Format(reportDateLayout)
+	}
+	if paidAmt == invoiceAmt {
+		record["invoiceStatus"] = INVOICE_PAID
+	}
+	writeRecord(stub, invoiceNumber, INVOICE_RECORD, record)
+	outputBytes, _ := canonicalJSON(record)
+	return outputBytes, nil
+}
+
+//GetAllInvoicesForUsr Returns all the Invoice created so far for the interest parties
+func GetAllInvoicesForUsr(stub Store, args []string) ([]byte, error) {
+	logger.Info("getAllInvoicesForUsr called")
+	if len(args) < 1 {
+		return nil, errors.New("getAllInvoicesForUsr expects who")
+	}
+	who := caller(stub, args[0])
+
+	recordsList, err := getAllInvloiceFromMasterList(stub)
+	if err != nil {
+		return nil, errors.New("Unable to get all the inventory records ")
+	}
+	var outputRecords []map[string]string
+	outputRecords = make([]map[string]string, 0)
+	for _, invoiceNumber := range recordsList {
+		logger.Info("getAllInvoicesForUsr: Processing inventory record " + invoiceNumber)
+		record, _ := readRecord(stub, invoiceNumber, INVOICE_RECORD)
+		if who != "" && (record["approverBy"] == who || record["raisedBy"] == who) {
+			outputRecords = append(outputRecords, record)
+		}
+	}
+	outputBytes, _ := canonicalJSON(outputRecords)
+	logger.Info("getAllInvoicesForUsr returning " + strconv.Itoa(len(outputRecords)) + " invoices")
+	return outputBytes, nil
+}
+
+//ValidateNewInvoideData Validate the new Invoice created. Only the users
+//who can read the UFA learn how its invoices would fare
+func ValidateNewInvoideData(stub Store, args []string) []byte {
+	var invoiceList []map[string]string
+	json.Unmarshal([]byte(argAt(args, 1)), &invoiceList)
+	if len(invoiceList) > 0 {
+		if _, err := readUFAFor(stub, caller(stub, argAt(args, 0)), invoiceList[0]["ufanumber"]); err != nil {
+			return validationOutput("\n" + err.Error())
+		}
+	}
+	return validationOutput(ValidateInvoiceDetails(stub, args))
+}
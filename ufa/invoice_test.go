@@ -0,0 +1,314 @@
+package ufa
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCreateNewInvoices(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", newUFA())
+	createUFA(t, s, "U2", newUFA())
+
+	raisePair(t, s, newInvoicePair("U1", "2016-01", "100"))
+	raisePair(t, s, newInvoicePair("U2", "2016-01", "50"))
+	raisePair(t, s, newInvoicePair("U1", "2016-02", "100.5"))
+
+	customer := storedInvoice(t, s, "U1-2016-01-C")
+	if customer == nil || customer["invoiceAmt"] != "100" || customer[SCHEMA_VERSION_FIELD] == "" {
+		t.Fatalf("customer invoice stored as %v", customer)
+	}
+	if stored := storedUFA(t, s, "U1"); stored["raisedInvTotal"] != "200.5" {
+		t.Fatalf("raisedInvTotal = %q, want 200.5", stored["raisedInvTotal"])
+	}
+	assertList(t, "invoices of U1", storedList(t, s, UFA_INVOICE_PREFIX+"U1"),
+		"U1-2016-01-C", "U1-2016-01-V", "U1-2016-02-C", "U1-2016-02-V")
+	assertList(t, "invoices of U2", storedList(t, s, UFA_INVOICE_PREFIX+"U2"), "U2-2016-01-C", "U2-2016-01-V")
+	assertList(t, "invoice master list", storedList(t, s, ALL_INVOICES),
+		"U1-2016-01-C", "U1-2016-01-V", "U2-2016-01-C", "U2-2016-01-V", "U1-2016-02-C", "U1-2016-02-V")
+	assertList(t, "UFA master list", storedList(t, s, ALL_ELEMENENTS), "U1", "U2")
+	if history := storedList(t, s, UFA_TRXN_PREFIX+"U1"); len(history) != 3 {
+		t.Fatalf("history = %v, want the creation and two totals", history)
+	}
+}
+
+//Only the seller or an admin raises invoices, and always in their own name
+func TestCreateNewInvoicesAuthorization(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", newUFA())
+	pair := newInvoicePair("U1", "2016-01", "100")
+	for _, who := range []string{testOutsider, testBuyer, ""} {
+		s.mustFail(t, "not authorized to raise invoices for U1", who, "createNewInvoices", testSeller, toJSON(pair))
+	}
+	assertList(t, "invoice master list", storedList(t, s, ALL_INVOICES))
+
+	pair[0]["raisedBy"], pair[1]["raisedBy"] = testOutsider, testOutsider
+	s.mustCall(t, ADMIN_ROLE, "createNewInvoices", ADMIN_ROLE, toJSON(pair))
+	if invoice := storedInvoice(t, s, "U1-2016-01-C"); invoice["raisedBy"] != ADMIN_ROLE {
+		t.Fatalf("raisedBy = %q, want %q", invoice["raisedBy"], ADMIN_ROLE)
+	}
+}
+
+func TestValidateInvoiceDetails(t *testing.T) {
+	pair := newInvoicePair("U1", "2016-03", "100")
+	tests := []struct {
+		name     string
+		invoices []invoiceFixture
+		message  string
+	}{
+		{"valid pair", pair, ""},
+		{"single invoice", pair[:1], "Invoice is missing for Customer or Vendor"},
+		{"unknown UFA", newInvoicePair("U9", "2016-03", "100"), "Invalid UFA provided"},
+		{"amount mismatch", []invoiceFixture{pair[0], pair[1].with("invoiceAmt", "90")}, "Customer and Vendor Invoice Amounts are not same"},
+		{"unsupported currency", []invoiceFixture{pair[0].with("currency", "EUR"), pair[1]}, "Currency EUR is not supported"},
+		{"vendor on another UFA", []invoiceFixture{pair[0], pair[1].with("ufanumber", "U2")}, "Vendor invoice is raised against UFA U2"},
+		{"missing number", []invoiceFixture{pair[0].with("invoiceNumber", ""), pair[1]}, "invoiceNumber is missing"},
+		{"same numbers", []invoiceFixture{pair[0], pair[1].with("invoiceNumber", pair[0]["invoiceNumber"])}, "Customer and Vendor invoices are both numbered"},
+		{"existing number", []invoiceFixture{pair[0].with("invoiceNumber", "U1-2016-01-C"), pair[1]}, "Invoice U1-2016-01-C already exists"},
+		{"UFA number as invoice number", []invoiceFixture{pair[0].with("invoiceNumber", "U1"), pair[1]}, "Invoice U1 already exists"},
+		{"before the term", newInvoicePair("U1", "2015-12", "100"), "Invoice period 2015-12 is before the UFA starts"},
+		{"after the term", newInvoicePair("U1", "2017-01", "100"), "Invoice period 2017-01 is after the UFA ends"},
+		{"quarter within the term", newInvoicePair("U1", "2016-Q4", "100"), ""},
+		{"above the ceiling", newInvoicePair("U1", "2016-03", "1000.01"), "Total invoice amount exceeded"},
+		{"negative amount", newInvoicePair("U1", "2016-03", "-100"), "Invoice amount -100 is not a number of zero or more"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newLedger(t, "")
+			createUFA(t, s, "U1", newUFA())
+			raisePair(t, s, newInvoicePair("U1", "2016-01", "100"))
+			message := ValidateInvoiceDetails(s, []string{testSeller, toJSON(test.invoices)})
+			if test.message == "" && message != "" {
+				t.Fatalf("unexpected validation failure %q", message)
+			}
+			if !strings.Contains(message, test.message) {
+				t.Fatalf("validation message %q, want %q", message, test.message)
+			}
+		})
+	}
+}
+
+//An amount which is not a finite number counts as -1 and must not lower
+//the raised total
+func TestInvoiceAmountNotANumber(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", newUFA())
+	for _, amount := range []string{"NaN", "Inf", "-Inf", "1e309", "abc", ""} {
+		pair := newInvoicePair("U1", "2016-01", amount)
+		if _, err := s.call(testSeller, "createNewInvoices", testSeller, toJSON(pair)); err == nil {
+			stored := storedUFA(t, s, "U1")
+			t.Fatalf("invoice amount %q accepted, raisedInvTotal %q", amount, stored["raisedInvTotal"])
+		}
+	}
+}
+
+func TestDuplicateBillingPeriod(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", newUFA())
+	createUFA(t, s, "U2", newUFA())
+	raisePair(t, s, newInvoicePair("U1", "2016-01", "100"))
+
+	pair := newInvoicePair("U1", "2016-01", "100")
+	pair[0]["invoiceNumber"], pair[1]["invoiceNumber"] = "C2", "V2"
+	s.mustFail(t, "Invoices are already raised for 2016-01", testSeller, "createNewInvoices", testSeller, toJSON(pair))
+	if !checkInvoicesRaised(s, "U1", "2016-01") || checkInvoicesRaised(s, "U1", "2016-02") {
+		t.Fatal("checkInvoicesRaised does not match the invoices of U1")
+	}
+
+	//The period is only taken on the UFA invoiced
+	raisePair(t, s, newInvoicePair("U2", "2016-01", "100"))
+	raisePair(t, s, newInvoicePair("U1", "2016-02", "100"))
+}
+
+//The invoices of a UFA may reach its net charge plus the tolerance, and
+//not a cent more
+func TestToleranceCeiling(t *testing.T) {
+	tests := []struct {
+		netCharge string
+		tolerance string
+		amounts   []string
+		accepted  bool
+	}{
+		{"1000", "10", []string{"1100"}, true},
+		{"1000", "10", []string{"1100.01"}, false},
+		{"1000", "10", []string{"600", "500"}, true},
+		{"1000", "10", []string{"600", "500.01"}, false},
+		{"1000", "0", []string{"1000"}, true},
+		{"1000", "0", []string{"1000.000001"}, false},
+		{"100", "0", []string{"33.33", "33.33", "33.34"}, true},
+		{"100", "0", []string{"0.1", "0.2", "99.7"}, true},
+		{"0.3", "0", []string{"0.1", "0.2"}, true},
+		{"1000", "2.5", []string{"1025"}, true},
+		{"1000", "2.5", []string{"1025.01"}, false},
+	}
+	for _, test := range tests {
+		s := newLedger(t, "")
+		createUFA(t, s, "U1", newUFA().with("netCharge", test.netCharge).with("chargTolrence", test.tolerance))
+		var err error
+		for i, amount := range test.amounts {
+			pair := newInvoicePair("U1", "2016-0"+string(rune('1'+i)), amount)
+			if _, err = s.call(testSeller, "createNewInvoices", testSeller, toJSON(pair)); err != nil {
+				break
+			}
+		}
+		if test.accepted && err != nil {
+			t.Errorf("%v on %s +%s%% rejected: %v", test.amounts, test.netCharge, test.tolerance, err)
+		}
+		if !test.accepted && (err == nil || !strings.Contains(err.Error(), "Total invoice amount exceeded")) {
+			t.Errorf("%v on %s +%s%% not rejected for the ceiling: %v", test.amounts, test.netCharge, test.tolerance, err)
+		}
+	}
+}
+
+func TestUpdateInvoices(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", newUFA())
+	raisePair(t, s, newInvoicePair("U1", "2016-01", "100"))
+
+	s.mustCall(t, testSeller, "updateInvoices", testSeller, `[{"invoiceNumber":"U1-2016-01-C","note":"sent","invoiceAmt":"100"}]`)
+	s.mustCall(t, testBuyer, "updateInvoices", testBuyer, `[{"invoiceNumber":"U1-2016-01-V","note":"checked"}]`)
+	if stored := storedInvoice(t, s, "U1-2016-01-C"); stored["note"] != "sent" || stored["invoiceAmt"] != "100" {
+		t.Fatalf("update not applied: %v", stored)
+	}
+
+	//What the ceiling was checked on stays as raised
+	for _, change := range []string{`"invoiceAmt":"5000"`, `"ufanumber":"U2"`, `"billingPeriod":"2016-02"`, `"raisedBy":"X1"`, `"approverBy":"S1"`} {
+		s.mustFail(t, "is set when it is raised and cannot be changed", testSeller, "updateInvoices", testSeller,
+			`[{"invoiceNumber":"U1-2016-01-C",`+change+`}]`)
+	}
+	s.mustFail(t, "Field paidAmt is kept by the ledger", testSeller, "updateInvoices", testSeller, `[{"invoiceNumber":"U1-2016-01-C","paidAmt":"40"}]`)
+
+	s.mustFail(t, "Invalid invoice provided C9", testSeller, "updateInvoices", testSeller, `[{"invoiceNumber":"C9"}]`)
+	s.mustFail(t, "not authorized", testOutsider, "updateInvoices", testOutsider, `[{"invoiceNumber":"U1-2016-01-C","paidAmt":"100"}]`)
+	s.mustFail(t, "Field invoiceStatus is kept by the ledger", testSeller, "updateInvoices", testSeller, `[{"invoiceNumber":"U1-2016-01-C","invoiceStatus":"APPROVED"}]`)
+	s.mustFail(t, "expects a JSON array", testSeller, "updateInvoices", testSeller, `{}`)
+	s.mustFail(t, "updateInvoices expects", testSeller, "updateInvoices", testSeller)
+
+	s.mustCall(t, testBuyer, "approveInvoice", testBuyer, "U1-2016-01-C")
+	s.mustFail(t, "is approved and cannot be changed", testSeller, "updateInvoices", testSeller, `[{"invoiceNumber":"U1-2016-01-C","note":"paid"}]`)
+}
+
+func TestPayInvoice(t *testing.T) {
+	s := reportLedger(t)
+	s.mustFail(t, "is not approved", testBuyer, "payInvoice", testBuyer, "U1-2016-02-C", "100")
+	s.mustCall(t, testBuyer, "approveInvoice", testBuyer, "U1-2016-02-C")
+	s.mustFail(t, "not authorized to pay", testSeller, "payInvoice", testSeller, "U1-2016-02-C", "100")
+	s.mustFail(t, "should be a number above zero", testBuyer, "payInvoice", testBuyer, "U1-2016-02-C", "-1")
+	s.mustFail(t, "exceeds the balance", testBuyer, "payInvoice", testBuyer, "U1-2016-02-C", "300.01")
+	s.mustFail(t, "payInvoice expects", testBuyer, "payInvoice", testBuyer, "U1-2016-02-C")
+
+	var paid map[string]string
+	decode(t, s.mustCall(t, testBuyer, "payInvoice", testBuyer, "U1-2016-02-C", "100"), &paid)
+	if paid["paidAmt"] != "100" || paid["paidDate"] != "2016-06-15" || paid["invoiceStatus"] != INVOICE_APPROVED {
+		t.Fatalf("part payment recorded as %v", paid)
+	}
+	var rows []map[string]string
+	decode(t, s.mustCall(t, testBuyer, "exportReport", testBuyer, "outstanding", "json"), &rows)
+	if len(rows) != 4 || rows[0]["invoiceNumber"] != "U1-2016-02-C" || rows[0]["paidAmt"] != "100.00" || rows[0]["outstanding"] != "200.00" {
+		t.Fatalf("outstanding after a part payment %v", rows)
+	}
+
+	decode(t, s.mustCall(t, ADMIN_ROLE, "payInvoice", ADMIN_ROLE, "U1-2016-02-C", "200"), &paid)
+	if paid["paidAmt"] != "300" || paid["invoiceStatus"] != INVOICE_PAID {
+		t.Fatalf("settled invoice recorded as %v", paid)
+	}
+	decode(t, s.mustCall(t, testBuyer, "exportReport", testBuyer, "outstanding", "json"), &rows)
+	if len(rows) != 3 || rows[0]["invoiceNumber"] != "U1-2016-02-V" {
+		t.Fatalf("outstanding after the invoice is paid %v", rows)
+	}
+	s.mustFail(t, "is already paid", testBuyer, "payInvoice", testBuyer, "U1-2016-02-C", "1")
+	s.mustFail(t, "is already approved", testBuyer, "approveInvoice", testBuyer, "U1-2016-02-C")
+}
+
+func TestApproveInvoice(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", newUFA())
+	pair := newInvoicePair("U1", "2016-01", "100")
+	pair[1]["approverBy"] = ""
+	raisePair(t, s, pair)
+
+	s.mustFail(t, "not authorized to approve", testSeller, "approveInvoice", testSeller, "U1-2016-01-C")
+	s.mustFail(t, "not authorized to approve", "", "approveInvoice", testBuyer, "U1-2016-01-C")
+	var approved map[string]string
+	decode(t, s.mustCall(t, testBuyer, "approveInvoice", testBuyer, "U1-2016-01-C"), &approved)
+	if approved["invoiceStatus"] != INVOICE_APPROVED {
+		t.Fatalf("approveInvoice returned %v", approved)
+	}
+	s.mustFail(t, "is already approved", testBuyer, "approveInvoice", testBuyer, "U1-2016-01-C")
+	s.mustFail(t, "Invalid invoice provided", testBuyer, "approveInvoice", testBuyer, "C9")
+	s.mustFail(t, "approveInvoice expects", testBuyer, "approveInvoice", testBuyer)
+
+	//Without an approver named, the buyer or an admin approves and is
+	//recorded
+	s.mustFail(t, "not authorized to approve", testOutsider, "approveInvoice", testOutsider, "U1-2016-01-V")
+	s.mustFail(t, "not authorized to approve", testSeller, "approveInvoice", testSeller, "U1-2016-01-V")
+	s.mustCall(t, ADMIN_ROLE, "approveInvoice", ADMIN_ROLE, "U1-2016-01-V")
+	if stored := storedInvoice(t, s, "U1-2016-01-V"); stored["approverBy"] != ADMIN_ROLE || stored["invoiceStatus"] != INVOICE_APPROVED {
+		t.Fatalf("approval stored as %v", stored)
+	}
+}
+
+func TestGetInvoices(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", newUFA())
+	createUFA(t, s, "U2", newUFA().with("sellerName", "S2"))
+	raisePair(t, s, newInvoicePair("U1", "2016-01", "100"))
+	pair := newInvoicePair("U2", "2016-01", "100")
+	pair[0]["raisedBy"], pair[1]["raisedBy"] = "S2", "S2"
+	raisePair(t, s, pair)
+
+	var invoices []map[string]string
+	decode(t, s.mustCall(t, testBuyer, "getInvoices", "U1", testBuyer), &invoices)
+	if len(invoices) != 2 || invoices[0]["invoiceNumber"] != "U1-2016-01-C" {
+		t.Fatalf("getInvoices returned %v", invoices)
+	}
+	s.mustFail(t, "not authorized", testOutsider, "getInvoices", "U1", testOutsider)
+
+	var invoice map[string]string
+	decode(t, s.mustCall(t, testSeller, "getInvoiceDetails", "U1-2016-01-V", testSeller), &invoice)
+	if invoice["billingPeriod"] != "2016-01" {
+		t.Fatalf("getInvoiceDetails returned %v", invoice)
+	}
+	s.mustFail(t, "not authorized to read invoice", testOutsider, "getInvoiceDetails", "U1-2016-01-V", testOutsider)
+
+	decode(t, s.mustCall(t, testSeller, "getAllInvoicesForUsr", testSeller), &invoices)
+	if len(invoices) != 2 {
+		t.Fatalf("seller sees %d invoices, want 2", len(invoices))
+	}
+	decode(t, s.mustCall(t, testBuyer, "getAllInvoicesForUsr", testBuyer), &invoices)
+	if len(invoices) != 4 {
+		t.Fatalf("buyer approving every invoice sees %d, want 4", len(invoices))
+	}
+	decode(t, s.mustCall(t, "", "getAllInvoicesForUsr", ""), &invoices)
+	if len(invoices) != 0 {
+		t.Fatalf("unknown submitter sees %v", invoices)
+	}
+}
+
+func TestValidateNewInvoideData(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", newUFA())
+	var result map[string]string
+	decode(t, s.mustCall(t, testSeller, "validateNewInvoideData", testSeller, toJSON(newInvoicePair("U1", "2016-01", "100"))), &result)
+	if result["validation"] != "Success" {
+		t.Fatalf("valid pair reported as %v", result)
+	}
+	decode(t, s.mustCall(t, testSeller, "validateNewInvoideData", testSeller, toJSON(newInvoicePair("U1", "2016-01", "5000"))), &result)
+	if result["validation"] != "Failure" || !strings.Contains(result["msg"], "Total invoice amount exceeded") {
+		t.Fatalf("pair above the ceiling reported as %v", result)
+	}
+	decode(t, s.mustCall(t, testOutsider, "validateNewInvoideData", testSeller, toJSON(newInvoicePair("U1", "2016-01", "5000"))), &result)
+	if result["validation"] != "Failure" || result["msg"] != "\nUser is not authorized to read UFA U1" {
+		t.Fatalf("outsider validating a pair got %v", result)
+	}
+}
+
+//A UFA past its end date takes no invoices, whatever period they name
+func TestInvoicesAfterTheTerm(t *testing.T) {
+	s := newLedger(t, "")
+	s.now = testNow.AddDate(0, -3, 0)
+	createUFA(t, s, "U1", newUFA().with("endDate", "2016-03-31"))
+	raisePair(t, s, newInvoicePair("U1", "2016-03", "100"))
+	s.now = testNow
+	s.mustFail(t, "UFA ended on 2016-03-31", testSeller, "createNewInvoices", testSeller, toJSON(newInvoicePair("U1", "2016-02", "100")))
+}
@@ -0,0 +1,210 @@
+package ufa
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+//Names used by the fixtures
+const (
+	testSeller   = "S1"
+	testBuyer    = "B1"
+	testOutsider = "X1"
+)
+
+//Transaction time the tests run at unless they change it
+var testNow = time.Date(2016, 6, 15, 10, 0, 0, 0, time.UTC)
+
+type quietLogger struct{}
+
+func (quietLogger) Info(args ...interface{}) {}
+
+func TestMain(m *testing.M) {
+	SetLogger(quietLogger{})
+	os.Exit(m.Run())
+}
+
+//Event set by a transaction
+type mockEvent struct {
+	name    string
+	payload []byte
+}
+
+//mockStub stands in for the Fabric stub. As on a peer, the writes of a
+//transaction are buffered until it commits, so its reads do not see them,
+//and a transaction returning an error leaves the state unchanged. It knows
+//the submitter, the transaction time and the transient map, keeps private
+//data and records the events.
+//
+//The shimtest stub used by the chaincode tests is not used here: it
+//applies writes at once, so a transaction reads its own writes and keeps
+//them when it fails, and it would make the rules depend on Fabric. The
+//scenario MemLedger imports this package, so it cannot serve its tests
+type mockStub struct {
+	state   map[string][]byte
+	private map[string]map[string][]byte
+	//Writes of the running transaction, a nil value deletes the key
+	writes        map[string][]byte
+	privateWrites map[string]map[string][]byte
+	event         *mockEvent
+
+	//Submitter of the transaction, empty when it has no usable identity
+	creator   string
+	now       time.Time
+	transient map[string][]byte
+	//Events of the committed transactions, oldest first
+	events []mockEvent
+}
+
+func newMockStub() *mockStub {
+	return &mockStub{
+		state:         make(map[string][]byte),
+		private:       make(map[string]map[string][]byte),
+		writes:        make(map[string][]byte),
+		privateWrites: make(map[string]map[string][]byte),
+		now:           testNow,
+	}
+}
+
+func (s *mockStub) GetState(key string) ([]byte, error) {
+	return s.state[key], nil
+}
+
+func (s *mockStub) PutState(key string, value []byte) error {
+	if value == nil {
+		return errors.New("PutState needs a value for " + key)
+	}
+	s.writes[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (s *mockStub) DelState(key string) error {
+	s.writes[key] = nil
+	return nil
+}
+
+func (s *mockStub) GetPrivateData(collection string, key string) ([]byte, error) {
+	return s.private[collection][key], nil
+}
+
+func (s *mockStub) PutPrivateData(collection string, key string, value []byte) error {
+	if s.privateWrites[collection] == nil {
+		s.privateWrites[collection] = make(map[string][]byte)
+	}
+	s.privateWrites[collection][key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (s *mockStub) DelPrivateData(collection string, key string) error {
+	if s.privateWrites[collection] == nil {
+		s.privateWrites[collection] = make(map[string][]byte)
+	}
+	s.privateWrites[collection][key] = nil
+	return nil
+}
+
+func (s *mockStub) GetTransient() (map[string][]byte, error) {
+	return s.transient, nil
+}
+
+func (s *mockStub) SetEvent(name string, payload []byte) error {
+	s.event = &mockEvent{name, payload}
+	return nil
+}
+
+func (s *mockStub) TxTime() (time.Time, error) {
+	return s.now, nil
+}
+
+func (s *mockStub) CallerID() (string, error) {
+	if s.creator == "" {
+		return "", errors.New("the submitter has no certificate name")
+	}
+	return s.creator, nil
+}
+
+//Apply the writes of the transaction
+func (s *mockStub) commit() {
+	for key, value := range s.writes {
+		if value == nil {
+			delete(s.state, key)
+		} else {
+			s.state[key] = value
+		}
+	}
+	for collection, writes := range s.privateWrites {
+		if s.private[collection] == nil {
+			s.private[collection] = make(map[string][]byte)
+		}
+		for key, value := range writes {
+			if value == nil {
+				delete(s.private[collection], key)
+			} else {
+				s.private[collection][key] = value
+			}
+		}
+	}
+	if s.event != nil {
+		s.events = append(s.events, *s.event)
+	}
+	s.rollback()
+}
+
+//Drop the writes of the transaction
+func (s *mockStub) rollback() {
+	s.writes = make(map[string][]byte)
+	s.privateWrites = make(map[string]map[string][]byte)
+	s.event = nil
+}
+
+//Run the function as one transaction submitted by who. The transaction
+//commits when it succeeds. A query writing the state is reported as an
+//error
+func (s *mockStub) call(who string, function string, args ...string) ([]byte, error) {
+	s.creator = who
+	defer s.rollback()
+	output, err := Call(s, function, args)
+	if err != nil {
+		return output, err
+	}
+	if IsQuery(function) && (len(s.writes) > 0 || len(s.privateWrites) > 0 || s.event != nil) {
+		return output, errors.New("query " + function + " changed the state")
+	}
+	s.commit()
+	return output, nil
+}
+
+//Run the function like call and fail the test when it returns an error
+func (s *mockStub) mustCall(t *testing.T, who string, function string, args ...string) []byte {
+	t.Helper()
+	output, err := s.call(who, function, args...)
+	if err != nil {
+		t.Fatalf("%s failed: %v", function, err)
+	}
+	return output
+}
+
+//Run the function like call and fail the test unless it returns an error
+//containing the message
+func (s *mockStub) mustFail(t *testing.T, message string, who string, function string, args ...string) {
+	t.Helper()
+	if _, err := s.call(who, function, args...); err == nil {
+		t.Fatalf("%s succeeded, expected an error containing %q", function, message)
+	} else if !strings.Contains(err.Error(), message) {
+		t.Fatalf("%s failed with %q, expected %q", function, err.Error(), message)
+	}
+}
+
+//Keys of the committed state in sorted order
+func (s *mockStub) keys() []string {
+	keys := make([]string, 0, len(s.state))
+	for key := range s.state {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,204 @@
+package ufa
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+//PARTY_PREFIX Key prefix for the party records
+const PARTY_PREFIX = "PARTY_"
+
+//Status values of a party
+const (
+	PARTY_ACTIVE   = "ACTIVE"
+	PARTY_INACTIVE = "INACTIVE"
+)
+
+//Roles a party can be registered with
+const (
+	SELLER_ROLE   = "SELLER"
+	BUYER_ROLE    = "BUYER"
+	APPROVER_ROLE = "APPROVER"
+)
+
+//Party is a seller, buyer or approver referenced by UFAs and invoices. The
+//ID is the name used in sellerName, buyerName, raisedBy and approverBy
+type Party struct {
+	ID        string   `json:"id"`
+	LegalName string   `json:"legalName"`
+	TaxID     string   `json:"taxID,omitempty"`
+	Contact   string   `json:"contact,omitempty"`
+	Roles     []string `json:"roles"`
+	//PEM encoded ECDSA or Ed25519 keys the party signs invoices with
+	PublicKeys  []string          `json:"publicKeys"`
+	BankDetails map[string]string `json:"bankDetails,omitempty"`
+	Status      string            `json:"status"`
+}
+
+//Returns the party, nil when it is not registered
+func getParty(stub Store, id string) (*Party, error) {
+	recBytes, _ := stub.GetState(PARTY_PREFIX + id)
+	if recBytes == nil {
+		return nil, nil
+	}
+	var party Party
+	if err := json.Unmarshal(recBytes, &party); err != nil {
+		return nil, errors.New("Failed to unmarshal getParty ")
+	}
+	return &party, nil
+}
+
+//Check the party is usable. Returns the validation message
+func validateParty(party Party) string {
+	if party.ID == "" || party.LegalName == "" {
+		return "Party id and legalName are required"
+	}
+	if len(party.Roles) == 0 {
+		return "Party needs at least one role"
+	}
+	for _, role := range party.Roles {
+		if !contains([]string{SELLER_ROLE, BUYER_ROLE, APPROVER_ROLE}, role) {
+			return "Role " + role + " should be SELLER, BUYER or APPROVER"
+		}
+	}
+	for _, key := range party.PublicKeys {
+		if _, err := parsePublicKey(key); err != nil {
+			return err.Error()
+		}
+	}
+	if party.Status != PARTY_ACTIVE && party.Status != PARTY_INACTIVE {
+		return "Party status should be ACTIVE or INACTIVE"
+	}
+	return ""
+}
+
+//Store the party
+func putParty(stub Store, party Party) error {
+	bytesToStore, _ := canonicalJSON(party)
+	return stub.PutState(PARTY_PREFIX+party.ID, bytesToStore)
+}
+
+//Checks the party referenced for the role exists and is active. Unknown
+//names are accepted unless the configuration requires registered parties.
+//An empty role accepts any role
+func validatePartyRef(stub Store, config Config, field string, id string, role string) string {
+	if id == "" {
+		if config.RequireRegisteredParties {
+			return "\nMissing required field " + field
+		}
+		return ""
+	}
+	party, err := getParty(stub, id)
+	if err != nil {
+		return "\n" + err.Error()
+	}
+	if party == nil {
+		if config.RequireRegisteredParties {
+			return "\nParty " + id + " is not registered"
+		}
+		return ""
+	}
+	if party.Status != PARTY_ACTIVE {
+		return "\nParty " + id + " is not active"
+	}
+	if role != "" && !contains(party.Roles, role) {
+		return "\nParty " + id + " is not registered as " + role
+	}
+	return ""
+}
+
+//RegisterParty Registers a new party. args are who (an admin) and the
+//party as JSON
+func RegisterParty(stub Store, args []string) ([]byte, error) {
+	logger.Info("registerParty called")
+	who := caller(stub, argAt(args, 0))
+	if !isAdmin(stub, who) {
+		return nil, errors.New("User is not authorized to register parties")
+	}
+	var party Party
+	if err := json.Unmarshal([]byte(argAt(args, 1)), &party); err != nil {
+		return nil, errors.New("registerParty expects the party as JSON")
+	}
+	if party.Status == "" {
+		party.Status = PARTY_ACTIVE
+	}
+	if party.PublicKeys == nil {
+		party.PublicKeys = []string{}
+	}
+	if msg := validateParty(party); msg != "" {
+		return nil, errors.New(msg)
+	}
+	if existing, _ := getParty(stub, party.ID); existing != nil {
+		return nil, errors.New("Party " + party.ID + " already exists")
+	}
+	if err := putParty(stub, party); err != nil {
+		return nil, err
+	}
+	logger.Info("registerParty stored " + party.ID)
+	outputBytes, _ := canonicalJSON(party)
+	return outputBytes, nil
+}
+
+//UpdateParty Changes the fields of a party. args are who (an admin), the
+//party id and the fields to change as JSON
+func UpdateParty(stub Store, args []string) ([]byte, error) {
+	logger.Info("updateParty called")
+	who := caller(stub, argAt(args, 0))
+	id := argAt(args, 1)
+	if !isAdmin(stub, who) {
+		return nil, errors.New("User is not authorized to update parties")
+	}
+	party, err := getParty(stub, id)
+	if err != nil {
+		return nil, err
+	}
+	if party == nil {
+		return nil, errors.New("Invalid party provided " + id)
+	}
+	//Fields missing from the change keep their value
+	if err := json.Unmarshal([]byte(argAt(args, 2)), party); err != nil {
+		return nil, errors.New("updateParty expects the fields as JSON")
+	}
+	party.ID = id
+	if msg := validateParty(*party); msg != "" {
+		return nil, errors.New(msg)
+	}
+	if err := putParty(stub, *party); err != nil {
+		return nil, err
+	}
+	outputBytes, _ := canonicalJSON(party)
+	return outputBytes, nil
+}
+
+//DeactivateParty Marks a party inactive, so new UFAs and invoices can no
+//longer reference it. args are who (an admin) and the party id
+func DeactivateParty(stub Store, args []string) ([]byte, error) {
+	logger.Info("deactivateParty called")
+	change, _ := canonicalJSON(map[string]string{"status": PARTY_INACTIVE})
+	return UpdateParty(stub, []string{argAt(args, 0), argAt(args, 1), string(change)})
+}
+
+//GetParty Returns a party. Tax and bank details are only shown to the
+//party itself, the admins and the auditors. args are the id and who
+func GetParty(stub Store, args []string) ([]byte, error) {
+	logger.Info("getParty called")
+	if len(args) < 1 {
+		return nil, errors.New("getParty expects the party id and who")
+	}
+	id := args[0]
+	who := caller(stub, argAt(args, 1))
+	party, err := getParty(stub, id)
+	if err != nil {
+		return nil, err
+	}
+	if party == nil {
+		return nil, errors.New("Invalid party provided " + id)
+	}
+	config, _ := getConfig(stub)
+	if who != id && !isAdmin(stub, who) && !contains(config.Auditors, who) {
+		party.TaxID = ""
+		party.BankDetails = nil
+	}
+	outputBytes, _ := canonicalJSON(party)
+	return outputBytes, nil
+}
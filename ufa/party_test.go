@@ -0,0 +1,134 @@
+package ufa
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+)
+
+//Signing key of a test party
+type testKey struct {
+	private *ecdsa.PrivateKey
+}
+
+func newTestKey(t *testing.T) testKey {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{private}
+}
+
+//PEM encoding of the public key, as registered
+func (k testKey) publicPEM(t *testing.T) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&k.private.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+//Base64 signature over the message
+func (k testKey) sign(t *testing.T, message []byte) string {
+	t.Helper()
+	digest := sha256.Sum256(message)
+	signature, err := ecdsa.SignASN1(rand.Reader, k.private, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+//Registers the party with the roles and the key
+func registerParty(t *testing.T, s *mockStub, id string, key string, roles ...string) {
+	t.Helper()
+	party := Party{ID: id, LegalName: id + " Ltd", TaxID: "TAX-" + id, Roles: roles, PublicKeys: []string{}}
+	if key != "" {
+		party.PublicKeys = append(party.PublicKeys, key)
+	}
+	s.mustCall(t, ADMIN_ROLE, "registerParty", ADMIN_ROLE, toJSON(party))
+}
+
+func TestParties(t *testing.T) {
+	s := newLedger(t, `{"requireRegisteredParties":true}`)
+	registerParty(t, s, testSeller, "", SELLER_ROLE)
+	registerParty(t, s, testBuyer, "", BUYER_ROLE, APPROVER_ROLE)
+
+	s.mustFail(t, "already exists", ADMIN_ROLE, "registerParty", ADMIN_ROLE, `{"id":"S1","legalName":"Again","roles":["SELLER"]}`)
+	s.mustFail(t, "not authorized to register parties", testSeller, "registerParty", testSeller, `{"id":"S2","legalName":"S2","roles":["SELLER"]}`)
+	s.mustFail(t, "Role OWNER should be", ADMIN_ROLE, "registerParty", ADMIN_ROLE, `{"id":"S2","legalName":"S2","roles":["OWNER"]}`)
+	s.mustFail(t, "Public key should be PEM encoded", ADMIN_ROLE, "registerParty", ADMIN_ROLE, `{"id":"S2","legalName":"S2","roles":["SELLER"],"publicKeys":["x"]}`)
+
+	createUFA(t, s, "U1", newUFA())
+	if message := ValidateNewUFA(s, testSeller, newUFA().with("buyerName", "B9").json()); message == "" {
+		t.Fatal("UFA naming an unregistered party accepted")
+	}
+
+	var party Party
+	decode(t, s.mustCall(t, testBuyer, "getParty", testSeller, testBuyer), &party)
+	if party.LegalName != "S1 Ltd" || party.TaxID != "" {
+		t.Fatalf("other parties see %+v", party)
+	}
+	decode(t, s.mustCall(t, testSeller, "getParty", testSeller, testSeller), &party)
+	if party.TaxID != "TAX-S1" {
+		t.Fatalf("the party itself sees %+v", party)
+	}
+	s.mustFail(t, "Invalid party provided P9", testSeller, "getParty", "P9", testSeller)
+
+	decode(t, s.mustCall(t, ADMIN_ROLE, "updateParty", ADMIN_ROLE, testSeller, `{"legalName":"Seller One"}`), &party)
+	if party.LegalName != "Seller One" || party.ID != testSeller || len(party.Roles) != 1 {
+		t.Fatalf("updateParty returned %+v", party)
+	}
+	s.mustFail(t, "not authorized to update parties", testSeller, "updateParty", testSeller, testSeller, `{"legalName":"Mine"}`)
+	s.mustFail(t, "Invalid party provided", ADMIN_ROLE, "updateParty", ADMIN_ROLE, "P9", `{"legalName":"P9"}`)
+
+	s.mustCall(t, ADMIN_ROLE, "deactivateParty", ADMIN_ROLE, testSeller)
+	s.mustFail(t, "Party S1 is not active", testSeller, "createUFA", "U2", testSeller, newUFA().json())
+	s.mustFail(t, "Party S1 is not active", testSeller, "createNewInvoices", testSeller, toJSON(newInvoicePair("U1", "2016-01", "100")))
+}
+
+func TestInvoiceSignatures(t *testing.T) {
+	s := newLedger(t, `{"requireInvoiceSignatures":true}`)
+	sellerKey, buyerKey := newTestKey(t), newTestKey(t)
+	registerParty(t, s, testSeller, sellerKey.publicPEM(t), SELLER_ROLE)
+	registerParty(t, s, testBuyer, buyerKey.publicPEM(t), BUYER_ROLE, APPROVER_ROLE)
+	createUFA(t, s, "U1", newUFA())
+
+	pair := newInvoicePair("U1", "2016-01", "100")
+	s.mustFail(t, "is not signed", testSeller, "createNewInvoices", testSeller, toJSON(pair))
+	for _, invoice := range pair {
+		invoice[RAISER_SIGNATURE_FIELD] = buyerKey.sign(t, RaiserSigningBytes(invoice))
+	}
+	s.mustFail(t, "Signature of S1 does not match", testSeller, "createNewInvoices", testSeller, toJSON(pair))
+	for _, invoice := range pair {
+		invoice[RAISER_SIGNATURE_FIELD] = sellerKey.sign(t, RaiserSigningBytes(invoice))
+	}
+	raisePair(t, s, pair)
+
+	invoice := storedInvoice(t, s, "U1-2016-01-C")
+	s.mustFail(t, "is not signed", testBuyer, "approveInvoice", testBuyer, "U1-2016-01-C")
+	s.mustFail(t, "Signature of B1 does not match", testBuyer, "approveInvoice", testBuyer, "U1-2016-01-C", sellerKey.sign(t, ApproverSigningBytes(invoice)))
+	s.mustCall(t, testBuyer, "approveInvoice", testBuyer, "U1-2016-01-C", buyerKey.sign(t, ApproverSigningBytes(invoice)))
+	//Paying leaves the signed fields alone, updating does not
+	s.mustCall(t, testBuyer, "payInvoice", testBuyer, "U1-2016-01-C", "100")
+	s.mustFail(t, "would void the signature", testSeller, "updateInvoices", testSeller, `[{"invoiceNumber":"U1-2016-01-V","note":"x"}]`)
+
+	var result map[string]string
+	decode(t, s.mustCall(t, testBuyer, "verifyInvoiceSignatures", "U1-2016-01-C", testBuyer), &result)
+	if result["raiser"] != "VALID" || result["approver"] != "VALID" {
+		t.Fatalf("verifyInvoiceSignatures returned %v", result)
+	}
+	decode(t, s.mustCall(t, testBuyer, "verifyInvoiceSignatures", "U1-2016-01-V", testBuyer), &result)
+	if result["raiser"] != "VALID" || result["approver"] != "UNSIGNED" {
+		t.Fatalf("verifyInvoiceSignatures of the pending invoice returned %v", result)
+	}
+	s.mustFail(t, "not authorized to read invoice", testOutsider, "verifyInvoiceSignatures", "U1-2016-01-C", testOutsider)
+	s.mustFail(t, "Invalid invoice provided", testBuyer, "verifyInvoiceSignatures", "C9", testBuyer)
+}
@@ -0,0 +1,284 @@
+package ufa
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+)
+
+//PRIVATE_HASH_FIELD Field of a shared record holding the hash of its
+//private fields
+const PRIVATE_HASH_FIELD = "privateHash"
+
+//TRANSIENT_PRIVATE_KEY Transient map entry carrying private fields, so
+//they stay out of the transaction arguments recorded on the ledger
+const TRANSIENT_PRIVATE_KEY = "private"
+
+//PrivateStore is implemented by stores holding private data collections,
+//such as the Fabric stub
+type PrivateStore interface {
+	GetPrivateData(collection string, key string) ([]byte, error)
+	PutPrivateData(collection string, key string, value []byte) error
+	DelPrivateData(collection string, key string) error
+}
+
+//TransientStore is implemented by stores exposing the transient data of
+//the transaction, such as the Fabric stub
+type TransientStore interface {
+	GetTransient() (map[string][]byte, error)
+}
+
+//Returns the fields of the kind kept in the private collection, nil when
+//private data is not in use
+func privateFields(stub Store, config Config, kind string) []string {
+	if config.PrivateCollection == "" {
+		return nil
+	}
+	if _, ok := stub.(PrivateStore); !ok {
+		return nil
+	}
+	if kind == UFA_RECORD {
+		return config.PrivateUFAFields
+	}
+	if kind == INVOICE_RECORD {
+		return config.PrivateInvoiceFields
+	}
+	return nil
+}
+
+//Hash of the private fields of a record, as stored on the shared ledger.
+//The keys are sorted by the JSON encoder. Low entropy values such as
+//amounts should be sent with a random "salt" private field
+func privateDataHash(private map[string]string) string {
+	privateBytes, _ := canonicalJSON(private)
+	sum := sha256.Sum256(privateBytes)
+	return hex.EncodeToString(sum[:])
+}
+
+//Split the private fields off a copy of the record. Returns the shared
+//part and the private part, which is nil when there is nothing private
+func splitPrivate(record map[string]string, fields []string) (map[string]string, map[string]string) {
+	public := make(map[string]string, len(record))
+	for key, value := range record {
+		public[key] = value
+	}
+	delete(public, PRIVATE_HASH_FIELD)
+	var private map[string]string
+	for _, field := range fields {
+		if value, ok := public[field]; ok {
+			if private == nil {
+				private = make(map[string]string)
+			}
+			private[field] = value
+			delete(public, field)
+		}
+	}
+	return public, private
+}
+
+//Store the record, keeping its private fields in the private collection
+//and their hash on the shared ledger
+func putRecordState(stub Store, key string, kind string, record map[string]string) error {
+	config, _ := getConfig(stub)
+	public, private := splitPrivate(record, privateFields(stub, config, kind))
+	if private != nil {
+		privateBytes, _ := canonicalJSON(private)
+		if err := stub.(PrivateStore).PutPrivateData(config.PrivateCollection, key, privateBytes); err != nil {
+			return err
+		}
+		public[PRIVATE_HASH_FIELD] = privateDataHash(private)
+	}
+	bytesToStore, _ := canonicalJSON(public)
+	return stub.PutState(key, bytesToStore)
+}
+
+//Read a record from the shared ledger and add its private fields when
+//the store holds them. Returns nil when the key holds nothing
+func loadRecord(stub Store, key string) (map[string]string, error) {
+	recBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if recBytes == nil {
+		return nil, nil
+	}
+	var record map[string]string
+	if err := json.Unmarshal(recBytes, &record); err != nil {
+		return nil, errors.New("Failed to unmarshal record " + key)
+	}
+	if record == nil || record[PRIVATE_HASH_FIELD] == "" {
+		return record, nil
+	}
+	privateStore, ok := stub.(PrivateStore)
+	config, _ := getConfig(stub)
+	if !ok || config.PrivateCollection == "" {
+		return record, nil
+	}
+	privateBytes, err := privateStore.GetPrivateData(config.PrivateCollection, key)
+	if err != nil || privateBytes == nil {
+		logger.Info("loadRecord: private data of " + key + " is not available")
+		return record, nil
+	}
+	var private map[string]string
+	if err := json.Unmarshal(privateBytes, &private); err != nil {
+		return nil, errors.New("Failed to unmarshal private data " + key)
+	}
+	for field, value := range private {
+		record[field] = value
+	}
+	return record, nil
+}
+
+//Remove the private fields from a payload before it is kept in the shared
+//transaction history. The payload is kept in canonical form
+func publicPayload(stub Store, kind string, payload string) string {
+	var record map[string]string
+	if err := json.Unmarshal([]byte(payload), &record); err != nil {
+		return payload
+	}
+	config, _ := getConfig(stub)
+	public, private := splitPrivate(record, privateFields(stub, config, kind))
+	if private != nil {
+		public[PRIVATE_HASH_FIELD] = privateDataHash(private)
+	}
+	outputBytes, _ := canonicalJSON(public)
+	return string(outputBytes)
+}
+
+//Add the private fields passed in the transient map to a payload. The
+//transient entry is an object for a single record, or an array matching
+//the records of an array payload
+func withTransientFields(stub Store, payload string) (string, error) {
+	transientStore, ok := stub.(TransientStore)
+	if !ok {
+		return payload, nil
+	}
+	transient, err := transientStore.GetTransient()
+	if err != nil || transient[TRANSIENT_PRIVATE_KEY] == nil {
+		return payload, nil
+	}
+	privateBytes := transient[TRANSIENT_PRIVATE_KEY]
+
+	var record map[string]string
+	if json.Unmarshal([]byte(payload), &record) == nil && record != nil {
+		var private map[string]string
+		if err := json.Unmarshal(privateBytes, &private); err != nil {
+			return "", errors.New("Transient private fields should be a JSON object")
+		}
+		updateRecord(record, private)
+		outputBytes, _ := canonicalJSON(record)
+		return string(outputBytes), nil
+	}
+	var recordList []map[string]string
+	if json.Unmarshal([]byte(payload), &recordList) == nil {
+		var privateList []map[string]string
+		if err := json.Unmarshal(privateBytes, &privateList); err != nil || len(privateList) != len(recordList) {
+			return "", errors.New("Transient private fields should be a JSON array matching the records")
+		}
+		for i := range recordList {
+			updateRecord(recordList[i], privateList[i])
+		}
+		outputBytes, _ := canonicalJSON(recordList)
+		return string(outputBytes), nil
+	}
+	return payload, nil
+}
+
+//Identity is implemented by stores knowing who submitted the transaction,
+//such as the Fabric stub. When the store has it, the who argument of the
+//functions is ignored; it is only trusted from off-chain stores, where the
+//tool running the rules vouches for the user
+type Identity interface {
+	CallerID() (string, error)
+}
+
+//Returns the user calling a function: the submitter of the transaction
+//when the store knows it, otherwise who as passed in the arguments. An
+//unknown submitter gives an empty name, which is authorized for nothing
+func caller(stub Store, who string) string {
+	identity, ok := stub.(Identity)
+	if !ok {
+		return who
+	}
+	id, err := identity.CallerID()
+	if err != nil {
+		logger.Info("caller: unable to read the submitter " + err.Error())
+		return ""
+	}
+	return id
+}
+
+//Role who plays in the UFA, SELLER or BUYER, empty when it is neither
+func ufaRole(who string, ufaDetails map[string]string) string {
+	if who == "" {
+		return ""
+	}
+	if who == ufaDetails["sellerName"] {
+		return SELLER_ROLE
+	}
+	if who == ufaDetails["buyerName"] {
+		return BUYER_ROLE
+	}
+	return ""
+}
+
+//Tells if who can read the UFA: the seller, the buyer and the auditors
+func canReadUFA(config Config, who string, ufaDetails map[string]string) bool {
+	if contains(config.Auditors, who) {
+		return true
+	}
+	return ufaRole(who, ufaDetails) != ""
+}
+
+//Tells if who can read the invoice: whoever raised or approves it, and
+//those who can read its UFA
+func canReadInvoice(stub Store, config Config, who string, invoice map[string]string) bool {
+	if who != "" && (who == invoice["raisedBy"] || who == invoice["approverBy"]) {
+		return true
+	}
+	ufaDetails, _ := readRecord(stub, invoice["ufanumber"], UFA_RECORD)
+	return ufaDetails != nil && canReadUFA(config, who, ufaDetails)
+}
+
+//Returns the UFA when who can read it
+func readUFAFor(stub Store, who string, ufanumber string) (map[string]string, error) {
+	ufaDetails, err := readRecord(stub, ufanumber, UFA_RECORD)
+	if err != nil || ufaDetails == nil {
+		return nil, err
+	}
+	config, _ := getConfig(stub)
+	if !canReadUFA(config, who, ufaDetails) {
+		return nil, errors.New("User is not authorized to read UFA " + ufanumber)
+	}
+	return ufaDetails, nil
+}
+
+//VerifyPrivateData checks private fields held off the shared ledger
+//against the hash anchored on it. args are the key of the UFA or
+//invoice and the private fields as a JSON object
+func VerifyPrivateData(stub Store, args []string) ([]byte, error) {
+	logger.Info("verifyPrivateData called")
+	if len(args) < 2 {
+		return nil, errors.New("verifyPrivateData expects the key and the private fields")
+	}
+	key := args[0]
+	var private map[string]string
+	if err := json.Unmarshal([]byte(args[1]), &private); err != nil {
+		return nil, errors.New("verifyPrivateData expects the private fields as a JSON object")
+	}
+	recBytes, _ := stub.GetState(key)
+	var record map[string]string
+	json.Unmarshal(recBytes, &record)
+	if record == nil || record[PRIVATE_HASH_FIELD] == "" {
+		return nil, errors.New("No private data is anchored for " + key)
+	}
+	hash := privateDataHash(private)
+	outputBytes, _ := canonicalJSON(map[string]interface{}{
+		"key":          key,
+		"verified":     hash == record[PRIVATE_HASH_FIELD],
+		"anchoredHash": record[PRIVATE_HASH_FIELD],
+		"suppliedHash": hash,
+	})
+	return outputBytes, nil
+}
@@ -0,0 +1,86 @@
+package ufa
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const privateConfig = `{"privateCollection":"ufaPrivate","privateUFAFields":["netCharge","raisedInvTotal"],"privateInvoiceFields":["invoiceAmt"]}`
+
+func TestPrivateFields(t *testing.T) {
+	s := newLedger(t, privateConfig)
+	createUFA(t, s, "U1", newUFA())
+	raisePair(t, s, newInvoicePair("U1", "2016-01", "800"))
+
+	//The shared record keeps the hash, the collection the amounts
+	var shared map[string]string
+	if err := json.Unmarshal(s.state["U1"], &shared); err != nil {
+		t.Fatal(err)
+	}
+	if shared["netCharge"] != "" || shared["raisedInvTotal"] != "" || shared[PRIVATE_HASH_FIELD] == "" {
+		t.Fatalf("shared UFA %v", shared)
+	}
+	var private map[string]string
+	if err := json.Unmarshal(s.private["ufaPrivate"]["U1"], &private); err != nil {
+		t.Fatal(err)
+	}
+	if private["netCharge"] != "1000" || private["raisedInvTotal"] != "800" {
+		t.Fatalf("private UFA %v", private)
+	}
+	if stored := storedUFA(t, s, "U1"); stored["netCharge"] != "1000" || stored["sellerName"] != testSeller {
+		t.Fatalf("UFA read back as %v", stored)
+	}
+	if stored := storedInvoice(t, s, "U1-2016-01-C"); stored["invoiceAmt"] != "800" {
+		t.Fatalf("invoice read back as %v", stored)
+	}
+	//The ceiling is still enforced on the private amounts
+	s.mustFail(t, "Total invoice amount exceeded", testSeller, "createNewInvoices", testSeller, toJSON(newInvoicePair("U1", "2016-02", "301")))
+
+	//Alerts on the shared ledger leave the private amounts out
+	var alerts []Alert
+	alertBytes := s.mustCall(t, testSeller, "getAlerts", "U1", testSeller)
+	if strings.Contains(string(alertBytes), "percentUsed") {
+		t.Fatalf("alerts carry the share used: %s", alertBytes)
+	}
+	decode(t, alertBytes, &alerts)
+	if len(alerts) != 1 || alerts[0].NetCharge != 0 || alerts[0].RaisedInvTotal != 0 || alerts[0].PercentUsed != 0 {
+		t.Fatalf("alerts %+v", alerts)
+	}
+
+	var result map[string]interface{}
+	decode(t, s.mustCall(t, testBuyer, "verifyPrivateData", "U1", `{"netCharge":"1000","raisedInvTotal":"800"}`), &result)
+	if result["verified"] != true {
+		t.Fatalf("verifyPrivateData returned %v", result)
+	}
+	decode(t, s.mustCall(t, testBuyer, "verifyPrivateData", "U1", `{"netCharge":"900","raisedInvTotal":"800"}`), &result)
+	if result["verified"] != false {
+		t.Fatalf("verifyPrivateData of other amounts returned %v", result)
+	}
+	s.mustFail(t, "No private data is anchored for "+ALL_ELEMENENTS, testBuyer, "verifyPrivateData", ALL_ELEMENENTS, `{}`)
+	s.mustFail(t, "expects the private fields as a JSON object", testBuyer, "verifyPrivateData", "U1", `[]`)
+}
+
+func TestTransientFields(t *testing.T) {
+	s := newLedger(t, privateConfig)
+	s.transient = map[string][]byte{TRANSIENT_PRIVATE_KEY: []byte(`{"netCharge":"2000"}`)}
+	createUFA(t, s, "U1", newUFA().without("netCharge"))
+	if stored := storedUFA(t, s, "U1"); stored["netCharge"] != "2000" {
+		t.Fatalf("UFA created with netCharge %q", stored["netCharge"])
+	}
+
+	s.transient = map[string][]byte{TRANSIENT_PRIVATE_KEY: []byte(`[{"invoiceAmt":"500"},{"invoiceAmt":"500"}]`)}
+	pair := newInvoicePair("U1", "2016-01", "")
+	for _, invoice := range pair {
+		delete(invoice, "invoiceAmt")
+	}
+	raisePair(t, s, pair)
+	if stored := storedUFA(t, s, "U1"); stored["raisedInvTotal"] != "500" {
+		t.Fatalf("raisedInvTotal = %q, want 500", stored["raisedInvTotal"])
+	}
+
+	s.transient = map[string][]byte{TRANSIENT_PRIVATE_KEY: []byte(`[{"invoiceAmt":"500"}]`)}
+	s.mustFail(t, "JSON array matching the records", testSeller, "createNewInvoices", testSeller, toJSON(newInvoicePair("U1", "2016-02", "1")))
+	s.transient = map[string][]byte{TRANSIENT_PRIVATE_KEY: []byte(`[]`)}
+	s.mustFail(t, "should be a JSON object", testSeller, "createUFA", "U2", testSeller, newUFA().json())
+}
@@ -0,0 +1,275 @@
+package ufa
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+//UFA_AMENDMENT_PREFIX Key prefix for the dated amendments of a UFA
+const UFA_AMENDMENT_PREFIX = "UFA_AMENDMENT_"
+
+//Fields which updates and amendments cannot change: the number, the term
+//and the fields kept by the ledger. A term is extended with renewUFA
+var unamendableFields = append([]string{"ufanumber", "startDate", "endDate"}, ledgerUFAFields...)
+
+//Amendment changes fields of a UFA from a date. Previous holds the values
+//replaced, empty for fields the UFA did not have
+type Amendment struct {
+	EffectiveDate string            `json:"effectiveDate"`
+	AmendedBy     string            `json:"amendedBy"`
+	Fields        map[string]string `json:"fields"`
+	Previous      map[string]string `json:"previous"`
+}
+
+//SchedulePeriod is one period of the billing schedule of a UFA
+type SchedulePeriod struct {
+	BillingPeriod  string  `json:"billingPeriod"`
+	PeriodStart    string  `json:"periodStart"`
+	PeriodEnd      string  `json:"periodEnd"`
+	Days           int     `json:"days"`
+	FullDays       int     `json:"fullDays"`
+	ExpectedAmount float64 `json:"expectedAmount"`
+	InvoicedAmount float64 `json:"invoicedAmount"`
+	Invoiced       bool    `json:"invoiced"`
+}
+
+//Returns the amendments of the UFA, oldest first
+func getAmendments(stub Store, ufanumber string) []Amendment {
+	amendments := make([]Amendment, 0)
+	recBytes, _ := stub.GetState(UFA_AMENDMENT_PREFIX + ufanumber)
+	if recBytes != nil {
+		json.Unmarshal(recBytes, &amendments)
+	}
+	return amendments
+}
+
+//Returns the fields of the UFA in effect on the day, undoing the
+//amendments taking effect after it
+func valuesAt(ufaDetails map[string]string, amendments []Amendment, day time.Time) map[string]string {
+	values := make(map[string]string, len(ufaDetails))
+	for key, value := range ufaDetails {
+		values[key] = value
+	}
+	for i := len(amendments) - 1; i >= 0; i-- {
+		effective, _ := time.Parse(termDateLayout, amendments[i].EffectiveDate)
+		if !effective.After(day) {
+			break
+		}
+		for key := range amendments[i].Fields {
+			if previous, ok := amendments[i].Previous[key]; ok {
+				values[key] = previous
+			} else {
+				delete(values, key)
+			}
+		}
+	}
+	return values
+}
+
+//Amount billed for a full period under the values. A pro-rata UFA spreads
+//its net charge over the periods of the term in proportion to their days
+func fullPeriodRate(values map[string]string, termPeriods float64) float64 {
+	if values["recurringBilling"] == RECURRING_PRORATA {
+		if termPeriods <= 0 {
+			return 0
+		}
+		return validateNumber(values["netCharge"]) / termPeriods
+	}
+	return validateNumber(values["recurringAmount"])
+}
+
+//Returns the amount expected for each of the periods. A period is billed at
+//its share of the full calendar period, split where an amendment takes
+//effect so each part uses the rate in effect then. Amounts are rounded to
+//cents on the running total, so the schedule adds up to the exact total
+func expectedAmounts(ufaDetails map[string]string, amendments []Amendment, periods []billingPeriod) []float64 {
+	termPeriods := 0.0
+	for _, period := range periods {
+		termPeriods += float64(daysBetween(period.Start, period.End)) / float64(period.FullDays)
+	}
+	amounts := make([]float64, len(periods))
+	exactTotal, roundedTotal := 0.0, 0.0
+	for i, period := range periods {
+		segmentStart := period.Start
+		for _, amendment := range amendments {
+			effective, err := time.Parse(termDateLayout, amendment.EffectiveDate)
+			if err != nil || !effective.After(segmentStart) || effective.After(period.End) {
+				continue
+			}
+			rate := fullPeriodRate(valuesAt(ufaDetails, amendments, segmentStart), termPeriods)
+			exactTotal += rate * float64(daysBetween(segmentStart, effective.AddDate(0, 0, -1))) / float64(period.FullDays)
+			segmentStart = effective
+		}
+		rate := fullPeriodRate(valuesAt(ufaDetails, amendments, segmentStart), termPeriods)
+		exactTotal += rate * float64(daysBetween(segmentStart, period.End)) / float64(period.FullDays)
+		amounts[i] = roundAmount(math.Round(exactTotal*100)/100 - roundedTotal)
+		roundedTotal = math.Round(exactTotal*100) / 100
+	}
+	return amounts
+}
+
+//Returns the amount expected for the billing period of a UFA with recurring
+//billing, false when the UFA has none or the period is not on its schedule
+func expectedPeriodAmount(ufaDetails map[string]string, amendments []Amendment, label string) (float64, bool) {
+	if ufaDetails["recurringBilling"] == "" {
+		return 0, false
+	}
+	until, ok := parsePeriodLabel(label, frequencyMonths(ufaDetails["billingFrequency"]))
+	if !ok {
+		return 0, false
+	}
+	periods, err := billingPeriods(ufaDetails, until)
+	if err != nil {
+		return 0, false
+	}
+	for i, amount := range expectedAmounts(ufaDetails, amendments, periods) {
+		if periods[i].Label == label {
+			return amount, true
+		}
+	}
+	return 0, false
+}
+
+//Checks the invoice amount against the amount expected for its period,
+//allowing the tolerance of the UFA and a rounding cent
+func validatePeriodAmount(ufaDetails map[string]string, amendments []Amendment, invoice map[string]string) string {
+	expected, ok := expectedPeriodAmount(ufaDetails, amendments, invoice["billingPeriod"])
+	if !ok {
+		return ""
+	}
+	amount := validateNumber(invoice["invoiceAmt"])
+	allowed := expected*validateNumber(ufaDetails["chargTolrence"])/100.0 + 0.005
+	if math.Abs(amount-expected) > allowed {
+		return "\nInvoice amount " + invoice["invoiceAmt"] + " deviates from the " +
+			strconv.FormatFloat(expected, 'f', -1, 64) + " expected for " + invoice["billingPeriod"] + " beyond the tolerance"
+	}
+	return ""
+}
+
+//AmendUFA changes fields of a UFA from an effective date, so the billing
+//schedule uses the old values before it and the new ones after. args are
+//the UFA number, who (a party of the UFA or an admin), the date as
+//YYYY-MM-DD and the fields as JSON. Amendments are applied in date order
+func AmendUFA(stub Store, args []string) ([]byte, error) {
+	logger.Info("amendUFA called")
+	if len(args) < 4 {
+		return nil, errors.New("amendUFA expects the UFA number, who, a date as YYYY-MM-DD and the fields as JSON")
+	}
+	ufanumber := args[0]
+	who := caller(stub, argAt(args, 1))
+	ufaDetails, _ := readRecord(stub, ufanumber, UFA_RECORD)
+	if ufaDetails == nil {
+		return nil, errors.New("Invalid UFA provided " + ufanumber)
+	}
+	if !isAdmin(stub, who) && who != ufaDetails["sellerName"] && who != ufaDetails["buyerName"] {
+		return nil, errors.New("User is not authorized to amend UFA " + ufanumber)
+	}
+	effective, err := time.Parse(termDateLayout, argAt(args, 2))
+	if err != nil {
+		return nil, errors.New("amendUFA expects a date as YYYY-MM-DD")
+	}
+	if start, err := time.Parse(termDateLayout, ufaDetails["startDate"]); err == nil && effective.Before(start) {
+		return nil, errors.New("Amendment takes effect before the UFA starts")
+	}
+	if end, err := time.Parse(termDateLayout, ufaDetails["endDate"]); err == nil && effective.After(end) {
+		return nil, errors.New("Amendment takes effect after the UFA ends")
+	}
+	amendments := getAmendments(stub, ufanumber)
+	if len(amendments) > 0 && argAt(args, 2) < amendments[len(amendments)-1].EffectiveDate {
+		return nil, errors.New("Amendment takes effect before the last amendment of " + ufanumber)
+	}
+	var fields map[string]string
+	if err := json.Unmarshal([]byte(argAt(args, 3)), &fields); err != nil || len(fields) == 0 {
+		return nil, errors.New("amendUFA expects the fields to change as JSON")
+	}
+	config, _ := getConfig(stub)
+	private := privateFields(stub, config, UFA_RECORD)
+	amendment := Amendment{EffectiveDate: argAt(args, 2), AmendedBy: who, Fields: fields, Previous: make(map[string]string)}
+	for key := range fields {
+		if contains(unamendableFields, key) {
+			return nil, errors.New("Field " + key + " cannot be amended")
+		}
+		//Amendments are kept on the shared ledger
+		if contains(private, key) {
+			return nil, errors.New("Private field " + key + " cannot be amended with an effective date")
+		}
+		if previous, ok := ufaDetails[key]; ok {
+			amendment.Previous[key] = previous
+		}
+	}
+
+	updateRecord(ufaDetails, fields)
+	if valMsg := validateUFAFields(stub, config, ufaDetails); valMsg != "" {
+		return nil, errors.New("Validation failure: " + valMsg)
+	}
+
+	amendments = append(amendments, amendment)
+	bytesToStore, _ := canonicalJSON(amendments)
+	if err := stub.PutState(UFA_AMENDMENT_PREFIX+ufanumber, bytesToStore); err != nil {
+		return nil, err
+	}
+	writeRecord(stub, ufanumber, UFA_RECORD, ufaDetails)
+	historyBytes, _ := canonicalJSON(amendment)
+	appendUFATransactionHistory(stub, ufanumber, string(historyBytes))
+	logger.Info("amendUFA amended " + ufanumber + " from " + amendment.EffectiveDate)
+	return historyBytes, nil
+}
+
+//GetBillingSchedule Returns the periods of a UFA with recurring billing, the
+//amount expected for each and what was invoiced. args are the UFA number,
+//who, and for UFAs without an end date the last date shown as YYYY-MM-DD
+func GetBillingSchedule(stub Store, args []string) ([]byte, error) {
+	logger.Info("getBillingSchedule called")
+	if len(args) < 1 {
+		return nil, errors.New("getBillingSchedule expects the UFA number and who")
+	}
+	ufanumber := args[0]
+	ufaDetails, err := readUFAFor(stub, caller(stub, argAt(args, 1)), ufanumber)
+	if err != nil {
+		return nil, err
+	}
+	if ufaDetails["recurringBilling"] == "" {
+		return nil, errors.New("UFA " + ufanumber + " has no recurring billing")
+	}
+	var until time.Time
+	if ufaDetails["endDate"] == "" {
+		if until, err = time.Parse(termDateLayout, argAt(args, 2)); err != nil {
+			return nil, errors.New("getBillingSchedule expects the last date as YYYY-MM-DD for a UFA without end date")
+		}
+	}
+	periods, err := billingPeriods(ufaDetails, until)
+	if err != nil {
+		return nil, err
+	}
+	invoiced := make(map[string]float64)
+	covered := make(map[string]bool)
+	for _, invoice := range getInvoicesForUFA(stub, ufanumber) {
+		if !covered[invoice["billingPeriod"]] {
+			//The customer invoice comes first, the vendor one repeats it
+			invoiced[invoice["billingPeriod"]] = validateNumber(invoice["invoiceAmt"])
+		}
+		covered[invoice["billingPeriod"]] = true
+	}
+	schedule := make([]SchedulePeriod, 0, len(periods))
+	for i, amount := range expectedAmounts(ufaDetails, getAmendments(stub, ufanumber), periods) {
+		period := periods[i]
+		schedule = append(schedule, SchedulePeriod{
+			BillingPeriod:  period.Label,
+			PeriodStart:    period.Start.Format(termDateLayout),
+			PeriodEnd:      period.End.Format(termDateLayout),
+			Days:           daysBetween(period.Start, period.End),
+			FullDays:       period.FullDays,
+			ExpectedAmount: amount,
+			InvoicedAmount: invoiced[period.Label],
+			Invoiced:       covered[period.Label],
+		})
+	}
+	outputBytes, err := canonicalJSON(schedule)
+	if err != nil {
+		return nil, err
+	}
+	return outputBytes, nil
+}
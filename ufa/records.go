@@ -0,0 +1,126 @@
+package ufa
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+//Retrieve all the invoice list
+func getAllInvloiceList(stub Store, ufanumber string) ([]string, error) {
+	var recordList []string
+	recBytes, _ := stub.GetState(UFA_INVOICE_PREFIX + ufanumber)
+
+	err := json.Unmarshal(recBytes, &recordList)
+	if err != nil {
+		return nil, errors.New("Failed to unmarshal getAllInvloiceList ")
+	}
+
+	return recordList, nil
+}
+
+//Retrieve all the invoice list
+func getAllInvloiceFromMasterList(stub Store) ([]string, error) {
+	var recordList []string
+	recBytes, _ := stub.GetState(ALL_INVOICES)
+
+	err := json.Unmarshal(recBytes, &recordList)
+	if err != nil {
+		return nil, errors.New("Failed to unmarshal getAllInvloiceFromMasterList ")
+	}
+
+	return recordList, nil
+}
+
+//Append the invoice numbers to the UFA. The invoices of a batch are
+//appended together since the writes of a transaction are not visible to
+//its own reads
+func addInvoiceRecordsToUFA(stub Store, ufanumber string, invoiceNumbers ...string) error {
+	logger.Info("Adding invoice numbers to UFA" + ufanumber)
+	var recordList []string
+	recBytes, _ := stub.GetState(UFA_INVOICE_PREFIX + ufanumber)
+
+	err := json.Unmarshal(recBytes, &recordList)
+	if err != nil || recBytes == nil {
+		recordList = make([]string, 0)
+	}
+	recordList = append(recordList, invoiceNumbers...)
+
+	bytesToStore, _ := canonicalJSON(recordList)
+	logger.Info("After addition" + string(bytesToStore))
+	stub.PutState(UFA_INVOICE_PREFIX+ufanumber, bytesToStore)
+	logger.Info("Adding invoice numbers to UFA :Done ")
+	return nil
+}
+
+//Append new UFA numbers to the master list. The numbers of a batch are
+//appended together since the writes of a transaction are not visible to
+//its own reads
+func updateMasterRecords(stub Store, ufaNumbers ...string) error {
+	var recordList []string
+	recBytes, _ := stub.GetState(ALL_ELEMENENTS)
+
+	err := json.Unmarshal(recBytes, &recordList)
+	if err != nil {
+		return errors.New("Failed to unmarshal updateMasterReords ")
+	}
+	recordList = append(recordList, ufaNumbers...)
+	bytesToStore, _ := canonicalJSON(recordList)
+	logger.Info("After addition" + string(bytesToStore))
+	stub.PutState(ALL_ELEMENENTS, bytesToStore)
+	return nil
+}
+
+//Append new invoices to the master list
+func updateInventoryMasterRecords(stub Store, invoiceNumbers ...string) error {
+	var recordList []string
+	recBytes, _ := stub.GetState(ALL_INVOICES)
+
+	err := json.Unmarshal(recBytes, &recordList)
+	if err != nil {
+		return errors.New("Failed to unmarshal updateInventoryMasterRecords ")
+	}
+	recordList = append(recordList, invoiceNumbers...)
+
+	bytesToStore, _ := canonicalJSON(recordList)
+	logger.Info("After addition" + string(bytesToStore))
+	stub.PutState(ALL_INVOICES, bytesToStore)
+	return nil
+}
+
+//Append to UFA transaction history
+func appendUFATransactionHistory(stub Store, ufanumber string, payload string) error {
+	var recordList []string
+
+	logger.Info("Appending to transaction history " + ufanumber)
+	payload = publicPayload(stub, UFA_RECORD, payload)
+	recBytes, _ := stub.GetState(UFA_TRXN_PREFIX + ufanumber)
+
+	if recBytes == nil {
+		logger.Info("Updating the transaction history for the first time")
+		recordList = make([]string, 0)
+	} else {
+		err := json.Unmarshal(recBytes, &recordList)
+		if err != nil {
+			return errors.New("Failed to unmarshal appendUFATransactionHistory ")
+		}
+	}
+	recordList = append(recordList, payload)
+	bytesToStore, _ := canonicalJSON(recordList)
+	logger.Info("After updating the transaction history" + string(bytesToStore))
+	stub.PutState(UFA_TRXN_PREFIX+ufanumber, bytesToStore)
+	logger.Info("Appending to transaction history " + ufanumber + " Done!!")
+	return nil
+}
+
+//Returns all the UFA Numbers stored
+func getAllRecordsList(stub Store) ([]string, error) {
+	var recordList []string
+	recBytes, _ := stub.GetState(ALL_ELEMENENTS)
+
+	err := json.Unmarshal(recBytes, &recordList)
+	if err != nil {
+		return nil, errors.New("Failed to unmarshal getAllRecordsList ")
+	}
+
+	return recordList, nil
+}
@@ -0,0 +1,248 @@
+package ufa
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+//Recurring billing of a UFA, set in its recurringBilling field
+const (
+	//recurringAmount is billed every full period
+	RECURRING_FIXED = "FIXED"
+	//The net charge is spread over the term, by the days billed in each period
+	RECURRING_PRORATA = "PRORATA"
+)
+
+//billingPeriod is one period of the billing schedule of a UFA, cut to its
+//term. FullDays is the length of the whole calendar period
+type billingPeriod struct {
+	Label    string
+	Start    time.Time
+	End      time.Time
+	FullDays int
+}
+
+//Months in a period of the billing frequency
+func frequencyMonths(frequency string) int {
+	switch frequency {
+	case "QUARTERLY":
+		return 3
+	case "YEARLY":
+		return 12
+	}
+	return 1
+}
+
+//Label of the calendar period starting at the date: 2016-07 for a month,
+//2016-Q3 for a quarter, 2016 for a year
+func periodLabel(start time.Time, months int) string {
+	switch months {
+	case 3:
+		return start.Format("2006") + "-Q" + strconv.Itoa((int(start.Month())-1)/3+1)
+	case 12:
+		return start.Format("2006")
+	}
+	return start.Format("2006-01")
+}
+
+//Start of the calendar period the label names, false when the label is
+//not one of the billing frequency
+func parsePeriodLabel(label string, months int) (time.Time, bool) {
+	switch months {
+	case 3:
+		if len(label) != 7 || label[4:6] != "-Q" || label[6] < '1' || label[6] > '4' {
+			return time.Time{}, false
+		}
+		year, err := time.Parse("2006", label[:4])
+		if err != nil {
+			return time.Time{}, false
+		}
+		return year.AddDate(0, int(label[6]-'1')*3, 0), true
+	case 12:
+		start, err := time.Parse("2006", label)
+		return start, err == nil
+	}
+	start, err := time.Parse("2006-01", label)
+	return start, err == nil
+}
+
+//First and last day covered by a date or by the label of a monthly,
+//quarterly or yearly period. false when the value is none of them
+func periodRange(label string) (time.Time, time.Time, bool) {
+	if day, err := time.Parse(termDateLayout, label); err == nil {
+		return day, day, true
+	}
+	for _, months := range []int{1, 3, 12} {
+		if start, ok := parsePeriodLabel(label, months); ok {
+			return start, start.AddDate(0, months, -1), true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+//Days from start to end, both included
+func daysBetween(start time.Time, end time.Time) int {
+	return int(end.Sub(start).Hours()/24) + 1
+}
+
+//Returns the calendar periods of the billing frequency covering the term of
+//the UFA, the first and last cut to the term. Without an end date the
+//periods starting by the until date are returned
+func billingPeriods(ufaDetails map[string]string, until time.Time) ([]billingPeriod, error) {
+	start, err := time.Parse(termDateLayout, ufaDetails["startDate"])
+	if err != nil {
+		return nil, errors.New("Recurring billing needs a startDate")
+	}
+	var end time.Time
+	last := until
+	if ufaDetails["endDate"] != "" {
+		if end, err = time.Parse(termDateLayout, ufaDetails["endDate"]); err != nil {
+			return nil, errors.New("End date should be a date as YYYY-MM-DD")
+		}
+		last = end
+	}
+	months := frequencyMonths(ufaDetails["billingFrequency"])
+	periodStart := time.Date(start.Year(), time.Month((int(start.Month())-1)/months*months+1), 1, 0, 0, 0, 0, time.UTC)
+	periods := make([]billingPeriod, 0)
+	for !periodStart.After(last) {
+		next := periodStart.AddDate(0, months, 0)
+		period := billingPeriod{Label: periodLabel(periodStart, months), Start: periodStart, End: next.AddDate(0, 0, -1)}
+		period.FullDays = daysBetween(period.Start, period.End)
+		if period.Start.Before(start) {
+			period.Start = start
+		}
+		if !end.IsZero() && period.End.After(end) {
+			period.End = end
+		}
+		periods = append(periods, period)
+		periodStart = next
+	}
+	return periods, nil
+}
+
+//Check the recurring billing of a new UFA
+func validateRecurring(ufaDetails map[string]string) string {
+	switch ufaDetails["recurringBilling"] {
+	case "":
+		return ""
+	case RECURRING_FIXED:
+		if validateNumber(ufaDetails["recurringAmount"]) <= 0 {
+			return "\nFixed recurring billing needs a recurringAmount above zero"
+		}
+	case RECURRING_PRORATA:
+		if ufaDetails["endDate"] == "" {
+			return "\nPro-rata recurring billing needs an endDate"
+		}
+	default:
+		return "\nRecurring billing should be FIXED or PRORATA"
+	}
+	if ufaDetails["startDate"] == "" {
+		return "\nRecurring billing needs a startDate"
+	}
+	return ""
+}
+
+//Returns the invoice pairs due on the UFA by the date: the periods ended
+//by then which have no invoices yet, billed in arrears
+func dueInvoicePairs(stub Store, who string, ufanumber string, ufaDetails map[string]string, asOf time.Time) ([][]map[string]string, error) {
+	periods, err := billingPeriods(ufaDetails, asOf)
+	if err != nil {
+		return nil, err
+	}
+	amounts := expectedAmounts(ufaDetails, getAmendments(stub, ufanumber), periods)
+	//The periods already covered, as reported by checkInvoicesRaised
+	covered := make(map[string]bool)
+	for _, invoice := range getInvoicesForUFA(stub, ufanumber) {
+		covered[invoice["billingPeriod"]] = true
+	}
+	pairs := make([][]map[string]string, 0)
+	for i, period := range periods {
+		if period.End.After(asOf) {
+			break
+		}
+		if covered[period.Label] {
+			continue
+		}
+		pair := make([]map[string]string, 0, 2)
+		for _, suffix := range []string{"-C", "-V"} {
+			invoice := map[string]string{
+				"ufanumber":     ufanumber,
+				"invoiceNumber": ufanumber + "-" + period.Label + suffix,
+				"invoiceAmt":    strconv.FormatFloat(amounts[i], 'f', -1, 64),
+				"billingPeriod": period.Label,
+				"invoiceDate":   period.Start.Format(termDateLayout),
+				"periodStart":   period.Start.Format(termDateLayout),
+				"periodEnd":     period.End.Format(termDateLayout),
+				"raisedBy":      who,
+			}
+			if currency := ufaDetails["currency"]; currency != "" {
+				invoice["currency"] = currency
+			}
+			pair = append(pair, invoice)
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
+
+//GenerateDueInvoices raises the customer and vendor invoices of every
+//period due on the UFAs with recurring billing. args are who, the date as
+//YYYY-MM-DD and optionally a UFA number. Admins generate for every UFA,
+//other users for the UFAs naming them as seller. Periods are due once they
+//end; stores knowing the transaction time do not take a date after it.
+//Each pair is validated like createNewInvoices, so the tolerance
+//ceiling applies; pairs breaking a rule are reported and left out
+func GenerateDueInvoices(stub Store, args []string) ([]byte, error) {
+	logger.Info("generateDueInvoices called")
+	if len(args) < 2 {
+		return nil, errors.New("generateDueInvoices expects who and a date as YYYY-MM-DD")
+	}
+	who := caller(stub, args[0])
+	asOf, err := time.Parse(termDateLayout, argAt(args, 1))
+	if err != nil {
+		return nil, errors.New("generateDueInvoices expects a date as YYYY-MM-DD")
+	}
+	if now, ok := txTime(stub); ok && asOf.After(now) {
+		return nil, errors.New("generateDueInvoices cannot bill as of a date after the transaction")
+	}
+	single := argAt(args, 2) != ""
+	ufaNumbers := []string{argAt(args, 2)}
+	if !single {
+		if ufaNumbers, err = getAllRecordsList(stub); err != nil {
+			return nil, errors.New("Unable to get all the records ")
+		}
+	}
+	admin := isAdmin(stub, who)
+	pairs := make([][]map[string]string, 0)
+	for _, ufanumber := range ufaNumbers {
+		ufaDetails, _ := readRecord(stub, ufanumber, UFA_RECORD)
+		if ufaDetails == nil {
+			return nil, errors.New("Invalid UFA provided " + ufanumber)
+		}
+		if ufaDetails["recurringBilling"] == "" || ufaDetails["ufaStatus"] != UFA_ACTIVE {
+			continue
+		}
+		if !admin && ufaDetails["sellerName"] != who {
+			if single {
+				return nil, errors.New("User is not authorized to generate invoices for " + ufanumber)
+			}
+			continue
+		}
+		due, err := dueInvoicePairs(stub, who, ufanumber, ufaDetails, asOf)
+		if err != nil {
+			return nil, errors.New(ufanumber + ": " + err.Error())
+		}
+		pairs = append(pairs, due...)
+	}
+	report, err := raiseInvoicePairs(stub, who, BULK_BEST_EFFORT, pairs)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("generateDueInvoices created " + strconv.Itoa(report.Created) + " pairs, failed " + strconv.Itoa(report.Failed))
+	outputBytes, err := canonicalJSON(report)
+	if err != nil {
+		return nil, err
+	}
+	return outputBytes, nil
+}
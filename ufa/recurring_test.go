@@ -0,0 +1,100 @@
+package ufa
+
+import (
+	"testing"
+)
+
+//Monthly UFA billing 100 a month from January to June 2016
+func fixedUFA() ufaFixture {
+	return newUFA().with("endDate", "2016-06-30").with("recurringBilling", RECURRING_FIXED).with("recurringAmount", "100")
+}
+
+func TestGenerateDueInvoices(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", fixedUFA())
+	createUFA(t, s, "U2", newUFA())
+
+	var report BulkReport
+	decode(t, s.mustCall(t, testSeller, "generateDueInvoices", testSeller, "2016-03-31"), &report)
+	if report.Created != 3 || report.Failed != 0 {
+		t.Fatalf("generateDueInvoices returned %+v", report)
+	}
+	invoice := storedInvoice(t, s, "U1-2016-03-C")
+	if invoice == nil || invoice["invoiceAmt"] != "100" || invoice["raisedBy"] != testSeller || invoice["periodEnd"] != "2016-03-31" {
+		t.Fatalf("generated invoice %v", invoice)
+	}
+	if stored := storedUFA(t, s, "U1"); stored["raisedInvTotal"] != "300" {
+		t.Fatalf("raisedInvTotal = %q, want 300", stored["raisedInvTotal"])
+	}
+	assertList(t, "invoices of U2", storedList(t, s, UFA_INVOICE_PREFIX+"U2"))
+
+	//Periods are billed once, and not before they end
+	decode(t, s.mustCall(t, testSeller, "generateDueInvoices", testSeller, "2016-04-29", "U1"), &report)
+	if report.Created != 0 {
+		t.Fatalf("generateDueInvoices billed again: %+v", report)
+	}
+	s.mustFail(t, "not authorized to generate invoices for U1", testBuyer, "generateDueInvoices", testBuyer, "2016-04-30", "U1")
+	s.mustFail(t, "cannot bill as of a date after the transaction", testSeller, "generateDueInvoices", testSeller, "2016-06-30")
+	s.mustFail(t, "expects a date", testSeller, "generateDueInvoices", testSeller, "April")
+	s.mustFail(t, "Invalid UFA provided U9", ADMIN_ROLE, "generateDueInvoices", ADMIN_ROLE, "2016-04-30", "U9")
+
+	decode(t, s.mustCall(t, ADMIN_ROLE, "generateDueInvoices", ADMIN_ROLE, "2016-05-31"), &report)
+	if report.Created != 2 {
+		t.Fatalf("admin generated %+v", report)
+	}
+}
+
+//Pairs breaking the tolerance ceiling are reported and left out
+func TestGenerateDueInvoicesCeiling(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", fixedUFA().with("netCharge", "200").with("chargTolrence", "0"))
+	var report BulkReport
+	decode(t, s.mustCall(t, testSeller, "generateDueInvoices", testSeller, "2016-03-31"), &report)
+	if report.Created != 2 || report.Failed != 1 || report.Results[2].Violations[0].Code != VIOLATION_CEILING_EXCEEDED {
+		t.Fatalf("generateDueInvoices returned %+v", report)
+	}
+}
+
+func TestBillingScheduleAndAmendments(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", fixedUFA().with("startDate", "2016-01-16"))
+	raisePair(t, s, newInvoicePair("U1", "2016-01", "51.61"))
+
+	s.mustFail(t, "not authorized to amend", testOutsider, "amendUFA", "U1", testOutsider, "2016-04-01", `{"recurringAmount":"200"}`)
+	s.mustFail(t, "before the UFA starts", testSeller, "amendUFA", "U1", testSeller, "2015-04-01", `{"recurringAmount":"200"}`)
+	s.mustFail(t, "after the UFA ends", testSeller, "amendUFA", "U1", testSeller, "2016-07-01", `{"recurringAmount":"200"}`)
+	s.mustFail(t, "Field startDate cannot be amended", testSeller, "amendUFA", "U1", testSeller, "2016-04-01", `{"startDate":"2016-01-01"}`)
+	s.mustFail(t, "Field endDate cannot be amended", testSeller, "amendUFA", "U1", testSeller, "2016-04-01", `{"endDate":"2017-12-31"}`)
+	s.mustFail(t, "Tolerence is out of range", testSeller, "amendUFA", "U1", testSeller, "2016-04-01", `{"chargTolrence":"60"}`)
+	s.mustFail(t, "expects the fields to change", testSeller, "amendUFA", "U1", testSeller, "2016-04-01", `{}`)
+	s.mustCall(t, testBuyer, "amendUFA", "U1", testBuyer, "2016-04-16", `{"recurringAmount":"200"}`)
+	s.mustFail(t, "before the last amendment", testSeller, "amendUFA", "U1", testSeller, "2016-03-01", `{"recurringAmount":"150"}`)
+
+	var schedule []SchedulePeriod
+	decode(t, s.mustCall(t, testBuyer, "getBillingSchedule", "U1", testBuyer), &schedule)
+	if len(schedule) != 6 {
+		t.Fatalf("getBillingSchedule returned %d periods, want 6", len(schedule))
+	}
+	//January from the 16th, April at the old rate to the 15th
+	want := []float64{51.61, 100, 100, 150, 200, 200}
+	for i, period := range schedule {
+		if period.ExpectedAmount != want[i] {
+			t.Errorf("%s expected %v, want %v", period.BillingPeriod, period.ExpectedAmount, want[i])
+		}
+	}
+	if !schedule[0].Invoiced || schedule[0].InvoicedAmount != 51.61 || schedule[1].Invoiced {
+		t.Fatalf("invoiced periods %+v", schedule[:2])
+	}
+	//Invoices follow the amended schedule
+	s.mustFail(t, "deviates from the 200 expected for 2016-05", testSeller, "createNewInvoices", testSeller, toJSON(newInvoicePair("U1", "2016-05", "100")))
+
+	s.mustFail(t, "not authorized", testOutsider, "getBillingSchedule", "U1", testOutsider)
+	createUFA(t, s, "U2", newUFA())
+	s.mustFail(t, "has no recurring billing", testSeller, "getBillingSchedule", "U2", testSeller)
+	createUFA(t, s, "U3", fixedUFA().without("endDate"))
+	s.mustFail(t, "expects the last date", testSeller, "getBillingSchedule", "U3", testSeller)
+	decode(t, s.mustCall(t, testSeller, "getBillingSchedule", "U3", testSeller, "2016-03-31"), &schedule)
+	if len(schedule) != 3 {
+		t.Fatalf("open ended schedule has %d periods, want 3", len(schedule))
+	}
+}
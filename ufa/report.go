@@ -0,0 +1,264 @@
+package ufa
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//Invoice types, derived from the position of the invoice in the pair
+const (
+	CUSTOMER_INVOICE = "CUSTOMER"
+	VENDOR_INVOICE   = "VENDOR"
+)
+
+//Layout of the dates used by the reports
+const reportDateLayout = "2006-01-02"
+
+//ReportFilter narrows the records covered by a report
+type ReportFilter struct {
+	//Only UFAs naming the party as seller or buyer, and their invoices
+	Party string `json:"party"`
+	//Only invoices whose billingPeriod is within the range, inclusive.
+	//Bounds are dates as YYYY-MM-DD or period labels such as 2016-07,
+	//2016-Q3 or 2016, compared by the days they cover
+	From string `json:"from"`
+	To   string `json:"to"`
+	//Date the invoices are aged at, as YYYY-MM-DD
+	AsOf string `json:"asOf"`
+}
+
+//A report is a header and rows of the same width
+type report struct {
+	columns []string
+	rows    [][]string
+}
+
+//Report builders by name
+var reports = map[string]func(stub Store, who string, filter ReportFilter) (report, error){
+	"utilization":      utilizationReport,
+	"invoicesByPeriod": invoicesByPeriodReport,
+	"outstanding":      outstandingReport,
+}
+
+//ExportReport builds a finance report over the UFAs who can read. args
+//are who, the report name (utilization, invoicesByPeriod or outstanding),
+//the format (csv or json) and optionally the filter as JSON. The json
+//format is a flat array of objects with one string field per column
+func ExportReport(stub Store, args []string) ([]byte, error) {
+	logger.Info("exportReport called")
+	if len(args) < 3 {
+		return nil, errors.New("exportReport expects who, report name and format")
+	}
+	build, ok := reports[args[1]]
+	if !ok {
+		return nil, errors.New("Unknown report " + args[1])
+	}
+	var filter ReportFilter
+	if len(args) > 3 && args[3] != "" {
+		if err := json.Unmarshal([]byte(args[3]), &filter); err != nil {
+			return nil, errors.New("Invalid report filter")
+		}
+	}
+	for _, bound := range []string{filter.From, filter.To} {
+		if _, _, ok := periodRange(bound); bound != "" && !ok {
+			return nil, errors.New("Invalid report filter period " + bound)
+		}
+	}
+	rep, err := build(stub, caller(stub, args[0]), filter)
+	if err != nil {
+		return nil, err
+	}
+
+	switch args[2] {
+	case "csv":
+		var buffer bytes.Buffer
+		writer := csv.NewWriter(&buffer)
+		writer.Write(rep.columns)
+		writer.WriteAll(rep.rows)
+		return buffer.Bytes(), writer.Error()
+	case "json":
+		outputRecords := make([]map[string]string, 0, len(rep.rows))
+		for _, row := range rep.rows {
+			record := make(map[string]string, len(rep.columns))
+			for i, column := range rep.columns {
+				record[column] = row[i]
+			}
+			outputRecords = append(outputRecords, record)
+		}
+		outputBytes, _ := canonicalJSON(outputRecords)
+		return outputBytes, nil
+	}
+	return nil, errors.New("Unknown report format " + args[2])
+}
+
+//Tells if the UFA names the party. An empty party matches every UFA
+func ufaHasParty(ufaDetails map[string]string, party string) bool {
+	return party == "" || ufaDetails["sellerName"] == party || ufaDetails["buyerName"] == party
+}
+
+//Tells if the days of the billing period are within the filter range. A
+//period which is neither a date nor a period label is outside any range
+func periodInRange(billingPeriod string, filter ReportFilter) bool {
+	if filter.From == "" && filter.To == "" {
+		return true
+	}
+	start, end, ok := periodRange(billingPeriod)
+	if !ok {
+		return false
+	}
+	if from, _, ok := periodRange(filter.From); ok && start.Before(from) {
+		return false
+	}
+	if _, to, ok := periodRange(filter.To); ok && end.After(to) {
+		return false
+	}
+	return true
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+//A UFA with its invoices, in the order they were raised
+type ufaWithInvoices struct {
+	number   string
+	details  map[string]string
+	invoices []map[string]string
+}
+
+//Collect the UFAs who can read and matching the party filter, together
+//with their invoices. Each invoice gets its type from its position in the
+//pair
+func collectUFAs(stub Store, who string, filter ReportFilter) ([]ufaWithInvoices, error) {
+	recordsList, err := getAllRecordsList(stub)
+	if err != nil {
+		return nil, err
+	}
+	config, _ := getConfig(stub)
+	collected := make([]ufaWithInvoices, 0, len(recordsList))
+	for _, ufanumber := range recordsList {
+		ufaDetails, _ := readRecord(stub, ufanumber, UFA_RECORD)
+		if ufaDetails == nil || !canReadUFA(config, who, ufaDetails) || !ufaHasParty(ufaDetails, filter.Party) {
+			continue
+		}
+		invoices := getInvoicesForUFA(stub, ufanumber)
+		for i, invoice := range invoices {
+			if invoice == nil {
+				continue
+			}
+			if i%2 == 0 {
+				invoice["invoiceType"] = CUSTOMER_INVOICE
+			} else {
+				invoice["invoiceType"] = VENDOR_INVOICE
+			}
+		}
+		collected = append(collected, ufaWithInvoices{ufanumber, ufaDetails, invoices})
+	}
+	return collected, nil
+}
+
+//One row per UFA with its ceiling, the amount invoiced and what is left
+func utilizationReport(stub Store, who string, filter ReportFilter) (report, error) {
+	rep := report{columns: []string{"ufanumber", "sellerName", "buyerName", "currency", "netCharge",
+		"chargTolrence", "maxCharge", "raisedInvTotal", "remainingHeadroom", "percentUsed"}}
+	collected, err := collectUFAs(stub, who, filter)
+	if err != nil {
+		return rep, err
+	}
+	for _, u := range collected {
+		netCharge := validateNumber(u.details["netCharge"])
+		tolerence := validateNumber(u.details["chargTolrence"])
+		raisedInvTotal := validateNumber(u.details["raisedInvTotal"])
+		maxCharge := netCharge + netCharge*tolerence/100.0
+		percentUsed := 0.0
+		if netCharge > 0 {
+			percentUsed = raisedInvTotal / netCharge * 100.0
+		}
+		rep.rows = append(rep.rows, []string{u.number, u.details["sellerName"], u.details["buyerName"],
+			u.details["currency"], formatAmount(netCharge), u.details["chargTolrence"], formatAmount(maxCharge),
+			formatAmount(raisedInvTotal), formatAmount(maxCharge - raisedInvTotal), formatAmount(percentUsed)})
+	}
+	return rep, nil
+}
+
+//One row per invoice, ordered by billing period
+func invoicesByPeriodReport(stub Store, who string, filter ReportFilter) (report, error) {
+	rep := report{columns: []string{"billingPeriod", "ufanumber", "invoiceNumber", "invoiceType",
+		"invoiceAmt", "invoiceStatus", "raisedBy", "approverBy"}}
+	collected, err := collectUFAs(stub, who, filter)
+	if err != nil {
+		return rep, err
+	}
+	for _, u := range collected {
+		for _, invoice := range u.invoices {
+			if invoice == nil || !periodInRange(invoice["billingPeriod"], filter) {
+				continue
+			}
+			rep.rows = append(rep.rows, []string{invoice["billingPeriod"], u.number, invoice["invoiceNumber"],
+				invoice["invoiceType"], invoice["invoiceAmt"], invoice["invoiceStatus"], invoice["raisedBy"], invoice["approverBy"]})
+		}
+	}
+	sort.SliceStable(rep.rows, func(i, j int) bool { return rep.rows[i][0] < rep.rows[j][0] })
+	return rep, nil
+}
+
+//Aging bucket of an invoice raised the given number of days ago
+func agingBucket(days int) string {
+	switch {
+	case days <= 30:
+		return "0-30"
+	case days <= 60:
+		return "31-60"
+	case days <= 90:
+		return "61-90"
+	}
+	return "90+"
+}
+
+//One row per invoice which is not paid, with the balance left and its
+//aging bucket. Invoices are aged from their invoiceDate to the asOf date
+//of the filter; without either the bucket is left empty
+func outstandingReport(stub Store, who string, filter ReportFilter) (report, error) {
+	rep := report{columns: []string{"ufanumber", "invoiceNumber", "invoiceType", "billingPeriod", "invoiceDate",
+		"invoiceAmt", "paidAmt", "outstanding", "ageDays", "agingBucket"}}
+	var asOf time.Time
+	if filter.AsOf != "" {
+		var err error
+		if asOf, err = time.Parse(reportDateLayout, filter.AsOf); err != nil {
+			return rep, errors.New("asOf should be a date as YYYY-MM-DD")
+		}
+	}
+	collected, err := collectUFAs(stub, who, filter)
+	if err != nil {
+		return rep, err
+	}
+	for _, u := range collected {
+		for _, invoice := range u.invoices {
+			if invoice == nil || invoice["invoiceStatus"] == INVOICE_PAID || !periodInRange(invoice["billingPeriod"], filter) {
+				continue
+			}
+			invoiceAmt := validateNumber(invoice["invoiceAmt"])
+			paidAmt := validateNumber(invoice["paidAmt"])
+			if paidAmt < 0 {
+				paidAmt = 0
+			}
+			if invoiceAmt-paidAmt <= 0 {
+				continue
+			}
+			ageDays, bucket := "", ""
+			if invoiceDate, err := time.Parse(reportDateLayout, invoice["invoiceDate"]); err == nil && !asOf.IsZero() {
+				days := int(asOf.Sub(invoiceDate).Hours() / 24)
+				ageDays, bucket = strconv.Itoa(days), agingBucket(days)
+			}
+			rep.rows = append(rep.rows, []string{u.number, invoice["invoiceNumber"], invoice["invoiceType"],
+				invoice["billingPeriod"], invoice["invoiceDate"], formatAmount(invoiceAmt), formatAmount(paidAmt),
+				formatAmount(invoiceAmt - paidAmt), ageDays, bucket})
+		}
+	}
+	return rep, nil
+}
@@ -0,0 +1,120 @@
+package ufa
+
+import (
+	"strings"
+	"testing"
+)
+
+//Ledger with two UFAs of the seller, invoiced over three months
+func reportLedger(t *testing.T) *mockStub {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", newUFA())
+	createUFA(t, s, "U2", newUFA().with("buyerName", "B2").with("netCharge", "500"))
+	raisePair(t, s, newInvoicePair("U1", "2016-02", "300"))
+	raisePair(t, s, newInvoicePair("U2", "2016-01", "100"))
+	pair := newInvoicePair("U1", "2016-03", "200")
+	for _, invoice := range pair {
+		invoice["invoiceDate"] = "2016-04-01"
+	}
+	raisePair(t, s, pair)
+	return s
+}
+
+func TestUtilizationReport(t *testing.T) {
+	s := reportLedger(t)
+	var rows []map[string]string
+	decode(t, s.mustCall(t, testSeller, "exportReport", testSeller, "utilization", "json"), &rows)
+	if len(rows) != 2 {
+		t.Fatalf("utilization has %d rows, want 2", len(rows))
+	}
+	if rows[0]["maxCharge"] != "1100.00" || rows[0]["raisedInvTotal"] != "500.00" || rows[0]["remainingHeadroom"] != "600.00" || rows[0]["percentUsed"] != "50.00" {
+		t.Fatalf("utilization of U1 %v", rows[0])
+	}
+
+	//Parties see their own UFAs only
+	decode(t, s.mustCall(t, "B2", "exportReport", "B2", "utilization", "json"), &rows)
+	if len(rows) != 1 || rows[0]["ufanumber"] != "U2" {
+		t.Fatalf("utilization for B2 %v", rows)
+	}
+	decode(t, s.mustCall(t, testSeller, "exportReport", testSeller, "utilization", "json", `{"party":"B1"}`), &rows)
+	if len(rows) != 1 || rows[0]["ufanumber"] != "U1" {
+		t.Fatalf("utilization filtered on B1 %v", rows)
+	}
+
+	output := s.mustCall(t, testSeller, "exportReport", testSeller, "utilization", "csv")
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) != 3 || lines[0] != "ufanumber,sellerName,buyerName,currency,netCharge,chargTolrence,maxCharge,raisedInvTotal,remainingHeadroom,percentUsed" {
+		t.Fatalf("utilization csv\n%s", output)
+	}
+}
+
+func TestInvoicesByPeriodReport(t *testing.T) {
+	s := reportLedger(t)
+	var rows []map[string]string
+	decode(t, s.mustCall(t, testSeller, "exportReport", testSeller, "invoicesByPeriod", "json"), &rows)
+	periods := make([]string, 0, len(rows))
+	for _, row := range rows {
+		periods = append(periods, row["billingPeriod"]+" "+row["invoiceType"])
+	}
+	assertList(t, "invoice periods", periods, "2016-01 CUSTOMER", "2016-01 VENDOR", "2016-02 CUSTOMER", "2016-02 VENDOR",
+		"2016-03 CUSTOMER", "2016-03 VENDOR")
+
+	decode(t, s.mustCall(t, testSeller, "exportReport", testSeller, "invoicesByPeriod", "json", `{"from":"2016-02","to":"2016-02"}`), &rows)
+	if len(rows) != 2 || rows[0]["invoiceNumber"] != "U1-2016-02-C" {
+		t.Fatalf("invoices of February %v", rows)
+	}
+	//Bounds are compared as days, whatever the label
+	decode(t, s.mustCall(t, testSeller, "exportReport", testSeller, "invoicesByPeriod", "json", `{"from":"2016-Q1","to":"2016-Q1"}`), &rows)
+	if len(rows) != 6 {
+		t.Fatalf("invoices of the first quarter %v", rows)
+	}
+	decode(t, s.mustCall(t, testSeller, "exportReport", testSeller, "invoicesByPeriod", "json", `{"from":"2016-02-01","to":"2016-02-28"}`), &rows)
+	if len(rows) != 0 {
+		t.Fatalf("February cut short matched %v", rows)
+	}
+	decode(t, s.mustCall(t, testSeller, "exportReport", testSeller, "invoicesByPeriod", "json", `{"from":"2016-02-01"}`), &rows)
+	if len(rows) != 4 {
+		t.Fatalf("invoices from February %v", rows)
+	}
+	s.mustFail(t, "Invalid report filter period Feb", testSeller, "exportReport", testSeller, "invoicesByPeriod", "json", `{"from":"Feb"}`)
+}
+
+func TestOutstandingReport(t *testing.T) {
+	s := reportLedger(t)
+	var rows []map[string]string
+	decode(t, s.mustCall(t, testBuyer, "exportReport", testBuyer, "outstanding", "json", `{"asOf":"2016-05-16"}`), &rows)
+	if len(rows) != 4 {
+		t.Fatalf("outstanding has %d rows, want 4", len(rows))
+	}
+	aged := rows[2]
+	if aged["invoiceNumber"] != "U1-2016-03-C" || aged["outstanding"] != "200.00" || aged["ageDays"] != "45" || aged["agingBucket"] != "31-60" {
+		t.Fatalf("aged invoice %v", aged)
+	}
+	if rows[0]["agingBucket"] != "" {
+		t.Fatalf("invoice without a date aged as %v", rows[0])
+	}
+
+	s.mustFail(t, "asOf should be a date", testBuyer, "exportReport", testBuyer, "outstanding", "json", `{"asOf":"May"}`)
+}
+
+func TestExportReportArguments(t *testing.T) {
+	s := reportLedger(t)
+	s.mustFail(t, "Unknown report aging", testSeller, "exportReport", testSeller, "aging", "json")
+	s.mustFail(t, "Unknown report format xml", testSeller, "exportReport", testSeller, "utilization", "xml")
+	s.mustFail(t, "Invalid report filter", testSeller, "exportReport", testSeller, "utilization", "json", "party")
+	s.mustFail(t, "exportReport expects", testSeller, "exportReport", testSeller, "utilization")
+
+	var rows []map[string]string
+	decode(t, s.mustCall(t, testOutsider, "exportReport", testOutsider, "utilization", "json"), &rows)
+	if len(rows) != 0 {
+		t.Fatalf("outsider sees %v", rows)
+	}
+}
+
+func TestAgingBucket(t *testing.T) {
+	for days, bucket := range map[int]string{0: "0-30", 30: "0-30", 31: "31-60", 60: "31-60", 90: "61-90", 91: "90+"} {
+		if got := agingBucket(days); got != bucket {
+			t.Errorf("agingBucket(%d) = %q, want %q", days, got, bucket)
+		}
+	}
+}
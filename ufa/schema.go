@@ -0,0 +1,177 @@
+package ufa
+
+import (
+	"errors"
+	"strconv"
+)
+
+//SCHEMA_VERSION_FIELD Field carrying the schema version of a stored record
+const SCHEMA_VERSION_FIELD = "schemaVersion"
+
+//UFA_RECORD Kind of the UFA records
+const UFA_RECORD = "UFA"
+
+//INVOICE_RECORD Kind of the invoice records
+const INVOICE_RECORD = "INVOICE"
+
+//RecordUpgrade moves a record from one schema version to the next
+type RecordUpgrade func(record map[string]string) map[string]string
+
+//Upgrade functions per record kind. The function at index i upgrades a
+//record of version i to version i+1, so the current version of a kind is
+//the number of functions registered for it. Records written before
+//versioning was introduced are version 0
+var recordUpgrades = map[string][]RecordUpgrade{
+	UFA_RECORD: {
+		//Version 1: the raised invoice total starts at zero instead of
+		//being missing
+		func(record map[string]string) map[string]string {
+			if record["raisedInvTotal"] == "" {
+				record["raisedInvTotal"] = "0"
+			}
+			return record
+		},
+	},
+	INVOICE_RECORD: {
+		//Version 1: only the version field is added
+		func(record map[string]string) map[string]string {
+			return record
+		},
+	},
+}
+
+//RegisterUpgrade adds the upgrade from the current version of the record
+//kind to the next one
+func RegisterUpgrade(kind string, upgrade RecordUpgrade) {
+	recordUpgrades[kind] = append(recordUpgrades[kind], upgrade)
+}
+
+//CurrentSchemaVersion returns the version new records of the kind are
+//written with
+func CurrentSchemaVersion(kind string) int {
+	return len(recordUpgrades[kind])
+}
+
+//Returns the version stored in the record
+func recordVersion(record map[string]string) int {
+	version, err := strconv.Atoi(record[SCHEMA_VERSION_FIELD])
+	if err != nil {
+		return 0
+	}
+	return version
+}
+
+//Apply the pending upgrades to the record. Returns the version the record
+//had before
+func upgradeRecord(kind string, record map[string]string) (map[string]string, int) {
+	fromVersion := recordVersion(record)
+	upgrades := recordUpgrades[kind]
+	for version := fromVersion; version < len(upgrades); version++ {
+		record = upgrades[version](record)
+		record[SCHEMA_VERSION_FIELD] = strconv.Itoa(version + 1)
+	}
+	return record, fromVersion
+}
+
+//Bring a record supplied by a client to the current schema version, so
+//new records get the same defaults as migrated ones
+func newRecord(kind string, record map[string]string) map[string]string {
+	if record == nil {
+		record = make(map[string]string)
+	}
+	delete(record, SCHEMA_VERSION_FIELD)
+	record, _ = upgradeRecord(kind, record)
+	return record
+}
+
+//Read a record and bring it to the current schema version. Returns nil
+//when the key holds nothing
+func readRecord(stub Store, key string, kind string) (map[string]string, error) {
+	record, err := loadRecord(stub, key)
+	if err != nil || record == nil {
+		return nil, err
+	}
+	record, _ = upgradeRecord(kind, record)
+	return record, nil
+}
+
+//Store a record stamped with the current schema version
+func writeRecord(stub Store, key string, kind string, record map[string]string) error {
+	record[SCHEMA_VERSION_FIELD] = strconv.Itoa(CurrentSchemaVersion(kind))
+	return putRecordState(stub, key, kind, record)
+}
+
+//Record changed by a migration
+type migrationEntry struct {
+	Key         string `json:"key"`
+	Kind        string `json:"kind"`
+	FromVersion int    `json:"fromVersion"`
+	ToVersion   int    `json:"toVersion"`
+}
+
+//Walk the master lists and collect the records which are behind the
+//current schema version. The records are written back when apply is set
+func migrateRecords(stub Store, apply bool) ([]migrationEntry, error) {
+	entries := make([]migrationEntry, 0)
+
+	ufaList, err := getAllRecordsList(stub)
+	if err != nil {
+		return nil, err
+	}
+	invoiceList, err := getAllInvloiceFromMasterList(stub)
+	if err != nil {
+		return nil, err
+	}
+	kinds := map[string][]string{UFA_RECORD: ufaList, INVOICE_RECORD: invoiceList}
+	for _, kind := range []string{UFA_RECORD, INVOICE_RECORD} {
+		for _, key := range kinds[kind] {
+			record, err := loadRecord(stub, key)
+			if err != nil || record == nil {
+				logger.Info("migrateRecords: skipping unreadable record " + key)
+				continue
+			}
+			record, fromVersion := upgradeRecord(kind, record)
+			if fromVersion >= CurrentSchemaVersion(kind) {
+				continue
+			}
+			entries = append(entries, migrationEntry{key, kind, fromVersion, CurrentSchemaVersion(kind)})
+			if apply {
+				writeRecord(stub, key, kind, record)
+			}
+		}
+	}
+	return entries, nil
+}
+
+//MigrateState upgrades every stored UFA and invoice to the current schema
+//version and returns the records changed
+func MigrateState(stub Store, args []string) ([]byte, error) {
+	logger.Info("migrateState called")
+	who := caller(stub, argAt(args, 0))
+	if !isAdmin(stub, who) {
+		return nil, errors.New("User is not authorized to migrate the state")
+	}
+	entries, err := migrateRecords(stub, true)
+	if err != nil {
+		return nil, err
+	}
+	outputBytes, _ := canonicalJSON(entries)
+	logger.Info("migrateState migrated " + string(outputBytes))
+	return outputBytes, nil
+}
+
+//MigrateStateDryRun reports the records MigrateState would change without
+//writing them. Like MigrateState it is reserved to the admins
+func MigrateStateDryRun(stub Store, args []string) ([]byte, error) {
+	logger.Info("migrateStateDryRun called")
+	who := caller(stub, argAt(args, 0))
+	if !isAdmin(stub, who) {
+		return nil, errors.New("User is not authorized to migrate the state")
+	}
+	entries, err := migrateRecords(stub, false)
+	if err != nil {
+		return nil, err
+	}
+	outputBytes, _ := canonicalJSON(entries)
+	return outputBytes, nil
+}
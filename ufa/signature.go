@@ -0,0 +1,156 @@
+package ufa
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+)
+
+//RAISER_SIGNATURE_FIELD Invoice field holding the signature of the raiser
+const RAISER_SIGNATURE_FIELD = "raisedBySignature"
+
+//APPROVER_SIGNATURE_FIELD Invoice field holding the signature of the approver
+const APPROVER_SIGNATURE_FIELD = "approverSignature"
+
+//Fields set by the ledger or by payments, never covered by a signature
+var unsignedInvoiceFields = []string{SCHEMA_VERSION_FIELD, PRIVATE_HASH_FIELD, APPROVER_SIGNATURE_FIELD, "paidAmt", "paidDate"}
+
+//Serializes the invoice without the excluded fields. The JSON encoder
+//sorts the keys, so every party gets the same bytes
+func invoiceSigningBytes(invoice map[string]string, exclude ...string) []byte {
+	signed := make(map[string]string, len(invoice))
+	for key, value := range invoice {
+		signed[key] = value
+	}
+	for _, field := range append(exclude, unsignedInvoiceFields...) {
+		delete(signed, field)
+	}
+	signedBytes, _ := canonicalJSON(signed)
+	return signedBytes
+}
+
+//RaiserSigningBytes Returns the bytes the raiser signs: the invoice as
+//raised, without its status and signatures
+func RaiserSigningBytes(invoice map[string]string) []byte {
+	return invoiceSigningBytes(invoice, RAISER_SIGNATURE_FIELD, "invoiceStatus")
+}
+
+//ApproverSigningBytes Returns the bytes the approver signs: the approved
+//invoice including the signature of the raiser
+func ApproverSigningBytes(invoice map[string]string) []byte {
+	approved := make(map[string]string, len(invoice))
+	for key, value := range invoice {
+		approved[key] = value
+	}
+	approved["invoiceStatus"] = INVOICE_APPROVED
+	return invoiceSigningBytes(approved)
+}
+
+//Parses a PEM encoded PKIX public key. ECDSA and Ed25519 keys are supported
+func parsePublicKey(keyPEM string) (interface{}, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, errors.New("Public key should be PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("Public key could not be parsed: " + err.Error())
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	}
+	return nil, errors.New("Public key should be ECDSA or Ed25519")
+}
+
+//Checks the base64 signature of the party over the message against each
+//of its registered keys. ECDSA signatures are ASN.1 encoded over the
+//SHA-256 of the message
+func verifySignature(stub Store, id string, message []byte, signature string) error {
+	party, err := getParty(stub, id)
+	if err != nil {
+		return err
+	}
+	if party == nil || len(party.PublicKeys) == 0 {
+		return errors.New("No public key is registered for " + id)
+	}
+	sigBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errors.New("Signature of " + id + " should be base64 encoded")
+	}
+	for _, keyPEM := range party.PublicKeys {
+		key, err := parsePublicKey(keyPEM)
+		if err != nil {
+			return err
+		}
+		switch key := key.(type) {
+		case *ecdsa.PublicKey:
+			digest := sha256.Sum256(message)
+			if ecdsa.VerifyASN1(key, digest[:], sigBytes) {
+				return nil
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(key, message, sigBytes) {
+				return nil
+			}
+		}
+	}
+	return errors.New("Signature of " + id + " does not match")
+}
+
+//Checks the raiser signature of a new invoice. Returns the validation
+//message, empty when the invoice is acceptable
+func validateRaiserSignature(stub Store, config Config, invoice map[string]string) string {
+	signature := invoice[RAISER_SIGNATURE_FIELD]
+	if signature == "" {
+		if config.RequireInvoiceSignatures {
+			return "\nInvoice " + invoice["invoiceNumber"] + " is not signed"
+		}
+		return ""
+	}
+	//The signed invoice names both parties, so it can be verified later
+	//and approval leaves it unchanged
+	if invoice["raisedBy"] == "" || invoice["approverBy"] == "" {
+		return "\nSigned invoice " + invoice["invoiceNumber"] + " should name the raiser and the approver"
+	}
+	if err := verifySignature(stub, invoice["raisedBy"], RaiserSigningBytes(invoice), signature); err != nil {
+		return "\n" + err.Error()
+	}
+	return ""
+}
+
+//VerifyInvoiceSignatures Checks the signatures of a stored invoice against
+//the registered keys. args are the invoice number and who
+func VerifyInvoiceSignatures(stub Store, args []string) ([]byte, error) {
+	logger.Info("verifyInvoiceSignatures called")
+	if len(args) < 1 {
+		return nil, errors.New("verifyInvoiceSignatures expects the invoice number and who")
+	}
+	invoiceNumber := args[0]
+	invoice, _ := readRecord(stub, invoiceNumber, INVOICE_RECORD)
+	if invoice == nil {
+		return nil, errors.New("Invalid invoice provided " + invoiceNumber)
+	}
+	config, _ := getConfig(stub)
+	if !canReadInvoice(stub, config, caller(stub, argAt(args, 1)), invoice) {
+		return nil, errors.New("User is not authorized to read invoice " + invoiceNumber)
+	}
+	result := map[string]string{"invoiceNumber": invoiceNumber}
+	check := func(role string, party string, message []byte, signature string) {
+		if signature == "" {
+			result[role] = "UNSIGNED"
+		} else if err := verifySignature(stub, party, message, signature); err != nil {
+			result[role] = "INVALID: " + err.Error()
+		} else {
+			result[role] = "VALID"
+		}
+	}
+	check("raiser", invoice["raisedBy"], RaiserSigningBytes(invoice), invoice[RAISER_SIGNATURE_FIELD])
+	check("approver", invoice["approverBy"], ApproverSigningBytes(invoice), invoice[APPROVER_SIGNATURE_FIELD])
+	outputBytes, _ := canonicalJSON(result)
+	return outputBytes, nil
+}
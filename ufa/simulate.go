@@ -0,0 +1,266 @@
+package ufa
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+)
+
+//Codes of the rule violations found on invoices
+const (
+	VIOLATION_MISSING_INVOICE   = "MISSING_INVOICE"
+	VIOLATION_UFA_NOT_FOUND     = "UFA_NOT_FOUND"
+	VIOLATION_UFA_MISMATCH      = "UFA_MISMATCH"
+	VIOLATION_CURRENCY          = "CURRENCY_NOT_SUPPORTED"
+	VIOLATION_UFA_NOT_ACTIVE    = "UFA_NOT_ACTIVE"
+	VIOLATION_OUTSIDE_TERM      = "OUTSIDE_TERM"
+	VIOLATION_PERIOD_INVOICED   = "PERIOD_ALREADY_INVOICED"
+	VIOLATION_AMOUNT_MISMATCH   = "AMOUNT_MISMATCH"
+	VIOLATION_CEILING_EXCEEDED  = "CEILING_EXCEEDED"
+	VIOLATION_PARTY             = "PARTY_INVALID"
+	VIOLATION_SIGNATURE         = "SIGNATURE_INVALID"
+	VIOLATION_PERIOD_DEVIATION  = "PERIOD_AMOUNT_DEVIATION"
+	VIOLATION_DUPLICATE_INVOICE = "DUPLICATE_INVOICE"
+	VIOLATION_INVALID_AMOUNT    = "INVALID_AMOUNT"
+	VIOLATION_NOT_AUTHORIZED    = "NOT_AUTHORIZED"
+)
+
+//Violation is a rule an invoice pair breaks
+type Violation struct {
+	Code          string `json:"code"`
+	Message       string `json:"message"`
+	InvoiceNumber string `json:"invoiceNumber,omitempty"`
+	BillingPeriod string `json:"billingPeriod,omitempty"`
+}
+
+//Simulation is the effect invoices would have on their UFA
+type Simulation struct {
+	UFANumber      string  `json:"ufanumber"`
+	NetCharge      float64 `json:"netCharge"`
+	Tolerance      float64 `json:"chargTolrence"`
+	MaxCharge      float64 `json:"maxCharge"`
+	RaisedInvTotal float64 `json:"raisedInvTotal"`
+	//Totals once the pairs without violations are raised
+	ProjectedRaisedInvTotal float64 `json:"projectedRaisedInvTotal"`
+	Headroom                float64 `json:"headroom"`
+	//Share of the net charge, in percent, invoiced beyond it
+	ToleranceUsed  float64     `json:"toleranceUsed"`
+	CoveredPeriods []string    `json:"coveredPeriods"`
+	Violations     []Violation `json:"violations"`
+	Valid          bool        `json:"valid"`
+}
+
+//State of a UFA as invoices are raised against it. Pairs are checked
+//against the projection, so several pairs in one transaction see each
+//other although its reads do not see its writes
+type invoiceProjection struct {
+	ufanumber  string
+	ufaDetails map[string]string
+	amendments []Amendment
+	raised     float64
+	periods    map[string]bool
+	//Invoice numbers raised in the projection. A batch shares one set
+	//between the projections of its UFAs
+	invoices map[string]bool
+}
+
+//Returns the projection of the UFA as stored, nil when it does not exist
+func loadProjection(stub Store, ufanumber string) *invoiceProjection {
+	ufaDetails, err := readRecord(stub, ufanumber, UFA_RECORD)
+	if err != nil || ufaDetails == nil {
+		return nil
+	}
+	projection := &invoiceProjection{
+		ufanumber:  ufanumber,
+		ufaDetails: ufaDetails,
+		amendments: getAmendments(stub, ufanumber),
+		raised:     validateNumber(ufaDetails["raisedInvTotal"]),
+		periods:    make(map[string]bool),
+		invoices:   make(map[string]bool),
+	}
+	for _, invoice := range getInvoicesForUFA(stub, ufanumber) {
+		projection.periods[invoice["billingPeriod"]] = true
+	}
+	return projection
+}
+
+func (p *invoiceProjection) netCharge() float64 {
+	return validateNumber(p.ufaDetails["netCharge"])
+}
+
+func (p *invoiceProjection) maxCharge() float64 {
+	netCharge := p.netCharge()
+	return netCharge + netCharge*validateNumber(p.ufaDetails["chargTolrence"])/100.0
+}
+
+//Amounts are summed as floats, rounding drops the noise so totals such as
+//33.33 + 33.33 + 33.34 compare equal to the net charge
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*1e6) / 1e6
+}
+
+//Record a pair as raised
+func (p *invoiceProjection) apply(custInvoice map[string]string, vendInvoice map[string]string) {
+	p.raised = roundAmount(p.raised + validateNumber(custInvoice["invoiceAmt"]))
+	p.periods[custInvoice["billingPeriod"]] = true
+	p.invoices[custInvoice["invoiceNumber"]] = true
+	p.invoices[vendInvoice["invoiceNumber"]] = true
+}
+
+//Returns the rules the customer and vendor invoices break when raised
+//against the projection. Both invoices are assumed to carry the same amount
+func checkInvoicePair(stub Store, config Config, p *invoiceProjection, custInvoice map[string]string, vendInvoice map[string]string) []Violation {
+	violations := make([]Violation, 0)
+	add := func(code string, message string, invoice map[string]string) {
+		violations = append(violations, Violation{
+			Code:          code,
+			Message:       strings.TrimPrefix(message, "\n"),
+			InvoiceNumber: invoice["invoiceNumber"],
+			BillingPeriod: invoice["billingPeriod"],
+		})
+	}
+	billingPeriod := custInvoice["billingPeriod"]
+	invAmt1 := validateNumber(custInvoice["invoiceAmt"])
+	invAmt2 := validateNumber(vendInvoice["invoiceAmt"])
+
+	for _, invoice := range []map[string]string{custInvoice, vendInvoice} {
+		number := invoice["invoiceNumber"]
+		if number == "" {
+			add(VIOLATION_MISSING_INVOICE, "invoiceNumber is missing", invoice)
+		} else if existing, _ := stub.GetState(number); existing != nil || p.invoices[number] {
+			add(VIOLATION_DUPLICATE_INVOICE, "Invoice "+number+" already exists", invoice)
+		}
+	}
+	if number := custInvoice["invoiceNumber"]; number != "" && number == vendInvoice["invoiceNumber"] {
+		add(VIOLATION_DUPLICATE_INVOICE, "Customer and Vendor invoices are both numbered "+number, vendInvoice)
+	}
+	if number := vendInvoice["ufanumber"]; number != "" && number != p.ufanumber {
+		add(VIOLATION_UFA_MISMATCH, "Vendor invoice is raised against UFA "+number, vendInvoice)
+	}
+	if currency := custInvoice["currency"]; currency != "" && !contains(config.Currencies, currency) {
+		add(VIOLATION_CURRENCY, "Currency "+currency+" is not supported", custInvoice)
+	}
+	now, _ := txTime(stub)
+	if termMessage := validateInvoiceTerm(p.ufaDetails, custInvoice, now); termMessage != "" {
+		if p.ufaDetails["ufaStatus"] != UFA_ACTIVE || ufaEnded(p.ufaDetails, now) {
+			add(VIOLATION_UFA_NOT_ACTIVE, termMessage, custInvoice)
+		} else {
+			add(VIOLATION_OUTSIDE_TERM, termMessage, custInvoice)
+		}
+	}
+	if p.periods[billingPeriod] {
+		add(VIOLATION_PERIOD_INVOICED, "Invoices are already raised for "+billingPeriod, custInvoice)
+	}
+	for _, invoice := range []map[string]string{custInvoice, vendInvoice} {
+		if validateNumber(invoice["invoiceAmt"]) < 0 {
+			add(VIOLATION_INVALID_AMOUNT, "Invoice amount "+invoice["invoiceAmt"]+" is not a number of zero or more", invoice)
+		}
+	}
+	if invAmt1 != invAmt2 {
+		add(VIOLATION_AMOUNT_MISMATCH, "Customer and Vendor Invoice Amounts are not same", custInvoice)
+	}
+	if msg := validatePeriodAmount(p.ufaDetails, p.amendments, custInvoice); msg != "" {
+		add(VIOLATION_PERIOD_DEVIATION, msg, custInvoice)
+	}
+	if code, msg := validateUsageAmount(stub, p.ufanumber, p.ufaDetails, custInvoice); code != "" {
+		add(code, msg, custInvoice)
+	}
+	if roundAmount(p.maxCharge()) < roundAmount(invAmt1+p.raised) {
+		add(VIOLATION_CEILING_EXCEEDED, "Total invoice amount exceeded", custInvoice)
+	}
+	for _, invoice := range []map[string]string{custInvoice, vendInvoice} {
+		if msg := validatePartyRef(stub, config, "raisedBy", invoice["raisedBy"], ""); msg != "" {
+			add(VIOLATION_PARTY, msg, invoice)
+		}
+		if msg := validatePartyRef(stub, config, "approverBy", invoice["approverBy"], APPROVER_ROLE); msg != "" {
+			add(VIOLATION_PARTY, msg, invoice)
+		}
+		if msg := validateRaiserSignature(stub, config, invoice); msg != "" {
+			add(VIOLATION_SIGNATURE, msg, invoice)
+		}
+	}
+	return violations
+}
+
+//SimulateInvoices Shows the effect of raising invoices on their UFA
+//without writing anything. args are who and the invoices as JSON, each
+//customer invoice followed by its vendor invoice, all against one UFA.
+//Pairs are projected in order and those breaking a rule are left out
+func SimulateInvoices(stub Store, args []string) ([]byte, error) {
+	logger.Info("simulateInvoices called")
+	if len(args) < 2 {
+		return nil, errors.New("simulateInvoices expects who and the invoices as JSON")
+	}
+	who := caller(stub, args[0])
+	var invoiceList []map[string]string
+	if err := json.Unmarshal([]byte(argAt(args, 1)), &invoiceList); err != nil {
+		return nil, errors.New("simulateInvoices expects the invoices as JSON")
+	}
+	if len(invoiceList) == 0 {
+		return nil, errors.New("simulateInvoices expects at least one invoice pair")
+	}
+	ufanumber := invoiceList[0]["ufanumber"]
+	config, _ := getConfig(stub)
+	simulation := Simulation{
+		UFANumber:      ufanumber,
+		CoveredPeriods: make([]string, 0),
+		Violations:     make([]Violation, 0),
+	}
+	projection := loadProjection(stub, ufanumber)
+	if projection == nil {
+		simulation.Violations = append(simulation.Violations, Violation{Code: VIOLATION_UFA_NOT_FOUND, Message: "Invalid UFA provided " + ufanumber})
+		outputBytes, err := canonicalJSON(simulation)
+		if err != nil {
+			return nil, err
+		}
+		return outputBytes, nil
+	}
+	if !canReadUFA(config, who, projection.ufaDetails) {
+		return nil, errors.New("User is not authorized to read UFA " + ufanumber)
+	}
+	simulation.NetCharge = projection.netCharge()
+	simulation.Tolerance = validateNumber(projection.ufaDetails["chargTolrence"])
+	simulation.MaxCharge = projection.maxCharge()
+	simulation.RaisedInvTotal = projection.raised
+
+	for i := 0; i < len(invoiceList); i += 2 {
+		custInvoice := invoiceList[i]
+		if i+1 == len(invoiceList) {
+			simulation.Violations = append(simulation.Violations, Violation{
+				Code:          VIOLATION_MISSING_INVOICE,
+				Message:       "Invoice is missing for Customer or Vendor",
+				InvoiceNumber: custInvoice["invoiceNumber"],
+				BillingPeriod: custInvoice["billingPeriod"],
+			})
+			break
+		}
+		if number := custInvoice["ufanumber"]; number != ufanumber {
+			simulation.Violations = append(simulation.Violations, Violation{
+				Code:          VIOLATION_UFA_MISMATCH,
+				Message:       "Invoice is raised against UFA " + number,
+				InvoiceNumber: custInvoice["invoiceNumber"],
+				BillingPeriod: custInvoice["billingPeriod"],
+			})
+			continue
+		}
+		violations := checkInvoicePair(stub, config, projection, custInvoice, invoiceList[i+1])
+		if len(violations) == 0 {
+			projection.apply(custInvoice, invoiceList[i+1])
+			simulation.CoveredPeriods = append(simulation.CoveredPeriods, custInvoice["billingPeriod"])
+		}
+		simulation.Violations = append(simulation.Violations, violations...)
+	}
+
+	simulation.ProjectedRaisedInvTotal = projection.raised
+	simulation.Headroom = simulation.MaxCharge - projection.raised
+	if simulation.NetCharge > 0 && projection.raised > simulation.NetCharge {
+		simulation.ToleranceUsed = (projection.raised - simulation.NetCharge) / simulation.NetCharge * 100
+	}
+	simulation.Valid = len(simulation.Violations) == 0
+	outputBytes, err := canonicalJSON(simulation)
+	if err != nil {
+		return nil, err
+	}
+	return outputBytes, nil
+}
@@ -0,0 +1,40 @@
+package ufa
+
+import (
+	"log"
+	"os"
+)
+
+//Store is the minimal state access needed by the UFA rules. The Fabric
+//chaincode stub satisfies it as is, so the same functions run on a peer
+//and in off-chain tools
+type Store interface {
+	GetState(key string) ([]byte, error)
+	PutState(key string, value []byte) error
+}
+
+//StateDeleter is implemented by stores which can remove keys, such as the
+//Fabric stub
+type StateDeleter interface {
+	DelState(key string) error
+}
+
+//Logger is used for the diagnostic messages written by the package
+type Logger interface {
+	Info(args ...interface{})
+}
+
+type stdLogger struct {
+	*log.Logger
+}
+
+func (l stdLogger) Info(args ...interface{}) {
+	l.Print(args...)
+}
+
+var logger Logger = stdLogger{log.New(os.Stderr, "UFAChainCode ", log.LstdFlags)}
+
+//SetLogger replaces the logger used by the package
+func SetLogger(l Logger) {
+	logger = l
+}
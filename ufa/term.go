@@ -0,0 +1,241 @@
+package ufa
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+//Status of a UFA
+const (
+	UFA_ACTIVE  = "ACTIVE"
+	UFA_EXPIRED = "EXPIRED"
+	UFA_RENEWED = "RENEWED"
+)
+
+//Renewal policies deciding how much unused net charge moves to the
+//successor of a renewed UFA
+const (
+	RENEWAL_CARRY_NONE   = "NONE"
+	RENEWAL_CARRY_FULL   = "FULL"
+	RENEWAL_CARRY_CAPPED = "CAPPED"
+)
+
+//Layout of startDate and endDate
+const termDateLayout = "2006-01-02"
+
+//Fields of a UFA kept by the ledger, which clients cannot set
+var ledgerUFAFields = []string{"raisedInvTotal", "ufaStatus", "successor", "predecessor", "carriedOver", SCHEMA_VERSION_FIELD, PRIVATE_HASH_FIELD}
+
+func init() {
+	//Version 2: every UFA carries a status
+	RegisterUpgrade(UFA_RECORD, func(record map[string]string) map[string]string {
+		if record["ufaStatus"] == "" {
+			record["ufaStatus"] = UFA_ACTIVE
+		}
+		return record
+	})
+}
+
+//Check the term of a new UFA. Both dates are optional
+func validateTerm(ufaDetails map[string]string) string {
+	var start, end time.Time
+	var err error
+	if ufaDetails["startDate"] != "" {
+		if start, err = time.Parse(termDateLayout, ufaDetails["startDate"]); err != nil {
+			return "\nStart date should be a date as YYYY-MM-DD"
+		}
+	}
+	if ufaDetails["endDate"] != "" {
+		if end, err = time.Parse(termDateLayout, ufaDetails["endDate"]); err != nil {
+			return "\nEnd date should be a date as YYYY-MM-DD"
+		}
+	}
+	if !start.IsZero() && !end.IsZero() && end.Before(start) {
+		return "\nEnd date is before the start date"
+	}
+	return ""
+}
+
+//Tells if the term of the UFA ended before now, the transaction time. A
+//zero now is unknown, the UFA then ends when it is swept
+func ufaEnded(ufaDetails map[string]string, now time.Time) bool {
+	end, err := time.Parse(termDateLayout, ufaDetails["endDate"])
+	if err != nil || now.IsZero() {
+		return false
+	}
+	return !now.Before(end.AddDate(0, 0, 1))
+}
+
+//Check an invoice falls within the term of its UFA. The invoice date, or
+//else the billing period, must overlap the term, so a period "2016-03" or
+//"2016-Q1" is within a term ending "2016-03-15". now is the transaction
+//time, past the end date the UFA takes no invoices whatever dates they
+//carry
+func validateInvoiceTerm(ufaDetails map[string]string, invoice map[string]string, now time.Time) string {
+	if ufaDetails["ufaStatus"] != UFA_ACTIVE {
+		return "\nUFA is " + ufaDetails["ufaStatus"] + " and does not accept invoices"
+	}
+	if ufaEnded(ufaDetails, now) {
+		return "\nUFA ended on " + ufaDetails["endDate"] + " and does not accept invoices"
+	}
+	period := invoice["invoiceDate"]
+	if period == "" {
+		period = invoice["billingPeriod"]
+	}
+	if period == "" {
+		return ""
+	}
+	periodStart, periodEnd, ok := periodRange(period)
+	if start := ufaDetails["startDate"]; start != "" {
+		termStart, err := time.Parse(termDateLayout, start)
+		if (ok && err == nil && periodEnd.Before(termStart)) || (!ok && period < truncate(start, len(period))) {
+			return "\nInvoice period " + period + " is before the UFA starts"
+		}
+	}
+	if end := ufaDetails["endDate"]; end != "" {
+		termEnd, err := time.Parse(termDateLayout, end)
+		if (ok && err == nil && periodStart.After(termEnd)) || (!ok && period > truncate(end, len(period))) {
+			return "\nInvoice period " + period + " is after the UFA ends"
+		}
+	}
+	return ""
+}
+
+func truncate(value string, length int) string {
+	if len(value) > length {
+		return value[:length]
+	}
+	return value
+}
+
+//SweepExpiredUFAs marks the active UFAs whose end date is before the given
+//date as expired. args are who and the date as YYYY-MM-DD. Only an admin
+//can run it. Stores knowing the transaction time sweep as of that day
+//and need no date. Returns the numbers of the UFAs expired
+func SweepExpiredUFAs(stub Store, args []string) ([]byte, error) {
+	logger.Info("sweepExpiredUFAs called")
+	who := caller(stub, argAt(args, 0))
+	if !isAdmin(stub, who) {
+		return nil, errors.New("User is not authorized to expire UFAs")
+	}
+	asOf, err := time.Parse(termDateLayout, argAt(args, 1))
+	if now, ok := txTime(stub); ok {
+		asOf, err = time.Parse(termDateLayout, now.Format(termDateLayout))
+	}
+	if err != nil {
+		return nil, errors.New("sweepExpiredUFAs expects a date as YYYY-MM-DD")
+	}
+	recordsList, err := getAllRecordsList(stub)
+	if err != nil {
+		return nil, err
+	}
+	expired := make([]string, 0)
+	for _, ufanumber := range recordsList {
+		ufaDetails, _ := readRecord(stub, ufanumber, UFA_RECORD)
+		if ufaDetails == nil || ufaDetails["ufaStatus"] != UFA_ACTIVE || ufaDetails["endDate"] == "" {
+			continue
+		}
+		end, err := time.Parse(termDateLayout, ufaDetails["endDate"])
+		if err != nil || !end.Before(asOf) {
+			continue
+		}
+		ufaDetails["ufaStatus"] = UFA_EXPIRED
+		writeRecord(stub, ufanumber, UFA_RECORD, ufaDetails)
+		change, _ := canonicalJSON(map[string]string{"ufaStatus": UFA_EXPIRED})
+		appendUFATransactionHistory(stub, ufanumber, string(change))
+		expired = append(expired, ufanumber)
+	}
+	logger.Info("sweepExpiredUFAs expired " + strconv.Itoa(len(expired)) + " UFAs")
+	outputBytes, _ := canonicalJSON(expired)
+	return outputBytes, nil
+}
+
+//Net charge moved to the successor under the configured policy
+func carryOverAmount(config Config, unused float64, newNetCharge float64) float64 {
+	if unused <= 0 {
+		return 0
+	}
+	switch config.RenewalPolicy {
+	case RENEWAL_CARRY_FULL:
+		return unused
+	case RENEWAL_CARRY_CAPPED:
+		limit := newNetCharge * config.RenewalCapPercent / 100.0
+		if unused > limit {
+			return limit
+		}
+		return unused
+	}
+	return 0
+}
+
+//RenewUFA creates the successor of a UFA. args are the UFA number, who,
+//the number of the successor and a JSON payload with the fields of the
+//successor that differ, usually the new term and net charge. The unused
+//net charge of the old UFA is added to the successor according to the
+//configured renewal policy. The old UFA is marked renewed and stops
+//accepting invoices
+func RenewUFA(stub Store, args []string) ([]byte, error) {
+	logger.Info("renewUFA called")
+	if len(args) < 4 {
+		return nil, errors.New("renewUFA expects the UFA number, who, the successor number and its fields as JSON")
+	}
+	ufanumber := args[0]
+	who := caller(stub, args[1])
+	newNumber := args[2]
+	payload := args[3]
+
+	oldDetails, err := readRecord(stub, ufanumber, UFA_RECORD)
+	if err != nil || oldDetails == nil {
+		return nil, errors.New("Invalid UFA provided " + ufanumber)
+	}
+	if oldDetails["ufaStatus"] == UFA_RENEWED {
+		return nil, errors.New("UFA " + ufanumber + " is already renewed as " + oldDetails["successor"])
+	}
+	if existing, _ := stub.GetState(newNumber); existing != nil || newNumber == "" {
+		return nil, errors.New("Invalid successor UFA number " + newNumber)
+	}
+	var changes map[string]string
+	if err := json.Unmarshal([]byte(payload), &changes); err != nil {
+		return nil, errors.New("renewUFA expects the successor fields as JSON")
+	}
+	if valMsg := validateClientFields(changes, ledgerUFAFields); valMsg != "" {
+		return nil, errors.New("Validation failure: " + valMsg)
+	}
+
+	//The successor starts as a copy of the agreement without its state
+	successor := make(map[string]string)
+	for key, value := range oldDetails {
+		successor[key] = value
+	}
+	for _, key := range append([]string{"startDate", "endDate"}, ledgerUFAFields...) {
+		delete(successor, key)
+	}
+	updateRecord(successor, changes)
+
+	config, _ := getConfig(stub)
+	unused := validateNumber(oldDetails["netCharge"]) - validateNumber(oldDetails["raisedInvTotal"])
+	carried := carryOverAmount(config, unused, validateNumber(successor["netCharge"]))
+	if carried > 0 {
+		successor["netCharge"] = strconv.FormatFloat(validateNumber(successor["netCharge"])+carried, 'f', -1, 64)
+	}
+	successor["ufanumber"] = newNumber
+	validationBytes, _ := canonicalJSON(successor)
+	if valMsg := ValidateNewUFA(stub, who, string(validationBytes)); valMsg != "" {
+		return nil, errors.New("Validation failure: " + valMsg)
+	}
+	successor["predecessor"] = ufanumber
+	successor["carriedOver"] = strconv.FormatFloat(carried, 'f', -1, 64)
+	successorBytes, _ := canonicalJSON(successor)
+	storeNewUFA(stub, newNumber, string(successorBytes))
+	updateMasterRecords(stub, newNumber)
+
+	oldDetails["ufaStatus"] = UFA_RENEWED
+	oldDetails["successor"] = newNumber
+	writeRecord(stub, ufanumber, UFA_RECORD, oldDetails)
+	change, _ := canonicalJSON(map[string]string{"ufaStatus": UFA_RENEWED, "successor": newNumber})
+	appendUFATransactionHistory(stub, ufanumber, string(change))
+	logger.Info("renewUFA renewed " + ufanumber + " as " + newNumber)
+	return successorBytes, nil
+}
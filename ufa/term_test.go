@@ -0,0 +1,86 @@
+package ufa
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSweepExpiredUFAs(t *testing.T) {
+	s := newLedger(t, "")
+	s.now = time.Date(2016, 1, 15, 0, 0, 0, 0, time.UTC)
+	createUFA(t, s, "U1", newUFA().with("endDate", "2016-03-31"))
+	createUFA(t, s, "U2", newUFA())
+	createUFA(t, s, "U3", newUFA().without("endDate"))
+
+	s.mustFail(t, "not authorized to expire UFAs", testSeller, "sweepExpiredUFAs", testSeller, "2016-06-01")
+
+	//The transaction time wins over the date passed
+	var expired []string
+	decode(t, s.mustCall(t, ADMIN_ROLE, "sweepExpiredUFAs", ADMIN_ROLE, "2017-06-01"), &expired)
+	assertList(t, "UFAs expired in January", expired)
+
+	s.now = time.Date(2016, 4, 1, 0, 0, 0, 0, time.UTC)
+	decode(t, s.mustCall(t, ADMIN_ROLE, "sweepExpiredUFAs", ADMIN_ROLE), &expired)
+	assertList(t, "UFAs expired in April", expired, "U1")
+	if stored := storedUFA(t, s, "U1"); stored["ufaStatus"] != UFA_EXPIRED {
+		t.Fatalf("swept UFA is %q", stored["ufaStatus"])
+	}
+	decode(t, s.mustCall(t, ADMIN_ROLE, "sweepExpiredUFAs", ADMIN_ROLE), &expired)
+	assertList(t, "UFAs expired again", expired)
+
+	s.mustFail(t, "UFA is EXPIRED and does not accept invoices", testSeller, "createNewInvoices", testSeller, toJSON(newInvoicePair("U1", "2016-03", "100")))
+}
+
+func TestRenewUFA(t *testing.T) {
+	s := newLedger(t, `{"renewalPolicy":"CAPPED","renewalCapPercent":10}`)
+	createUFA(t, s, "U1", newUFA())
+	raisePair(t, s, newInvoicePair("U1", "2016-01", "400"))
+
+	renewal := `{"startDate":"2017-01-01","endDate":"2017-12-31","netCharge":"2000"}`
+	s.mustFail(t, "User is not authorized to create a UFA", testOutsider, "renewUFA", "U1", testOutsider, "U2", renewal)
+	s.mustFail(t, "Invalid successor UFA number U1", testSeller, "renewUFA", "U1", testSeller, "U1", renewal)
+	s.mustFail(t, "Field carriedOver is kept by the ledger", testSeller, "renewUFA", "U1", testSeller, "U2", `{"carriedOver":"500"}`)
+	s.mustFail(t, "Invalid UFA provided U9", testSeller, "renewUFA", "U9", testSeller, "U2", renewal)
+	s.mustFail(t, "renewUFA expects", testSeller, "renewUFA", "U1", testSeller)
+
+	var successor map[string]string
+	decode(t, s.mustCall(t, testSeller, "renewUFA", "U1", testSeller, "U2", renewal), &successor)
+	//600 left on U1, capped at 10% of the new net charge
+	if successor["netCharge"] != "2200" || successor["carriedOver"] != "200" || successor["predecessor"] != "U1" {
+		t.Fatalf("successor %v", successor)
+	}
+	stored := storedUFA(t, s, "U2")
+	if stored["raisedInvTotal"] != "0" || stored["ufaStatus"] != UFA_ACTIVE || stored["startDate"] != "2017-01-01" {
+		t.Fatalf("successor stored as %v", stored)
+	}
+	if old := storedUFA(t, s, "U1"); old["ufaStatus"] != UFA_RENEWED || old["successor"] != "U2" {
+		t.Fatalf("renewed UFA stored as %v", old)
+	}
+	assertList(t, "UFA master list", storedList(t, s, ALL_ELEMENENTS), "U1", "U2")
+	s.mustFail(t, "is already renewed as U2", testSeller, "renewUFA", "U1", testSeller, "U3", renewal)
+	s.mustFail(t, "UFA is RENEWED", testSeller, "createNewInvoices", testSeller, toJSON(newInvoicePair("U1", "2016-02", "100")))
+}
+
+func TestPeriodRange(t *testing.T) {
+	tests := []struct {
+		label string
+		start string
+		end   string
+	}{
+		{"2016-03-15", "2016-03-15", "2016-03-15"},
+		{"2016-02", "2016-02-01", "2016-02-29"},
+		{"2016-Q4", "2016-10-01", "2016-12-31"},
+		{"2016", "2016-01-01", "2016-12-31"},
+	}
+	for _, test := range tests {
+		start, end, ok := periodRange(test.label)
+		if !ok || start.Format(termDateLayout) != test.start || end.Format(termDateLayout) != test.end {
+			t.Errorf("periodRange(%q) = %v %v %v, want %s %s", test.label, start, end, ok, test.start, test.end)
+		}
+	}
+	for _, label := range []string{"", "2016-Q5", "March", "2016-13"} {
+		if _, _, ok := periodRange(label); ok {
+			t.Errorf("periodRange(%q) accepted", label)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package ufa
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+//ALL_ELEMENENTS Key to refer the master list of UFA
+const ALL_ELEMENENTS = "ALL_RECS"
+
+//ALL_INVOICES key to refer the invoice master data
+const ALL_INVOICES = "ALL_INVOICES"
+
+//UFA_TRXN_PREFIX Key prefix for UFA transaction history
+const UFA_TRXN_PREFIX = "UFA_TRXN_HISTORY_"
+
+//UFA_INVOICE_PREFIX Key prefix for identifying Invoices assciated with a ufa
+const UFA_INVOICE_PREFIX = "UFA_INVOICE_PREFIX_"
+
+//CreateUFA Creating a new Upfront agreement
+func CreateUFA(stub Store, args []string) ([]byte, error) {
+	logger.Info("createUFA called")
+	if len(args) < 3 {
+		return nil, errors.New("createUFA expects the UFA number, who and the UFA as JSON")
+	}
+
+	ufanumber := args[0]
+	who := caller(stub, args[1])
+	payload, err := withTransientFields(stub, args[2])
+	if err != nil {
+		return nil, err
+	}
+	if existing, _ := stub.GetState(ufanumber); existing != nil {
+		return nil, errors.New("UFA " + ufanumber + " already exists")
+	}
+	//If there is no error messages then create the UFA
+	valMsg := ValidateNewUFA(stub, who, payload)
+	if valMsg == "" {
+		storeNewUFA(stub, ufanumber, payload)
+		updateMasterRecords(stub, ufanumber)
+		logger.Info("Created the UFA after successful validation : " + ufanumber)
+	} else {
+		return nil, errors.New("Validation failure: " + valMsg)
+	}
+	return nil, nil
+}
+
+//Store a validated UFA and start its transaction history. The caller adds
+//the number to the master list
+func storeNewUFA(stub Store, ufanumber string, payload string) {
+	var ufaDetails map[string]string
+	json.Unmarshal([]byte(payload), &ufaDetails)
+	if ufaDetails["currency"] == "" {
+		config, _ := getConfig(stub)
+		ufaDetails["currency"] = config.Currency
+	}
+	writeRecord(stub, ufanumber, UFA_RECORD, newRecord(UFA_RECORD, ufaDetails))
+	appendUFATransactionHistory(stub, ufanumber, payload)
+}
+
+//ValidateNewUFA Validate a new UFA. who is the user creating it, who must
+//be an admin or the seller or buyer named in it with one of the allowed
+//roles
+func ValidateNewUFA(stub Store, who string, payload string) string {
+
+	var validationMessage bytes.Buffer
+	var ufaDetails map[string]string
+
+	logger.Info("validateNewUFA")
+	config, err := getConfig(stub)
+	if err != nil {
+		return "\nUnable to read the configuration"
+	}
+	json.Unmarshal([]byte(payload), &ufaDetails)
+	if isAdmin(stub, who) || contains(config.AllowedRoles, ufaRole(who, ufaDetails)) {
+		validationMessage.WriteString(validateClientFields(ufaDetails, ledgerUFAFields))
+		validationMessage.WriteString(validateUFAFields(stub, config, ufaDetails))
+	} else {
+		validationMessage.WriteString("\nUser is not authorized to create a UFA")
+	}
+	logger.Info("Validation messagge " + validationMessage.String())
+	return validationMessage.String()
+}
+
+//Check the fields of a UFA, as created or after a change
+func validateUFAFields(stub Store, config Config, ufaDetails map[string]string) string {
+	var validationMessage bytes.Buffer
+	for _, field := range config.RequiredUFAFields {
+		if ufaDetails[field] == "" {
+			validationMessage.WriteString("\nMissing required field " + field)
+		}
+	}
+	//Now check individual fields
+	netChargeStr := ufaDetails["netCharge"]
+	tolerenceStr := ufaDetails["chargTolrence"]
+	netCharge := validateNumber(netChargeStr)
+	if netCharge <= 0.0 {
+		validationMessage.WriteString("\nInvalid net charge")
+	}
+	tolerence := validateNumber(tolerenceStr)
+	if !toleranceInRange(config, tolerence) {
+		validationMessage.WriteString("\nTolerence is out of range. Should be between " +
+			strconv.FormatFloat(config.MinTolerance, 'f', -1, 64) + " and " + strconv.FormatFloat(config.MaxTolerance, 'f', -1, 64))
+	} else if netCharge > 0.0 && math.IsInf(netCharge+netCharge*tolerence/100.0, 0) {
+		validationMessage.WriteString("\nNet charge is too large")
+	}
+	if frequency := ufaDetails["billingFrequency"]; frequency != "" && !contains(config.BillingFrequencies, frequency) {
+		validationMessage.WriteString("\nBilling frequency " + frequency + " is not supported")
+	}
+	if currency := ufaDetails["currency"]; currency != "" && !contains(config.Currencies, currency) {
+		validationMessage.WriteString("\nCurrency " + currency + " is not supported")
+	}
+	validationMessage.WriteString(validateTerm(ufaDetails))
+	validationMessage.WriteString(validateRecurring(ufaDetails))
+	validationMessage.WriteString(validateRateCard(ufaDetails))
+	validationMessage.WriteString(validateUsageSources(ufaDetails))
+	validationMessage.WriteString(validatePartyRef(stub, config, "sellerName", ufaDetails["sellerName"], SELLER_ROLE))
+	validationMessage.WriteString(validatePartyRef(stub, config, "buyerName", ufaDetails["buyerName"], BUYER_ROLE))
+	return validationMessage.String()
+}
+
+//Check a client payload leaves the fields kept by the ledger alone
+func validateClientFields(fields map[string]string, ledgerFields []string) string {
+	var validationMessage bytes.Buffer
+	for _, field := range ledgerFields {
+		if _, ok := fields[field]; ok {
+			validationMessage.WriteString("\nField " + field + " is kept by the ledger and cannot be set")
+		}
+	}
+	return validationMessage.String()
+}
+
+//Tells if the tolerance is a finite number within the configured range.
+//Comparisons with NaN are false, so the range is checked inclusively
+func toleranceInRange(config Config, tolerence float64) bool {
+	if math.IsNaN(tolerence) || math.IsInf(tolerence, 0) {
+		return false
+	}
+	return tolerence >= config.MinTolerance && tolerence <= config.MaxTolerance
+}
+
+//Validate a input string as number or not. NaN and the infinities are not
+//numbers, -1 is returned for them as for any other invalid input
+func validateNumber(str string) float64 {
+	if netCharge, err := strconv.ParseFloat(str, 64); err == nil && !math.IsNaN(netCharge) && !math.IsInf(netCharge, 0) {
+		return netCharge
+	}
+	return float64(-1.0)
+}
+
+//Update the existing record with the mofied key value pair
+func updateRecord(existingRecord map[string]string, fieldsToUpdate map[string]string) (string, error) {
+	for key, value := range fieldsToUpdate {
+
+		existingRecord[key] = value
+	}
+	outputMapBytes, _ := canonicalJSON(existingRecord)
+	logger.Info("updateRecord: Final json after update " + string(outputMapBytes))
+	return string(outputMapBytes), nil
+}
+
+//UpdateUFA Update and existing UFA record. args are the UFA number, who (a
+//party of the UFA or an admin) and the fields to change as JSON. The fields
+//kept by the ledger cannot be changed and the result is validated like a
+//new UFA
+func UpdateUFA(stub Store, args []string) ([]byte, error) {
+	var updatedFields map[string]string
+
+	logger.Info("updateUFA called ")
+	if len(args) < 3 {
+		return nil, errors.New("updateUFA expects the UFA number, who and the fields as JSON")
+	}
+	ufanumber := args[0]
+	who := caller(stub, args[1])
+	payload, err := withTransientFields(stub, args[2])
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("updateUFA payload passed " + publicPayload(stub, UFA_RECORD, payload))
+
+	existingRecMap, err := readRecord(stub, ufanumber, UFA_RECORD)
+	if err != nil || existingRecMap == nil {
+		return nil, errors.New("Invalid UFA provided " + ufanumber)
+	}
+	if !isAdmin(stub, who) && ufaRole(who, existingRecMap) == "" {
+		return nil, errors.New("User is not authorized to update UFA " + ufanumber)
+	}
+	if err := json.Unmarshal([]byte(payload), &updatedFields); err != nil {
+		return nil, errors.New("updateUFA expects the fields as JSON")
+	}
+	config, _ := getConfig(stub)
+	valMsg := validateClientFields(updatedFields, unamendableFields)
+	updateRecord(existingRecMap, updatedFields)
+	valMsg += validateUFAFields(stub, config, existingRecMap)
+	if valMsg != "" {
+		return nil, errors.New("Validation failure: " + valMsg)
+	}
+	return nil, storeUFAChange(stub, ufanumber, existingRecMap, payload)
+}
+
+//Store the changed UFA and record the change in its history. The caller
+//checks the change is allowed
+func storeUFAChange(stub Store, ufanumber string, ufaDetails map[string]string, change string) error {
+	if err := writeRecord(stub, ufanumber, UFA_RECORD, ufaDetails); err != nil {
+		return err
+	}
+	return appendUFATransactionHistory(stub, ufanumber, change)
+}
+
+//Set the raised invoice total of the UFA
+func updateRaisedTotal(stub Store, ufanumber string, raisedInvTotal float64) error {
+	ufaDetails, err := readRecord(stub, ufanumber, UFA_RECORD)
+	if err != nil || ufaDetails == nil {
+		return errors.New("Invalid UFA provided " + ufanumber)
+	}
+	change := map[string]string{"raisedInvTotal": strconv.FormatFloat(raisedInvTotal, 'f', -1, 64)}
+	changeBytes, _ := canonicalJSON(change)
+	updateRecord(ufaDetails, change)
+	return storeUFAChange(stub, ufanumber, ufaDetails, string(changeBytes))
+}
+
+//GetAllUFA Returns all the UFAs created so far which who can read
+func GetAllUFA(stub Store, who string) ([]byte, error) {
+	logger.Info("getAllUFA called")
+
+	recordsList, err := getAllRecordsList(stub)
+	if err != nil {
+		return nil, errors.New("Unable to get all the records ")
+	}
+	who = caller(stub, who)
+	config, _ := getConfig(stub)
+	var outputRecords []map[string]string
+	outputRecords = make([]map[string]string, 0)
+	for _, ufanumber := range recordsList {
+		logger.Info("getAllUFA: Processing record " + ufanumber)
+		record, _ := readRecord(stub, ufanumber, UFA_RECORD)
+		if record != nil && canReadUFA(config, who, record) {
+			outputRecords = append(outputRecords, record)
+		}
+	}
+	outputBytes, _ := canonicalJSON(outputRecords)
+	logger.Info("getAllUFA returning " + strconv.Itoa(len(outputRecords)) + " records")
+	return outputBytes, nil
+}
+
+//GetUFADetails Get a single ufa
+func GetUFADetails(stub Store, args []string) ([]byte, error) {
+	if len(args) < 1 {
+		return nil, errors.New("getUFADetails expects the UFA number")
+	}
+	logger.Info("getUFADetails called with UFA number: " + args[0])
+
+	ufanumber := args[0] //UFA ufanum
+	who := caller(stub, argAt(args, 1))
+	outputRecord, err := readUFAFor(stub, who, ufanumber)
+	if err != nil {
+		return nil, err
+	}
+	outputBytes, _ := canonicalJSON(outputRecord)
+	logger.Info("Returning records from getUFADetails " + ufanumber)
+	return outputBytes, nil
+}
+
+//GetUFAHistory Returns the payloads applied to a UFA, oldest first
+func GetUFAHistory(stub Store, args []string) ([]byte, error) {
+	if len(args) < 1 {
+		return nil, errors.New("getUFAHistory expects the UFA number")
+	}
+	logger.Info("getUFAHistory called with UFA number: " + args[0])
+	ufanumber := args[0]
+	if _, err := readUFAFor(stub, caller(stub, argAt(args, 1)), ufanumber); err != nil {
+		return nil, err
+	}
+	recBytes, _ := stub.GetState(UFA_TRXN_PREFIX + ufanumber)
+	if recBytes == nil {
+		return []byte("[]"), nil
+	}
+	return recBytes, nil
+}
+
+//Probe returns a liveness message
+func Probe() []byte {
+	ts := time.Now().Format(time.UnixDate)
+	output, _ := canonicalJSON(map[string]string{"status": "Success", "ts": ts})
+	return output
+}
+
+//Result of the validation queries
+func validationOutput(msg string) []byte {
+	result := map[string]string{"validation": "Success", "msg": msg}
+	if msg != "" {
+		result["validation"] = "Failure"
+	}
+	output, _ := canonicalJSON(result)
+	return output
+}
+
+//ValidateNewUFAData Validate the new UFA
+func ValidateNewUFAData(stub Store, args []string) []byte {
+	return validationOutput(ValidateNewUFA(stub, caller(stub, argAt(args, 0)), argAt(args, 1)))
+}
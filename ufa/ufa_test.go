@@ -0,0 +1,220 @@
+package ufa
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInitLedger(t *testing.T) {
+	s := newLedger(t, "")
+	assertList(t, "UFA master list", storedList(t, s, ALL_ELEMENENTS))
+	assertList(t, "invoice master list", storedList(t, s, ALL_INVOICES))
+	config, err := getConfig(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.MaxTolerance != 10 || !contains(config.Admins, ADMIN_ROLE) {
+		t.Fatalf("default configuration expected, got %+v", config)
+	}
+
+	//An upgrade keeps the records and the configuration
+	createUFA(t, s, "U1", newUFA())
+	if _, err := InitLedger(s, nil); err != nil {
+		t.Fatal(err)
+	}
+	s.commit()
+	assertList(t, "UFA master list", storedList(t, s, ALL_ELEMENENTS), "U1")
+
+	//A configuration passed to Init replaces the stored one
+	if _, err := InitLedger(s, []string{`{"maxTolerance":20}`}); err != nil {
+		t.Fatal(err)
+	}
+	s.commit()
+	if config, _ := getConfig(s); config.MaxTolerance != 20 || config.Currency != "USD" {
+		t.Fatalf("configuration not applied over the defaults: %+v", config)
+	}
+}
+
+func TestInitLedgerRejectsInvalidConfig(t *testing.T) {
+	for _, config := range []string{`{"admins":[]}`, `{"minTolerance":5,"maxTolerance":1}`, `{"currency":"EUR"}`, `not json`} {
+		s := newMockStub()
+		if _, err := InitLedger(s, []string{config}); err == nil {
+			t.Errorf("Init accepted %s", config)
+		}
+	}
+}
+
+func TestCreateUFA(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", newUFA())
+
+	stored := storedUFA(t, s, "U1")
+	if stored == nil {
+		t.Fatal("UFA not stored")
+	}
+	for field, want := range map[string]string{
+		"netCharge":      "1000",
+		"currency":       "USD",
+		"ufaStatus":      UFA_ACTIVE,
+		"raisedInvTotal": "0",
+	} {
+		if stored[field] != want {
+			t.Errorf("%s = %q, want %q", field, stored[field], want)
+		}
+	}
+	assertList(t, "UFA master list", storedList(t, s, ALL_ELEMENENTS), "U1")
+	if history := storedList(t, s, UFA_TRXN_PREFIX+"U1"); len(history) != 1 {
+		t.Fatalf("history = %v, want the creation", history)
+	}
+
+	createUFA(t, s, "U2", newUFA())
+	assertList(t, "UFA master list", storedList(t, s, ALL_ELEMENENTS), "U1", "U2")
+	s.mustFail(t, "UFA U1 already exists", testSeller, "createUFA", "U1", testSeller, newUFA().json())
+}
+
+func TestValidateNewUFA(t *testing.T) {
+	tests := []struct {
+		name    string
+		who     string
+		ufa     ufaFixture
+		message string
+	}{
+		{"seller", testSeller, newUFA(), ""},
+		{"buyer", testBuyer, newUFA(), ""},
+		{"admin", ADMIN_ROLE, newUFA(), ""},
+		{"outsider", testOutsider, newUFA(), "User is not authorized to create a UFA"},
+		{"missing net charge", testSeller, newUFA().without("netCharge"), "Missing required field netCharge"},
+		{"missing tolerance", testSeller, newUFA().without("chargTolrence"), "Missing required field chargTolrence"},
+		{"text net charge", testSeller, newUFA().with("netCharge", "abc"), "Invalid net charge"},
+		{"zero net charge", testSeller, newUFA().with("netCharge", "0"), "Invalid net charge"},
+		{"negative net charge", testSeller, newUFA().with("netCharge", "-5"), "Invalid net charge"},
+		{"NaN net charge", testSeller, newUFA().with("netCharge", "NaN"), "Invalid net charge"},
+		{"infinite net charge", testSeller, newUFA().with("netCharge", "1e309"), "Invalid net charge"},
+		{"overflowing maximum charge", testSeller, newUFA().with("netCharge", "1.7e308"), "Net charge is too large"},
+		{"tolerance above range", testSeller, newUFA().with("chargTolrence", "10.5"), "Tolerence is out of range"},
+		{"negative tolerance", testSeller, newUFA().with("chargTolrence", "-1"), "Tolerence is out of range"},
+		{"NaN tolerance", testSeller, newUFA().with("chargTolrence", "NaN"), "Tolerence is out of range"},
+		{"unknown frequency", testSeller, newUFA().with("billingFrequency", "WEEKLY"), "Billing frequency WEEKLY is not supported"},
+		{"unknown currency", testSeller, newUFA().with("currency", "EUR"), "Currency EUR is not supported"},
+		{"bad start date", testSeller, newUFA().with("startDate", "01/01/2016"), "Start date should be a date"},
+		{"end before start", testSeller, newUFA().with("endDate", "2015-12-31"), "End date is before the start date"},
+		{"unknown recurring billing", testSeller, newUFA().with("recurringBilling", "WEEKLY"), "Recurring billing should be FIXED or PRORATA"},
+		{"fixed without amount", testSeller, newUFA().with("recurringBilling", RECURRING_FIXED), "needs a recurringAmount"},
+		{"bad rate card", testSeller, newUFA().with("rateCard", "[]"), "Rate card should be a JSON object"},
+		{"ledger field", testSeller, newUFA().with("raisedInvTotal", "0"), "Field raisedInvTotal is kept by the ledger"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newLedger(t, "")
+			s.creator = test.who
+			message := ValidateNewUFA(s, test.who, test.ufa.json())
+			if test.message == "" && message != "" {
+				t.Fatalf("unexpected validation failure %q", message)
+			}
+			if !strings.Contains(message, test.message) {
+				t.Fatalf("validation message %q, want %q", message, test.message)
+			}
+		})
+	}
+}
+
+func TestValidateNewUFAQuery(t *testing.T) {
+	s := newLedger(t, "")
+	var result map[string]string
+	decode(t, s.mustCall(t, testSeller, "validateNewUFA", testSeller, newUFA().json()), &result)
+	if result["validation"] != "Success" || result["msg"] != "" {
+		t.Fatalf("valid UFA reported as %v", result)
+	}
+	decode(t, s.mustCall(t, testSeller, "validateNewUFA", testSeller, newUFA().with("netCharge", "0").json()), &result)
+	if result["validation"] != "Failure" || !strings.Contains(result["msg"], "Invalid net charge") {
+		t.Fatalf("invalid UFA reported as %v", result)
+	}
+}
+
+//The who argument is not trusted when the store knows the submitter
+func TestCallerIsTheSubmitter(t *testing.T) {
+	s := newLedger(t, "")
+	s.mustFail(t, "not authorized", testOutsider, "createUFA", "U1", testSeller, newUFA().json())
+	s.mustFail(t, "not authorized", "", "createUFA", "U1", testSeller, newUFA().json())
+	s.mustFail(t, "not authorized", testOutsider, "setConfig", ADMIN_ROLE, `{"maxTolerance":50}`)
+}
+
+func TestUpdateUFA(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", newUFA())
+
+	s.mustCall(t, testBuyer, "updateUFA", "U1", testBuyer, `{"netCharge":"2000","note":"extended"}`)
+	stored := storedUFA(t, s, "U1")
+	if stored["netCharge"] != "2000" || stored["note"] != "extended" || stored["sellerName"] != testSeller {
+		t.Fatalf("update not applied: %v", stored)
+	}
+	if history := storedList(t, s, UFA_TRXN_PREFIX+"U1"); len(history) != 2 {
+		t.Fatalf("history = %v, want the creation and the update", history)
+	}
+
+	s.mustFail(t, "Invalid UFA provided U9", testSeller, "updateUFA", "U9", testSeller, `{"note":"x"}`)
+	s.mustFail(t, "not authorized", testOutsider, "updateUFA", "U1", testOutsider, `{"note":"x"}`)
+	s.mustFail(t, "Field raisedInvTotal is kept by the ledger", testSeller, "updateUFA", "U1", testSeller, `{"raisedInvTotal":"0"}`)
+	s.mustFail(t, "Field startDate is kept by the ledger", testSeller, "updateUFA", "U1", testSeller, `{"startDate":"2016-02-01"}`)
+	s.mustFail(t, "Field endDate is kept by the ledger", testSeller, "updateUFA", "U1", testSeller, `{"endDate":"2017-12-31"}`)
+	s.mustFail(t, "Tolerence is out of range", testSeller, "updateUFA", "U1", testSeller, `{"chargTolrence":"50"}`)
+	s.mustFail(t, "expects the fields as JSON", testSeller, "updateUFA", "U1", testSeller, `[]`)
+	s.mustFail(t, "updateUFA expects", testSeller, "updateUFA", "U1")
+	if stored := storedUFA(t, s, "U1"); stored["chargTolrence"] != "10" {
+		t.Fatalf("failed update changed the UFA: %v", stored)
+	}
+}
+
+func TestGetUFA(t *testing.T) {
+	s := newLedger(t, `{"auditors":["AUD"]}`)
+	createUFA(t, s, "U1", newUFA())
+	createUFA(t, s, "U2", newUFA().with("buyerName", "B2"))
+
+	var details map[string]string
+	decode(t, s.mustCall(t, testBuyer, "getUFADetails", "U1", testBuyer), &details)
+	if details["netCharge"] != "1000" {
+		t.Fatalf("getUFADetails returned %v", details)
+	}
+	decode(t, s.mustCall(t, "AUD", "getUFADetails", "U1", "AUD"), &details)
+	s.mustFail(t, "not authorized to read UFA U1", testOutsider, "getUFADetails", "U1", testOutsider)
+
+	var all []map[string]string
+	decode(t, s.mustCall(t, testSeller, "getAllUFA", testSeller), &all)
+	if len(all) != 2 {
+		t.Fatalf("seller sees %d UFAs, want 2", len(all))
+	}
+	decode(t, s.mustCall(t, testBuyer, "getAllUFA", testBuyer), &all)
+	if len(all) != 1 || all[0]["buyerName"] != testBuyer {
+		t.Fatalf("buyer sees %v, want U1 only", all)
+	}
+	decode(t, s.mustCall(t, testOutsider, "getAllUFA", testOutsider), &all)
+	if len(all) != 0 {
+		t.Fatalf("outsider sees %v", all)
+	}
+
+	var history []string
+	s.mustCall(t, testSeller, "updateUFA", "U1", testSeller, `{"note":"x"}`)
+	decode(t, s.mustCall(t, testSeller, "getUFAHistory", "U1", testSeller), &history)
+	if len(history) != 2 || !strings.Contains(history[1], `"note":"x"`) {
+		t.Fatalf("history = %v", history)
+	}
+	s.mustFail(t, "not authorized", testOutsider, "getUFAHistory", "U1", testOutsider)
+}
+
+func TestDispatch(t *testing.T) {
+	s := newLedger(t, "")
+	var probe map[string]string
+	decode(t, s.mustCall(t, testSeller, "probe"), &probe)
+	if probe["status"] != "Success" {
+		t.Fatalf("probe returned %v", probe)
+	}
+	var metadata map[string]interface{}
+	decode(t, s.mustCall(t, testSeller, MetadataFunction), &metadata)
+	if metadata["contracts"] == nil {
+		t.Fatalf("metadata returned %v", metadata)
+	}
+	s.mustFail(t, "unknown invoke function name nope", testSeller, "nope")
+	if !IsQuery("getUFADetails") || IsQuery("createUFA") {
+		t.Fatal("queries and invokes are mixed up")
+	}
+}
@@ -0,0 +1,398 @@
+package ufa
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//UFA_USAGE_PREFIX Key prefix for the usage recorded on a UFA, per billing
+//period, see usageKey
+const UFA_USAGE_PREFIX = "UFA_USAGE_RECORDS_"
+
+//UFA_USAGE_PERIODS_PREFIX Key prefix for the billing periods a UFA has
+//usage recorded for
+const UFA_USAGE_PERIODS_PREFIX = "UFA_USAGE_PERIODS_"
+
+//Pricing of a meter on a rate card
+const (
+	//Every unit at the unit price
+	RATE_PER_UNIT = "PER_UNIT"
+	//Each tier prices the units falling in it
+	RATE_TIERED = "TIERED"
+	//The tier reached prices every unit
+	RATE_VOLUME = "VOLUME"
+)
+
+//Codes of the usage violations found on invoices
+const (
+	VIOLATION_NO_USAGE       = "NO_USAGE"
+	VIOLATION_USAGE_MISMATCH = "USAGE_AMOUNT_MISMATCH"
+)
+
+//RateTier prices the units up to UpTo, 0 for no limit
+type RateTier struct {
+	UpTo      float64 `json:"upTo"`
+	UnitPrice float64 `json:"unitPrice"`
+}
+
+//Rate prices the consumption of one meter
+type Rate struct {
+	Type      string     `json:"type"`
+	UnitPrice float64    `json:"unitPrice,omitempty"`
+	Tiers     []RateTier `json:"tiers,omitempty"`
+}
+
+//RateCard holds the rates of the meters of a UFA, kept as JSON in its
+//rateCard field
+type RateCard map[string]Rate
+
+//UsageRecord is consumption metered against a UFA. The source signs the
+//record, see UsageSigningBytes
+type UsageRecord struct {
+	ID          string  `json:"id"`
+	Meter       string  `json:"meter"`
+	Quantity    float64 `json:"quantity"`
+	Period      string  `json:"period"`
+	Source      string  `json:"source"`
+	Signature   string  `json:"signature,omitempty"`
+	SubmittedBy string  `json:"submittedBy"`
+	Timestamp   string  `json:"timestamp,omitempty"`
+}
+
+//MeterUsage is the consumption of one meter in a period and its price
+type MeterUsage struct {
+	Meter    string  `json:"meter"`
+	Quantity float64 `json:"quantity"`
+	Amount   float64 `json:"amount"`
+}
+
+//RatedUsage is the usage of a UFA in a billing period priced on its rate card
+type RatedUsage struct {
+	UFANumber string        `json:"ufanumber"`
+	Period    string        `json:"period"`
+	Meters    []MeterUsage  `json:"meters"`
+	Total     float64       `json:"total"`
+	Records   []UsageRecord `json:"records"`
+}
+
+//UsageSigningBytes Returns the bytes the source signs: the record without
+//the signature and the fields set on submission
+func UsageSigningBytes(usage UsageRecord) []byte {
+	usage.Signature = ""
+	usage.SubmittedBy = ""
+	usage.Timestamp = ""
+	usageBytes, _ := canonicalJSON(usage)
+	return usageBytes
+}
+
+//Returns the key of the usage of the UFA in the billing period. The period
+//follows the UFA number after a NUL, which periods cannot hold, so no two
+//UFAs and periods share a key
+func usageKey(ufanumber string, period string) string {
+	return UFA_USAGE_PREFIX + ufanumber + "\x00" + period
+}
+
+//Returns the sources besides the parties allowed to meter usage on the
+//UFA, kept as a JSON array in its usageSources field
+func getUsageSources(ufaDetails map[string]string) ([]string, error) {
+	sources := make([]string, 0)
+	if ufaDetails["usageSources"] == "" {
+		return sources, nil
+	}
+	if err := json.Unmarshal([]byte(ufaDetails["usageSources"]), &sources); err != nil {
+		return nil, errors.New("Usage sources should be a JSON array of names")
+	}
+	return sources, nil
+}
+
+//Check the usage sources of a new UFA
+func validateUsageSources(ufaDetails map[string]string) string {
+	sources, err := getUsageSources(ufaDetails)
+	if err != nil {
+		return "\n" + err.Error()
+	}
+	for _, source := range sources {
+		if source == "" {
+			return "\nUsage sources should not be empty"
+		}
+	}
+	return ""
+}
+
+//Tells if the source may meter usage on the UFA: a party of the UFA or
+//one of its usage sources
+func isUsageSource(ufaDetails map[string]string, source string) bool {
+	if source == "" {
+		return false
+	}
+	if ufaRole(source, ufaDetails) != "" {
+		return true
+	}
+	sources, _ := getUsageSources(ufaDetails)
+	return contains(sources, source)
+}
+
+//Returns the rate card of the UFA, nil when it has none
+func getRateCard(ufaDetails map[string]string) (RateCard, error) {
+	if ufaDetails["rateCard"] == "" {
+		return nil, nil
+	}
+	var rateCard RateCard
+	if err := json.Unmarshal([]byte(ufaDetails["rateCard"]), &rateCard); err != nil {
+		return nil, errors.New("Rate card should be a JSON object of meter rates")
+	}
+	return rateCard, nil
+}
+
+//Check the rate card of a new UFA
+func validateRateCard(ufaDetails map[string]string) string {
+	rateCard, err := getRateCard(ufaDetails)
+	if err != nil {
+		return "\n" + err.Error()
+	}
+	for meter, rate := range rateCard {
+		switch rate.Type {
+		case RATE_PER_UNIT:
+			if rate.UnitPrice < 0 {
+				return "\nUnit price of " + meter + " should not be negative"
+			}
+		case RATE_TIERED, RATE_VOLUME:
+			if len(rate.Tiers) == 0 {
+				return "\nRate of " + meter + " needs tiers"
+			}
+			for i, tier := range rate.Tiers {
+				last := i == len(rate.Tiers)-1
+				if tier.UnitPrice < 0 {
+					return "\nUnit price of " + meter + " should not be negative"
+				}
+				if tier.UpTo < 0 || last != (tier.UpTo == 0) || (i > 0 && !last && tier.UpTo <= rate.Tiers[i-1].UpTo) {
+					return "\nTiers of " + meter + " should rise, the last one without limit"
+				}
+			}
+		default:
+			return "\nRate of " + meter + " should be PER_UNIT, TIERED or VOLUME"
+		}
+	}
+	return ""
+}
+
+//Price of the quantity at the rate
+func (rate Rate) price(quantity float64) float64 {
+	switch rate.Type {
+	case RATE_TIERED:
+		amount, floor := 0.0, 0.0
+		for _, tier := range rate.Tiers {
+			if tier.UpTo == 0 || quantity <= tier.UpTo {
+				return amount + (quantity-floor)*tier.UnitPrice
+			}
+			amount += (tier.UpTo - floor) * tier.UnitPrice
+			floor = tier.UpTo
+		}
+		return amount
+	case RATE_VOLUME:
+		for _, tier := range rate.Tiers {
+			if tier.UpTo == 0 || quantity <= tier.UpTo {
+				return quantity * tier.UnitPrice
+			}
+		}
+		return 0
+	}
+	return quantity * rate.UnitPrice
+}
+
+//Returns the usage recorded on the UFA for the billing period
+func getUsage(stub Store, ufanumber string, period string) ([]UsageRecord, error) {
+	records := make([]UsageRecord, 0)
+	if strings.ContainsRune(period, 0) {
+		return nil, errors.New("Usage period " + strconv.Quote(period) + " is not a billing period")
+	}
+	recBytes, _ := stub.GetState(usageKey(ufanumber, period))
+	if recBytes == nil {
+		return records, nil
+	}
+	if err := json.Unmarshal(recBytes, &records); err != nil {
+		return nil, errors.New("Failed to unmarshal getUsage ")
+	}
+	return records, nil
+}
+
+//Returns the billing periods with usage recorded on the UFA
+func getUsagePeriods(stub Store, ufanumber string) ([]string, error) {
+	periods := make([]string, 0)
+	periodBytes, _ := stub.GetState(UFA_USAGE_PERIODS_PREFIX + ufanumber)
+	if periodBytes == nil {
+		return periods, nil
+	}
+	if err := json.Unmarshal(periodBytes, &periods); err != nil {
+		return nil, errors.New("Failed to unmarshal getUsagePeriods ")
+	}
+	return periods, nil
+}
+
+//Prices the usage of the period on the rate card, meters in name order
+func rateUsage(rateCard RateCard, ufanumber string, period string, records []UsageRecord) RatedUsage {
+	quantities := make(map[string]float64)
+	meters := make([]string, 0)
+	for _, record := range records {
+		if _, ok := quantities[record.Meter]; !ok {
+			meters = append(meters, record.Meter)
+		}
+		quantities[record.Meter] += record.Quantity
+	}
+	sort.Strings(meters)
+	rated := RatedUsage{UFANumber: ufanumber, Period: period, Meters: make([]MeterUsage, 0, len(meters)), Records: records}
+	for _, meter := range meters {
+		amount := math.Round(rateCard[meter].price(quantities[meter])*100) / 100
+		rated.Meters = append(rated.Meters, MeterUsage{Meter: meter, Quantity: roundAmount(quantities[meter]), Amount: amount})
+		rated.Total = roundAmount(rated.Total + amount)
+	}
+	return rated
+}
+
+//Checks the invoice amount against the rated usage of its billing period,
+//allowing the tolerance of the UFA and a rounding cent. Returns the
+//violation code and message, empty when the UFA has no rate card
+func validateUsageAmount(stub Store, ufanumber string, ufaDetails map[string]string, invoice map[string]string) (string, string) {
+	rateCard, err := getRateCard(ufaDetails)
+	if err != nil || rateCard == nil {
+		return "", ""
+	}
+	period := invoice["billingPeriod"]
+	records, err := getUsage(stub, ufanumber, period)
+	if err != nil {
+		return VIOLATION_NO_USAGE, err.Error()
+	}
+	if len(records) == 0 {
+		return VIOLATION_NO_USAGE, "No usage is recorded for " + period
+	}
+	rated := rateUsage(rateCard, ufanumber, period, records)
+	amount := validateNumber(invoice["invoiceAmt"])
+	allowed := rated.Total*validateNumber(ufaDetails["chargTolrence"])/100.0 + 0.005
+	if math.Abs(amount-rated.Total) > allowed {
+		return VIOLATION_USAGE_MISMATCH, "Invoice amount " + invoice["invoiceAmt"] + " does not match the rated usage of " +
+			strconv.FormatFloat(rated.Total, 'f', -1, 64) + " for " + period
+	}
+	return "", ""
+}
+
+//SubmitUsage records metered consumption against a UFA with a rate card.
+//args are who, the UFA number and the usage as JSON with id, meter,
+//quantity, period (the billing period), source and the signature of the
+//source. The source is a party of the UFA or one of the names in its
+//usageSources field. who should be an admin, a party of the UFA, or the
+//source submitting its own usage. Usage is not accepted for a period
+//already invoiced
+func SubmitUsage(stub Store, args []string) ([]byte, error) {
+	logger.Info("submitUsage called")
+	if len(args) < 3 {
+		return nil, errors.New("submitUsage expects who, the UFA number and the usage as JSON")
+	}
+	who := caller(stub, args[0])
+	ufanumber := args[1]
+	var usage UsageRecord
+	if err := json.Unmarshal([]byte(argAt(args, 2)), &usage); err != nil {
+		return nil, errors.New("submitUsage expects the usage as JSON")
+	}
+	ufaDetails, _ := readRecord(stub, ufanumber, UFA_RECORD)
+	if ufaDetails == nil {
+		return nil, errors.New("Invalid UFA provided " + ufanumber)
+	}
+	if !isAdmin(stub, who) && ufaRole(who, ufaDetails) == "" && (who != usage.Source || !isUsageSource(ufaDetails, who)) {
+		return nil, errors.New("User is not authorized to submit usage for " + ufanumber)
+	}
+	rateCard, err := getRateCard(ufaDetails)
+	if err != nil {
+		return nil, err
+	}
+	if rateCard == nil {
+		return nil, errors.New("UFA " + ufanumber + " has no rate card")
+	}
+	if usage.ID == "" || usage.Period == "" || usage.Source == "" {
+		return nil, errors.New("Usage id, period and source are required")
+	}
+	if strings.ContainsRune(usage.Period, 0) {
+		return nil, errors.New("Usage period " + strconv.Quote(usage.Period) + " is not a billing period")
+	}
+	if !isUsageSource(ufaDetails, usage.Source) {
+		return nil, errors.New("Source " + usage.Source + " is not a usage source of " + ufanumber)
+	}
+	if _, ok := rateCard[usage.Meter]; !ok {
+		return nil, errors.New("Meter " + usage.Meter + " is not on the rate card of " + ufanumber)
+	}
+	if usage.Quantity < 0 {
+		return nil, errors.New("Usage quantity should not be negative")
+	}
+	if checkInvoicesRaised(stub, ufanumber, usage.Period) {
+		return nil, errors.New("Period " + usage.Period + " of " + ufanumber + " is already invoiced")
+	}
+	config, _ := getConfig(stub)
+	if usage.Signature != "" {
+		if err := verifySignature(stub, usage.Source, UsageSigningBytes(usage), usage.Signature); err != nil {
+			return nil, err
+		}
+	} else if config.RequireUsageSignatures {
+		return nil, errors.New("Usage " + usage.ID + " is not signed")
+	}
+
+	records, err := getUsage(stub, ufanumber, usage.Period)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if record.ID == usage.ID {
+			return nil, errors.New("Usage " + usage.ID + " is already recorded")
+		}
+	}
+	if len(records) == 0 {
+		periods, err := getUsagePeriods(stub, ufanumber)
+		if err != nil {
+			return nil, err
+		}
+		periodBytes, _ := canonicalJSON(append(periods, usage.Period))
+		if err := stub.PutState(UFA_USAGE_PERIODS_PREFIX+ufanumber, periodBytes); err != nil {
+			return nil, err
+		}
+	}
+	usage.SubmittedBy = who
+	if now, ok := txTime(stub); ok {
+		usage.Timestamp = now.Format(time.RFC3339)
+	}
+	records = append(records, usage)
+	bytesToStore, _ := canonicalJSON(records)
+	if err := stub.PutState(usageKey(ufanumber, usage.Period), bytesToStore); err != nil {
+		return nil, err
+	}
+	logger.Info("submitUsage recorded " + usage.ID + " on " + ufanumber)
+	outputBytes, _ := canonicalJSON(usage)
+	return outputBytes, nil
+}
+
+//GetUsage Returns the usage of a UFA in a billing period priced on its
+//rate card. args are the UFA number, who and the period
+func GetUsage(stub Store, args []string) ([]byte, error) {
+	logger.Info("getUsage called")
+	ufanumber := argAt(args, 0)
+	period := argAt(args, 2)
+	ufaDetails, err := readUFAFor(stub, caller(stub, argAt(args, 1)), ufanumber)
+	if err != nil {
+		return nil, err
+	}
+	rateCard, err := getRateCard(ufaDetails)
+	if err != nil {
+		return nil, err
+	}
+	records, err := getUsage(stub, ufanumber, period)
+	if err != nil {
+		return nil, err
+	}
+	outputBytes, err := canonicalJSON(rateUsage(rateCard, ufanumber, period, records))
+	if err != nil {
+		return nil, err
+	}
+	return outputBytes, nil
+}
@@ -0,0 +1,147 @@
+package ufa
+
+import (
+	"testing"
+)
+
+//Returns a metered UFA billing cpu per unit and storage in tiers
+func meteredUFA() ufaFixture {
+	return newUFA().with("chargTolrence", "0").with("rateCard",
+		`{"cpu":{"type":"PER_UNIT","unitPrice":2},"storage":{"type":"TIERED","tiers":[{"upTo":100,"unitPrice":1},{"upTo":0,"unitPrice":0.5}]}}`)
+}
+
+//Returns usage of the meter metered by the seller
+func newUsage(id string, meter string, quantity float64, period string) UsageRecord {
+	return UsageRecord{ID: id, Meter: meter, Quantity: quantity, Period: period, Source: testSeller}
+}
+
+func TestSubmitUsage(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", meteredUFA())
+	createUFA(t, s, "U2", newUFA())
+
+	var recorded UsageRecord
+	decode(t, s.mustCall(t, testSeller, "submitUsage", testSeller, "U1", toJSON(newUsage("R1", "cpu", 10, "2016-01"))), &recorded)
+	if recorded.SubmittedBy != testSeller || recorded.Timestamp == "" {
+		t.Fatalf("submitUsage returned %+v", recorded)
+	}
+	s.mustCall(t, testBuyer, "submitUsage", testBuyer, "U1", toJSON(newUsage("R2", "storage", 150, "2016-01")))
+	s.mustCall(t, testSeller, "submitUsage", testSeller, "U1", toJSON(newUsage("R3", "cpu", 5, "2016-02")))
+	assertList(t, "usage periods", storedList(t, s, UFA_USAGE_PERIODS_PREFIX+"U1"), "2016-01", "2016-02")
+
+	s.mustFail(t, "Usage R1 is already recorded", testSeller, "submitUsage", testSeller, "U1", toJSON(newUsage("R1", "cpu", 1, "2016-01")))
+	s.mustFail(t, "not authorized to submit usage for U1", testOutsider, "submitUsage", testOutsider, "U1", toJSON(newUsage("R4", "cpu", 1, "2016-01")))
+	s.mustFail(t, "Meter gpu is not on the rate card", testSeller, "submitUsage", testSeller, "U1", toJSON(newUsage("R4", "gpu", 1, "2016-01")))
+	s.mustFail(t, "should not be negative", testSeller, "submitUsage", testSeller, "U1", toJSON(newUsage("R4", "cpu", -1, "2016-01")))
+	s.mustFail(t, "Usage id, period and source are required", testSeller, "submitUsage", testSeller, "U1", toJSON(newUsage("", "cpu", 1, "2016-01")))
+	s.mustFail(t, "UFA U2 has no rate card", testSeller, "submitUsage", testSeller, "U2", toJSON(newUsage("R4", "cpu", 1, "2016-01")))
+	s.mustFail(t, "Invalid UFA provided U9", testSeller, "submitUsage", testSeller, "U9", toJSON(newUsage("R4", "cpu", 1, "2016-01")))
+	s.mustFail(t, "expects the usage as JSON", testSeller, "submitUsage", testSeller, "U1", "usage")
+	s.mustFail(t, "submitUsage expects who", testSeller, "submitUsage", testSeller, "U1")
+
+	//cpu 10 at 2, storage 100 at 1 and 50 at 0.5
+	var rated RatedUsage
+	decode(t, s.mustCall(t, testBuyer, "getUsage", "U1", testBuyer, "2016-01"), &rated)
+	if rated.Total != 145 || len(rated.Meters) != 2 || len(rated.Records) != 2 {
+		t.Fatalf("getUsage returned %+v", rated)
+	}
+	s.mustFail(t, "not authorized to read UFA U1", testOutsider, "getUsage", "U1", testOutsider, "2016-01")
+}
+
+//Usage comes from the parties, or from a source registered on the UFA
+//submitting its own records
+func TestUsageSources(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", meteredUFA().with("usageSources", `["M1"]`))
+	meter := func(id string, source string) string {
+		usage := newUsage(id, "cpu", 1, "2016-01")
+		usage.Source = source
+		return toJSON(usage)
+	}
+	s.mustCall(t, "M1", "submitUsage", "M1", "U1", meter("R1", "M1"))
+	s.mustCall(t, testBuyer, "submitUsage", testBuyer, "U1", meter("R2", "M1"))
+	s.mustFail(t, "not authorized to submit usage for U1", "M1", "submitUsage", "M1", "U1", meter("R3", testSeller))
+	s.mustFail(t, "not authorized to submit usage for U1", testOutsider, "submitUsage", testOutsider, "U1", meter("R3", testOutsider))
+	s.mustFail(t, "Source M2 is not a usage source of U1", testSeller, "submitUsage", testSeller, "U1", meter("R3", "M2"))
+
+	createUFA(t, s, "U2", meteredUFA())
+	s.mustFail(t, "not authorized to submit usage for U2", "M1", "submitUsage", "M1", "U2", meter("R1", "M1"))
+	s.mustFail(t, "Usage sources should be a JSON array of names", testSeller, "createUFA", "U3", testSeller,
+		meteredUFA().with("ufanumber", "U3").with("usageSources", "M1").json())
+}
+
+//Usage of a UFA numbered like a key prefix stays apart from the usage
+//periods of the other UFAs
+func TestUsageKeys(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", meteredUFA())
+	createUFA(t, s, "PERIODS", meteredUFA().with("ufanumber", "PERIODS"))
+	createUFA(t, s, "PERIODS_U1", meteredUFA().with("ufanumber", "PERIODS_U1"))
+	s.mustCall(t, testSeller, "submitUsage", testSeller, "U1", toJSON(newUsage("R1", "cpu", 1, "2016-01")))
+	s.mustCall(t, testSeller, "submitUsage", testSeller, "PERIODS", toJSON(newUsage("R2", "cpu", 1, "U1")))
+	s.mustCall(t, testSeller, "submitUsage", testSeller, "PERIODS_U1", toJSON(newUsage("R3", "cpu", 1, "2016-01")))
+	assertList(t, "usage periods of U1", storedList(t, s, UFA_USAGE_PERIODS_PREFIX+"U1"), "2016-01")
+
+	var rated RatedUsage
+	decode(t, s.mustCall(t, testSeller, "getUsage", "U1", testSeller, "2016-01"), &rated)
+	if len(rated.Records) != 1 || rated.Records[0].ID != "R1" {
+		t.Fatalf("usage of U1 is %+v", rated.Records)
+	}
+	s.mustFail(t, "is not a billing period", testSeller, "submitUsage", testSeller, "U1", toJSON(newUsage("R4", "cpu", 1, "2016\x0001")))
+	s.mustFail(t, "is not a billing period", testSeller, "getUsage", "U1", testSeller, "2016\x0001")
+}
+
+func TestInvoicesFollowUsage(t *testing.T) {
+	s := newLedger(t, "")
+	createUFA(t, s, "U1", meteredUFA())
+	s.mustFail(t, "No usage is recorded for 2016-01", testSeller, "createNewInvoices", testSeller, toJSON(newInvoicePair("U1", "2016-01", "20")))
+
+	s.mustCall(t, testSeller, "submitUsage", testSeller, "U1", toJSON(newUsage("R1", "cpu", 10, "2016-01")))
+	s.mustFail(t, "does not match the rated usage of 20 for 2016-01", testSeller, "createNewInvoices", testSeller, toJSON(newInvoicePair("U1", "2016-01", "25")))
+	raisePair(t, s, newInvoicePair("U1", "2016-01", "20"))
+
+	//An invoiced period is closed to usage
+	s.mustFail(t, "Period 2016-01 of U1 is already invoiced", testSeller, "submitUsage", testSeller, "U1", toJSON(newUsage("R2", "cpu", 1, "2016-01")))
+}
+
+func TestValidateRateCard(t *testing.T) {
+	tests := []struct {
+		rateCard string
+		message  string
+	}{
+		{`{"cpu":{"type":"PER_UNIT","unitPrice":2}}`, ""},
+		{`{"cpu":{"type":"VOLUME","tiers":[{"upTo":10,"unitPrice":2},{"upTo":0,"unitPrice":1}]}}`, ""},
+		{`[]`, "\nRate card should be a JSON object of meter rates"},
+		{`{"cpu":{"type":"PER_UNIT","unitPrice":-2}}`, "\nUnit price of cpu should not be negative"},
+		{`{"cpu":{"type":"FLAT"}}`, "\nRate of cpu should be PER_UNIT, TIERED or VOLUME"},
+		{`{"cpu":{"type":"TIERED"}}`, "\nRate of cpu needs tiers"},
+		{`{"cpu":{"type":"TIERED","tiers":[{"upTo":10,"unitPrice":2},{"upTo":5,"unitPrice":1},{"upTo":0,"unitPrice":1}]}}`,
+			"\nTiers of cpu should rise, the last one without limit"},
+		{`{"cpu":{"type":"TIERED","tiers":[{"upTo":10,"unitPrice":2}]}}`, "\nTiers of cpu should rise, the last one without limit"},
+	}
+	for _, test := range tests {
+		if message := validateRateCard(map[string]string{"rateCard": test.rateCard}); message != test.message {
+			t.Errorf("validateRateCard(%s) = %q, want %q", test.rateCard, message, test.message)
+		}
+	}
+}
+
+func TestRatePrice(t *testing.T) {
+	tiers := []RateTier{{UpTo: 100, UnitPrice: 1}, {UpTo: 0, UnitPrice: 0.5}}
+	tests := []struct {
+		rate     Rate
+		quantity float64
+		price    float64
+	}{
+		{Rate{Type: RATE_PER_UNIT, UnitPrice: 2}, 10, 20},
+		{Rate{Type: RATE_TIERED, Tiers: tiers}, 50, 50},
+		{Rate{Type: RATE_TIERED, Tiers: tiers}, 150, 125},
+		{Rate{Type: RATE_VOLUME, Tiers: tiers}, 50, 50},
+		{Rate{Type: RATE_VOLUME, Tiers: tiers}, 150, 75},
+	}
+	for _, test := range tests {
+		if price := test.rate.price(test.quantity); price != test.price {
+			t.Errorf("%s price of %v = %v, want %v", test.rate.Type, test.quantity, price, test.price)
+		}
+	}
+}
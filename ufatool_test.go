@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/vajadhav/bp_upd/scenario"
+	"github.com/vajadhav/bp_upd/ufa"
+)
+
+//Extension of the certificates issued by the Fabric CA holding the
+//attributes of the identity
+var attributesOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+//Returns the serialized identity of a user of the MSP whose certificate
+//has the common name and, when given, the ufa.id attribute
+func testCreator(t *testing.T, mspID string, commonName string, ufaID string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if ufaID != "" {
+		attributes, _ := json.Marshal(map[string]map[string]string{"attrs": {UFA_ID_ATTRIBUTE: ufaID}})
+		template.ExtraExtensions = []pkix.Extension{{Id: attributesOID, Value: attributes}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creator, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return creator
+}
+
+//Converts the function and its arguments to the chaincode input
+func testArgs(function string, args ...string) [][]byte {
+	input := [][]byte{[]byte(function)}
+	for _, arg := range args {
+		input = append(input, []byte(arg))
+	}
+	return input
+}
+
+func TestUFAChainCode(t *testing.T) {
+	stub := shimtest.NewMockStub("ufa", new(UFAChainCode))
+	if response := stub.MockInit("tx0", testArgs("init", `{"alertThresholds":[-1]}`)); response.Status != shim.ERROR {
+		t.Fatalf("Init accepted an invalid configuration: %v", response)
+	}
+	if response := stub.MockInit("tx1", testArgs("init")); response.Status != shim.OK {
+		t.Fatalf("Init failed: %s", response.Message)
+	}
+
+	//The seller is named by the ufa.id attribute, the buyer by the common name
+	stub.Creator = testCreator(t, "Org1MSP", "seller@org1", "S1")
+	ufaDetails := `{"ufanumber":"U1","sellerName":"Org1MSP/S1","buyerName":"Org2MSP/B1","netCharge":"1000","chargTolrence":"10",` +
+		`"billingPeriod":"MONTHLY","startDate":"2016-01-01","endDate":"2030-12-31"}`
+	if response := stub.MockInvoke("tx2", testArgs("createUFA", "U1", "S1", ufaDetails)); response.Status != shim.OK {
+		t.Fatalf("createUFA failed: %s", response.Message)
+	}
+	stub.Creator = testCreator(t, "Org2MSP", "B1", "")
+	response := stub.MockInvoke("tx3", testArgs("getUFADetails", "U1", "someone else"))
+	if response.Status != shim.OK {
+		t.Fatalf("getUFADetails failed: %s", response.Message)
+	}
+	var stored map[string]string
+	if err := json.Unmarshal(response.Payload, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored["sellerName"] != "Org1MSP/S1" || stored["raisedInvTotal"] != "0" {
+		t.Fatalf("getUFADetails returned %v", stored)
+	}
+
+	//The who argument cannot stand in for the certificate
+	stub.Creator = testCreator(t, "Org3MSP", "X1", "")
+	if response := stub.MockInvoke("tx4", testArgs("getUFADetails", "U1", "Org1MSP/S1")); response.Status != shim.ERROR {
+		t.Fatalf("outsider read the UFA as S1: %s", response.Payload)
+	}
+	//Nor can another organization issue the seller's name
+	stub.Creator = testCreator(t, "Org3MSP", "S1", "S1")
+	if response := stub.MockInvoke("tx5", testArgs("getUFADetails", "U1", "Org1MSP/S1")); response.Status != shim.ERROR {
+		t.Fatalf("S1 of Org3MSP read the UFA: %s", response.Payload)
+	}
+	stub.Creator = nil
+	if response := stub.MockInvoke("tx6", testArgs("getUFADetails", "U1", "Org1MSP/S1")); response.Status != shim.ERROR {
+		t.Fatal("getUFADetails succeeded without a submitter")
+	}
+	if response := stub.MockInvoke("tx7", testArgs("noSuchFunction")); response.Status != shim.ERROR {
+		t.Fatal("unknown function succeeded")
+	}
+}
+
+func TestFabricStoreCallerID(t *testing.T) {
+	stub := shimtest.NewMockStub("ufa", new(UFAChainCode))
+	store := fabricStore{stub}
+	tests := []struct {
+		mspID      string
+		commonName string
+		ufaID      string
+		id         string
+	}{
+		{"Org1MSP", "seller@org1", "S1", "Org1MSP/S1"},
+		{"Org2MSP", "B1", "", "Org2MSP/B1"},
+		{"Org3MSP", "B1", "", "Org3MSP/B1"},
+	}
+	for _, test := range tests {
+		stub.Creator = testCreator(t, test.mspID, test.commonName, test.ufaID)
+		if id, err := store.CallerID(); err != nil || id != test.id {
+			t.Errorf("CallerID of %s = %q, %v, want %q", test.commonName, id, err, test.id)
+		}
+	}
+	stub.Creator = testCreator(t, "Org1MSP", "", "")
+	if _, err := store.CallerID(); err == nil {
+		t.Error("CallerID accepted a certificate without a name")
+	}
+	stub.Creator = testCreator(t, "", "B1", "")
+	if _, err := store.CallerID(); err == nil {
+		t.Error("CallerID accepted a certificate without an MSP")
+	}
+}
+
+func TestFabricStoreTxTime(t *testing.T) {
+	stub := shimtest.NewMockStub("ufa", new(UFAChainCode))
+	stub.MockTransactionStart("tx1")
+	defer stub.MockTransactionEnd("tx1")
+	now, err := fabricStore{stub}.TxTime()
+	if err != nil || time.Since(now) > time.Minute || time.Since(now) < 0 {
+		t.Fatalf("TxTime = %v, %v", now, err)
+	}
+	var _ ufa.Clock = fabricStore{stub}
+	var _ ufa.Identity = fabricStore{stub}
+}
+
+//invocation passes the function and arguments of a call to the chaincode
+//along with the MockStub
+type invocation struct {
+	*shimtest.MockStub
+	function string
+	args     []string
+}
+
+func (i invocation) GetFunctionAndParameters() (string, []string) {
+	return i.function, i.args
+}
+
+//chaincodeLedger runs the scenarios through UFAChainCode on a MockStub.
+//Each call is a transaction submitted with a certificate of the MSP named
+//by the user, as MSPID/name, and stamped with the date set by the scenario
+type chaincodeLedger struct {
+	t    *testing.T
+	stub *shimtest.MockStub
+	now  time.Time
+	tx   int
+}
+
+func (l *chaincodeLedger) transaction(who string, run func(stub shim.ChaincodeStubInterface) pb.Response, function string, args []string) ([]byte, error) {
+	l.tx++
+	txID := "tx" + strconv.Itoa(l.tx)
+	l.stub.MockTransactionStart(txID)
+	defer l.stub.MockTransactionEnd(txID)
+	if !l.now.IsZero() {
+		timestamp, _ := l.stub.GetTxTimestamp()
+		timestamp.Seconds, timestamp.Nanos = l.now.Unix(), int32(l.now.Nanosecond())
+	}
+	l.stub.Creator = nil
+	if mspID, name, ok := strings.Cut(who, "/"); ok {
+		l.stub.Creator = testCreator(l.t, mspID, name, "")
+	} else if who != "" {
+		return nil, errors.New("scenario users are named MSPID/name, found " + who)
+	}
+	response := run(invocation{l.stub, function, args})
+	if response.Status != shim.OK {
+		return nil, errors.New(response.Message)
+	}
+	return response.Payload, nil
+}
+
+func (l *chaincodeLedger) Init(args []string) error {
+	_, err := l.transaction("", new(UFAChainCode).Init, "init", args)
+	return err
+}
+
+func (l *chaincodeLedger) Call(who string, function string, args []string) ([]byte, error) {
+	return l.transaction(who, new(UFAChainCode).Invoke, function, args)
+}
+
+func (l *chaincodeLedger) GetState(key string) ([]byte, error) {
+	return l.stub.GetState(key)
+}
+
+func (l *chaincodeLedger) SetTime(now time.Time) {
+	l.now = now
+}
+
+func TestScenarios(t *testing.T) {
+	features, err := scenario.ParseGlob("scenario/testdata/*.feature")
+	if err != nil || len(features) == 0 {
+		t.Fatalf("reading the features: %v", err)
+	}
+	for _, feature := range features {
+		for _, sc := range feature.Scenarios {
+			feature, sc := feature, sc
+			t.Run(feature.Name+"/"+sc.Name, func(t *testing.T) {
+				ledger := &chaincodeLedger{t: t, stub: shimtest.NewMockStub("ufa", new(UFAChainCode))}
+				if err := feature.Run(sc, ledger); err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+	}
+}